@@ -0,0 +1,56 @@
+// Command webhook-receiver is a local endpoint for trying out webhooks. It
+// verifies signatures, prints received events and can fail a share of
+// requests to exercise retries and the dead-letter state.
+package main
+
+import (
+	"flag"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	secret := flag.String("secret", "", "endpoint secret returned when the webhook was registered")
+	failRate := flag.Float64("fail-rate", 0, "share of requests answered with 500, from 0 to 1")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "accepted clock skew of the signature timestamp")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("-secret is required")
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "read body", http.StatusBadRequest)
+			return
+		}
+
+		fields := log.Fields{
+			"event":    r.Header.Get(webhook.HeaderEvent),
+			"delivery": r.Header.Get(webhook.HeaderDelivery),
+		}
+		if err := webhook.Verify(*secret, r.Header, body, *tolerance); err != nil {
+			log.WithFields(fields).Warnf("rejected: %v", err)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if rand.Float64() < *failRate {
+			log.WithFields(fields).Info("failing on purpose")
+			http.Error(w, "simulated failure", http.StatusInternalServerError)
+			return
+		}
+
+		log.WithFields(fields).Info(string(body))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Infof("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -11,11 +11,18 @@ import (
 )
 
 type Config struct {
-	APP     AppConfig     `mapstructure:"app"`
-	HTTP    HTTPConfig    `mapstructure:"http"`
-	Log     LogConfig     `mapstructure:"log"`
-	Storage StorageConfig `mapstructure:"storage"`
-	JWT     JWTConfig     `mapstructure:"jwt"`
+	APP          AppConfig          `mapstructure:"app"`
+	HTTP         HTTPConfig         `mapstructure:"http"`
+	Log          LogConfig          `mapstructure:"log"`
+	Storage      StorageConfig      `mapstructure:"storage"`
+	JWT          JWTConfig          `mapstructure:"jwt"`
+	Admin        AdminConfig        `mapstructure:"admin"`
+	Webhook      WebhookConfig      `mapstructure:"webhook"`
+	Outbox       OutboxConfig       `mapstructure:"outbox"`
+	NATS         NATSConfig         `mapstructure:"nats"`
+	SMTP         SMTPConfig         `mapstructure:"smtp"`
+	Scheduler    SchedulerConfig    `mapstructure:"scheduler"`
+	Subscription SubscriptionConfig `mapstructure:"subscription"`
 }
 
 type AppConfig struct {
@@ -47,6 +54,60 @@ type JWTConfig struct {
 	TokenTTL time.Duration `mapstructure:"token_ttl"`
 }
 
+type WebhookConfig struct {
+	DispatchInterval  time.Duration `mapstructure:"dispatch_interval"`
+	RenewalNoticeDays int           `mapstructure:"renewal_notice_days"`
+	MaxAttempts       int           `mapstructure:"max_attempts"`
+	RequestTimeout    time.Duration `mapstructure:"request_timeout"`
+	// AllowPrivateNetworks lets endpoints point to loopback and private
+	// addresses, e.g. a local receiver during development.
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+type OutboxConfig struct {
+	RelayInterval time.Duration `mapstructure:"relay_interval"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+}
+
+// NATSConfig configures publishing of events to JetStream. An empty URL
+// disables it and events are only logged.
+type NATSConfig struct {
+	URL             string        `mapstructure:"url"`
+	Stream          string        `mapstructure:"stream"`
+	SubjectPrefix   string        `mapstructure:"subject_prefix"`
+	Tenant          string        `mapstructure:"tenant"`
+	DuplicateWindow time.Duration `mapstructure:"duplicate_window"`
+	PublishTimeout  time.Duration `mapstructure:"publish_timeout"`
+}
+
+// SMTPConfig configures the server reminder emails are sent through. An
+// empty host disables reminders.
+type SMTPConfig struct {
+	Host     string        `mapstructure:"host"`
+	Port     int           `mapstructure:"port"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	From     string        `mapstructure:"from"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// SchedulerConfig overrides cron expressions of background jobs by job name.
+// Expressions have five fields and are evaluated in UTC.
+type SchedulerConfig struct {
+	Jobs map[string]string `mapstructure:"jobs"`
+}
+
+// SubscriptionConfig sets what happens to a subscription that overlaps
+// another one of the same user and service: reject (the default), warn or
+// allow.
+type SubscriptionConfig struct {
+	OverlapPolicy string `mapstructure:"overlap_policy"`
+}
+
+type AdminConfig struct {
+	Token string `mapstructure:"token"`
+}
+
 func LoadConfig(configPath string) (*Config, error) {
 	if err := godotenv.Load(); err != nil {
 		return nil, fmt.Errorf("failed to load .env file: %v", err)
@@ -9,14 +9,17 @@ import (
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/config"
 	v1 "github.com/DmitriyKolesnikM8O/subscription-service/internal/controller/http/v1"
+	eventpublisher "github.com/DmitriyKolesnikM8O/subscription-service/internal/publisher"
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/worker"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/client/postgres"
 	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/httpserver"
 	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/logger"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/mailer"
 	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/validator"
 
 	_ "github.com/DmitriyKolesnikM8O/subscription-service/docs"
@@ -36,6 +39,11 @@ import (
 // @BasePath  /
 
 // @schemes   http
+
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description Административный токен в формате "Bearer <token>"
 func Run(configPath string) {
 
 	cfg, err := config.LoadConfig(configPath)
@@ -58,13 +66,76 @@ func Run(configPath string) {
 	log.Info("Initializing repositories")
 	repositories := repo.NewRepositories(pool)
 
+	var publisher service.Publisher = service.NewLogPublisher()
+	if cfg.NATS.URL != "" {
+		log.Info("Connect to NATS")
+		natsPublisher, err := eventpublisher.NewNATSPublisher(eventpublisher.NATSSettings{
+			URL:             cfg.NATS.URL,
+			Stream:          cfg.NATS.Stream,
+			SubjectPrefix:   cfg.NATS.SubjectPrefix,
+			Tenant:          cfg.NATS.Tenant,
+			DuplicateWindow: cfg.NATS.DuplicateWindow,
+			PublishTimeout:  cfg.NATS.PublishTimeout,
+		})
+		if err != nil {
+			log.Fatalf("Error when connecting NATS: %v", err)
+		}
+		defer natsPublisher.Close()
+		publisher = natsPublisher
+	}
+
+	var mailSender service.MailSender
+	if cfg.SMTP.Host != "" {
+		mailSender = mailer.NewSMTPSender(mailer.Settings{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+			Timeout:  cfg.SMTP.Timeout,
+		})
+	}
+
+	overlapPolicy, err := service.ParseOverlapPolicy(cfg.Subscription.OverlapPolicy)
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+
 	log.Info("Initializing services")
-	services := service.NewSubscriptionService(repositories)
+	services, err := service.NewServices(service.ServicesDependencies{
+		Repos: repositories,
+		Webhook: service.WebhookSettings{
+			MaxAttempts:          cfg.Webhook.MaxAttempts,
+			RequestTimeout:       cfg.Webhook.RequestTimeout,
+			RenewalNoticeDays:    cfg.Webhook.RenewalNoticeDays,
+			AllowPrivateNetworks: cfg.Webhook.AllowPrivateNetworks,
+		},
+		Outbox: service.OutboxSettings{
+			MaxAttempts: cfg.Outbox.MaxAttempts,
+		},
+		Publisher:     publisher,
+		Mailer:        mailSender,
+		JobSchedules:  cfg.Scheduler.Jobs,
+		OverlapPolicy: overlapPolicy,
+	})
+	if err != nil {
+		log.Fatalf("Error when initializing services: %v", err)
+	}
+
+	log.Info("Starting background workers")
+	scheduler := worker.NewScheduler(services.Job)
+	scheduler.Start()
+	webhookDispatcher := worker.NewWebhookDispatcher(services.Webhook, cfg.Webhook.DispatchInterval)
+	webhookDispatcher.Start()
+	outboxRelay := worker.NewOutboxRelay(services.Outbox, cfg.Outbox.RelayInterval)
+	outboxRelay.Start()
+	eventListener := worker.NewEventListener(services.EventStream, 0)
+	eventListener.Start()
 
 	log.Info("Initializing controllers")
 	handler := echo.New()
 	handler.Validator = validator.NewValidator()
-	v1.NewRouter(handler, services, log.StandardLogger())
+	v1.NewRouter(handler, services, cfg, log.StandardLogger())
 
 	log.Info("Initializing HTTP-server")
 	log.Debugf("Server port: %d", cfg.HTTP.Port)
@@ -82,8 +153,14 @@ func Run(configPath string) {
 	}
 
 	log.Info("Shutting down...")
+	// Closes open event streams, which would otherwise hold up the shutdown.
+	eventListener.Stop()
 	err = httpServer.Shutdown()
 	if err != nil {
 		log.Error(fmt.Errorf("app - Run - httpServer.Shutdown: %w", err))
 	}
+	services.Import.Shutdown()
+	scheduler.Stop()
+	webhookDispatcher.Stop()
+	outboxRelay.Stop()
 }
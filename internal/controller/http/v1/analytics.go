@@ -0,0 +1,270 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type AnalyticsController struct {
+	baseController
+	service service.AnalyticsService
+}
+
+func NewAnalyticsController(s service.AnalyticsService, logger *log.Logger) *AnalyticsController {
+	return &AnalyticsController{baseController: newBaseController(logger), service: s}
+}
+
+// MRR godoc
+// @Summary Помесячная динамика MRR
+// @Description Возвращает MRR, новый, ушедший и восстановленный MRR за каждый месяц периода
+// @Tags Analytics
+// @Produce json
+// @Security AdminToken
+// @Param start_date query string true "Начало периода (MM-YYYY)"
+// @Param end_date query string true "Конец периода (MM-YYYY)"
+// @Success 200 {object} MRRResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/analytics/mrr [get]
+func (c *AnalyticsController) MRR(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := AnalyticsPeriodRequest{
+		StartDate: ctx.QueryParam("start_date"),
+		EndDate:   ctx.QueryParam("end_date"),
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	startDate, endDate, errResp := parseMonthRange(req.StartDate, req.EndDate)
+	if errResp != nil {
+		c.logError("parse period", nil, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	months, err := c.service.GetMonthlyMRR(ctx.Request().Context(), startDate, endDate)
+	if err != nil {
+		c.logError("get monthly mrr", err, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("get monthly mrr", log.Fields{
+		"start_date": req.StartDate,
+		"end_date":   req.EndDate,
+	})
+	setMonthCacheHeaders(ctx, endDate)
+	if months == nil {
+		months = []entity.MonthlyMRR{}
+	}
+	return ctx.JSON(http.StatusOK, MRRResponse{Items: months})
+}
+
+// Retention godoc
+// @Summary Когорты удержания по сервисам
+// @Description Возвращает когорты пользователей по месяцу первой подписки на сервис и число оставшихся в каждом следующем месяце
+// @Tags Analytics
+// @Produce json
+// @Security AdminToken
+// @Param service_name query string false "Название сервиса"
+// @Param start_date query string true "Первая когорта (MM-YYYY)"
+// @Param end_date query string true "Конец периода наблюдения (MM-YYYY)"
+// @Success 200 {object} RetentionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/analytics/retention [get]
+func (c *AnalyticsController) Retention(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := AnalyticsPeriodRequest{
+		ServiceName: ctx.QueryParam("service_name"),
+		StartDate:   ctx.QueryParam("start_date"),
+		EndDate:     ctx.QueryParam("end_date"),
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	startDate, endDate, errResp := parseMonthRange(req.StartDate, req.EndDate)
+	if errResp != nil {
+		c.logError("parse period", nil, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	var serviceName *string
+	if req.ServiceName != "" {
+		serviceName = &req.ServiceName
+	}
+
+	cohorts, err := c.service.GetRetentionCohorts(ctx.Request().Context(), serviceName, startDate, endDate)
+	if err != nil {
+		c.logError("get retention cohorts", err, log.Fields{
+			"service_name": serviceName,
+			"start_date":   req.StartDate,
+			"end_date":     req.EndDate,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("get retention cohorts", log.Fields{
+		"service_name": serviceName,
+		"count":        len(cohorts),
+	})
+	setMonthCacheHeaders(ctx, endDate)
+	if cohorts == nil {
+		cohorts = []entity.RetentionCohort{}
+	}
+	return ctx.JSON(http.StatusOK, RetentionResponse{Items: cohorts})
+}
+
+// TopServices godoc
+// @Summary Топ сервисов
+// @Description Возвращает сервисы, отсортированные по числу активных подписчиков или выручке за период
+// @Tags Analytics
+// @Produce json
+// @Security AdminToken
+// @Param order_by query string false "Критерий сортировки: subscribers (по умолчанию) или revenue"
+// @Param start_date query string true "Начало периода (MM-YYYY)"
+// @Param end_date query string true "Конец периода (MM-YYYY)"
+// @Param limit query int false "Количество записей (по умолчанию 10, максимум 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} TopServicesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/analytics/top-services [get]
+func (c *AnalyticsController) TopServices(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := TopServicesRequest{
+		OrderBy:   ctx.QueryParam("order_by"),
+		StartDate: ctx.QueryParam("start_date"),
+		EndDate:   ctx.QueryParam("end_date"),
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	startDate, endDate, errResp := parseMonthRange(req.StartDate, req.EndDate)
+	if errResp != nil {
+		c.logError("parse period", nil, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+	limit, offset := parseLimitOffset(ctx)
+
+	ranking, total, err := c.service.GetTopServices(
+		ctx.Request().Context(),
+		entity.ServiceRankingMetric(req.OrderBy),
+		startDate,
+		endDate,
+		offset,
+		limit,
+	)
+	if err != nil {
+		c.logError("get top services", err, log.Fields{
+			"order_by":   req.OrderBy,
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("get top services", log.Fields{
+		"order_by": req.OrderBy,
+		"count":    len(ranking),
+	})
+	if ranking == nil {
+		ranking = []entity.ServiceRanking{}
+	}
+	return ctx.JSON(http.StatusOK, TopServicesResponse{
+		Items:  ranking,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// TopUsers godoc
+// @Summary Топ пользователей по расходам
+// @Description Возвращает пользователей, отсортированных по суммарной стоимости подписок за период
+// @Tags Analytics
+// @Produce json
+// @Security AdminToken
+// @Param start_date query string true "Начало периода (MM-YYYY)"
+// @Param end_date query string true "Конец периода (MM-YYYY)"
+// @Param limit query int false "Количество записей (по умолчанию 10, максимум 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} TopUsersResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/analytics/top-users [get]
+func (c *AnalyticsController) TopUsers(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := TopUsersRequest{
+		StartDate: ctx.QueryParam("start_date"),
+		EndDate:   ctx.QueryParam("end_date"),
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	startDate, endDate, errResp := parseMonthRange(req.StartDate, req.EndDate)
+	if errResp != nil {
+		c.logError("parse period", nil, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+	limit, offset := parseLimitOffset(ctx)
+
+	ranking, total, err := c.service.GetTopUsers(ctx.Request().Context(), startDate, endDate, offset, limit)
+	if err != nil {
+		c.logError("get top users", err, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("get top users", log.Fields{
+		"count": len(ranking),
+	})
+	if ranking == nil {
+		ranking = []entity.UserSpend{}
+	}
+	return ctx.JSON(http.StatusOK, TopUsersResponse{
+		Items:  ranking,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
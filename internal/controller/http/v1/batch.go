@@ -0,0 +1,261 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// BatchCreate godoc
+// @Summary Массовое создание подписок
+// @Description Создает до 1000 подписок. В режиме atomic (по умолчанию) создаются все подписки или ни одной, в режиме best_effort создаются корректные. Для каждой подписки возвращаются статус и ошибка, как у одиночного запроса
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param request body BatchCreateRequest true "Подписки"
+// @Success 200 {object} BatchResponse
+// @Success 207 {object} BatchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} BatchResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/batch [post]
+func (c *SubscriptionController) BatchCreate(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req BatchCreateRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	mode := batchMode(req.Mode)
+	items := newBatchItems(len(req.Items))
+	var (
+		valid []int
+		subs  []entity.Subscription
+	)
+	for i, item := range req.Items {
+		if err := ctx.Validate(item); err != nil {
+			items[i].fail(http.StatusUnprocessableEntity, ValidationErrorResponse(err))
+			continue
+		}
+		sub, errResp := c.subscriptionFromCreate(item)
+		if errResp != nil {
+			items[i].fail(http.StatusBadRequest, *errResp)
+			continue
+		}
+		valid, subs = append(valid, i), append(subs, sub)
+	}
+
+	return c.applyBatch(ctx, "batch create subscriptions", mode, items, valid, http.StatusCreated,
+		func() ([]entity.BatchItemResult, error) {
+			return c.service.CreateSubscriptions(ctx.Request().Context(), subs, mode)
+		})
+}
+
+// BatchUpdate godoc
+// @Summary Массовое обновление подписок
+// @Description Обновляет до 1000 подписок. В режиме atomic (по умолчанию) обновляются все подписки или ни одной, в режиме best_effort обновляются корректные
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param request body BatchUpdateRequest true "Изменения подписок"
+// @Success 200 {object} BatchResponse
+// @Success 207 {object} BatchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} BatchResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/batch [put]
+func (c *SubscriptionController) BatchUpdate(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req BatchUpdateRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	mode := batchMode(req.Mode)
+	items := newBatchItems(len(req.Items))
+	var (
+		valid []int
+		subs  []entity.Subscription
+	)
+	for i, item := range req.Items {
+		items[i].ID = item.ID
+		if err := ctx.Validate(item); err != nil {
+			items[i].fail(http.StatusUnprocessableEntity, ValidationErrorResponse(err))
+			continue
+		}
+		id, err := uuid.Parse(item.ID)
+		if err != nil {
+			items[i].fail(http.StatusBadRequest, ErrInvalidSubscription)
+			continue
+		}
+		sub, errResp := c.subscriptionFromUpdate(item.UpdateRequest)
+		if errResp != nil {
+			items[i].fail(http.StatusBadRequest, *errResp)
+			continue
+		}
+		sub.ID = id
+		valid, subs = append(valid, i), append(subs, sub)
+	}
+
+	return c.applyBatch(ctx, "batch update subscriptions", mode, items, valid, http.StatusNoContent,
+		func() ([]entity.BatchItemResult, error) {
+			return c.service.UpdateSubscriptions(ctx.Request().Context(), subs, mode)
+		})
+}
+
+// BatchDelete godoc
+// @Summary Массовое удаление подписок
+// @Description Удаляет до 1000 подписок. В режиме atomic (по умолчанию) удаляются все подписки или ни одной, в режиме best_effort удаляются существующие
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param request body BatchDeleteRequest true "ID подписок"
+// @Success 200 {object} BatchResponse
+// @Success 207 {object} BatchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} BatchResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/batch [delete]
+func (c *SubscriptionController) BatchDelete(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req BatchDeleteRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	mode := batchMode(req.Mode)
+	items := newBatchItems(len(req.IDs))
+	var (
+		valid []int
+		ids   []uuid.UUID
+	)
+	for i, raw := range req.IDs {
+		items[i].ID = raw
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			items[i].fail(http.StatusBadRequest, ErrInvalidSubscription)
+			continue
+		}
+		valid, ids = append(valid, i), append(ids, id)
+	}
+
+	return c.applyBatch(ctx, "batch delete subscriptions", mode, items, valid, http.StatusNoContent,
+		func() ([]entity.BatchItemResult, error) {
+			return c.service.DeleteSubscriptions(ctx.Request().Context(), ids, mode)
+		})
+}
+
+func batchMode(raw string) entity.BatchMode {
+	if raw == "" {
+		return entity.BatchAtomic
+	}
+	return entity.BatchMode(raw)
+}
+
+func newBatchItems(n int) []BatchItemResponse {
+	items := make([]BatchItemResponse, n)
+	for i := range items {
+		items[i].Index = i
+	}
+	return items
+}
+
+func (item *BatchItemResponse) fail(status int, resp ErrorResponse) {
+	item.Status, item.Error = status, &resp
+}
+
+// failWith records the response the single-item endpoint gives for err.
+func (item *BatchItemResponse) failWith(err error) {
+	he := HTTPError(err)
+	resp, ok := he.Message.(ErrorResponse)
+	if !ok {
+		resp = ErrorResponse{Code: CodeBadRequest, Message: fmt.Sprint(he.Message)}
+	}
+	item.fail(he.Code, resp)
+}
+
+// applyBatch passes the items at valid, which parsed, to apply and renders
+// the outcome of every item. An atomic batch with an item that did not parse
+// is not applied at all.
+func (c *SubscriptionController) applyBatch(
+	ctx echo.Context,
+	op string,
+	mode entity.BatchMode,
+	items []BatchItemResponse,
+	valid []int,
+	okStatus int,
+	apply func() ([]entity.BatchItemResult, error),
+) error {
+	atomic := mode == entity.BatchAtomic
+	switch {
+	case atomic && len(valid) < len(items):
+		for _, i := range valid {
+			items[i].failWith(service.ErrBatchAborted)
+		}
+	case len(valid) > 0:
+		results, err := apply()
+		if err != nil {
+			c.logError(op, err, log.Fields{
+				"mode":  mode,
+				"items": len(items),
+			})
+			return HTTPError(err)
+		}
+		for k, i := range valid {
+			if results[k].ID != uuid.Nil {
+				items[i].ID = results[k].ID.String()
+			}
+			if results[k].Err != nil {
+				items[i].failWith(results[k].Err)
+				continue
+			}
+			items[i].Status, items[i].Overlaps = okStatus, results[k].Overlaps
+		}
+	}
+
+	resp := BatchResponse{Mode: string(mode), Items: items}
+	for _, item := range items {
+		if item.Error != nil {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+	}
+
+	c.logSuccess(op, log.Fields{
+		"mode":      mode,
+		"succeeded": resp.Succeeded,
+		"failed":    resp.Failed,
+	})
+	switch {
+	case resp.Failed == 0:
+		return ctx.JSON(http.StatusOK, resp)
+	case atomic:
+		return ctx.JSON(http.StatusUnprocessableEntity, resp)
+	default:
+		return ctx.JSON(http.StatusMultiStatus, resp)
+	}
+}
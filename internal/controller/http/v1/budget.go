@@ -0,0 +1,252 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type BudgetController struct {
+	baseController
+	service service.BudgetService
+}
+
+func NewBudgetController(s service.BudgetService, logger *log.Logger) *BudgetController {
+	return &BudgetController{baseController: newBaseController(logger), service: s}
+}
+
+// budgetHTTPError maps budget-specific repository errors before falling back
+// to HTTPError, whose messages are about subscriptions.
+func budgetHTTPError(err error) *echo.HTTPError {
+	switch {
+	case errors.Is(err, repoerrs.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, ErrBudgetNotFound)
+	case errors.Is(err, repoerrs.ErrAlreadyExists):
+		return echo.NewHTTPError(http.StatusConflict, ErrBudgetExists)
+	default:
+		return HTTPError(err)
+	}
+}
+
+// Create godoc
+// @Summary Создать бюджет
+// @Description Создает месячный бюджет пользователя на все подписки или на один сервис. При превышении фактических или прогнозных расходов создаются оповещения
+// @Tags Budgets
+// @Accept json
+// @Produce json
+// @Param request body CreateBudgetRequest true "Данные бюджета"
+// @Success 201 {object} entity.Budget
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/budgets [post]
+func (c *BudgetController) Create(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req CreateBudgetRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	budget := entity.Budget{UserID: userID, Amount: req.Amount}
+	if req.ServiceName != "" {
+		budget.ServiceName = &req.ServiceName
+	}
+
+	created, err := c.service.CreateBudget(ctx.Request().Context(), budget)
+	if err != nil {
+		c.logError("create budget", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+			"service_name": budget.ServiceName,
+		})
+		return budgetHTTPError(err)
+	}
+
+	c.logSuccess("create budget", log.Fields{
+		"budget_id":    created.ID,
+		"user_id_hash": hashString(userID.String()),
+	})
+	return ctx.JSON(http.StatusCreated, created)
+}
+
+// List godoc
+// @Summary Бюджеты пользователя
+// @Description Возвращает все бюджеты пользователя
+// @Tags Budgets
+// @Produce json
+// @Param user_id query string true "ID пользователя"
+// @Success 200 {object} BudgetsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/budgets [get]
+func (c *BudgetController) List(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDQuery(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	budgets, err := c.service.ListBudgets(ctx.Request().Context(), userID)
+	if err != nil {
+		c.logError("list budgets", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return budgetHTTPError(err)
+	}
+
+	c.logSuccess("list budgets", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+		"count":        len(budgets),
+	})
+	if budgets == nil {
+		budgets = []entity.Budget{}
+	}
+	return ctx.JSON(http.StatusOK, BudgetsResponse{Items: budgets})
+}
+
+// Update godoc
+// @Summary Изменить бюджет
+// @Description Изменяет сумму бюджета. Оповещения текущего и следующих месяцев пересчитываются
+// @Tags Budgets
+// @Accept json
+// @Produce json
+// @Param id path string true "ID бюджета"
+// @Param request body UpdateBudgetRequest true "Новая сумма"
+// @Success 200 {object} entity.Budget
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/budgets/{id} [put]
+func (c *BudgetController) Update(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse budget ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	var req UpdateBudgetRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	updated, err := c.service.UpdateBudget(ctx.Request().Context(), id, req.Amount)
+	if err != nil {
+		c.logError("update budget", err, log.Fields{
+			"budget_id": id,
+		})
+		return budgetHTTPError(err)
+	}
+
+	c.logSuccess("update budget", log.Fields{
+		"budget_id": id,
+	})
+	return ctx.JSON(http.StatusOK, updated)
+}
+
+// Delete godoc
+// @Summary Удалить бюджет
+// @Description Удаляет бюджет вместе с его оповещениями
+// @Tags Budgets
+// @Param id path string true "ID бюджета"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/budgets/{id} [delete]
+func (c *BudgetController) Delete(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse budget ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := c.service.DeleteBudget(ctx.Request().Context(), id); err != nil {
+		c.logError("delete budget", err, log.Fields{
+			"budget_id": id,
+		})
+		return budgetHTTPError(err)
+	}
+
+	c.logSuccess("delete budget", log.Fields{
+		"budget_id": id,
+	})
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// Alerts godoc
+// @Summary Оповещения о превышении бюджета
+// @Description Возвращает оповещения пользователя, начиная с последних. actual — превышение в текущем месяце, projected — прогноз превышения в следующем
+// @Tags Budgets
+// @Produce json
+// @Param user_id query string true "ID пользователя"
+// @Param limit query int false "Количество записей (по умолчанию 10, максимум 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} BudgetAlertsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/budgets/alerts [get]
+func (c *BudgetController) Alerts(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDQuery(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+	limit, offset := parseLimitOffset(ctx)
+
+	alerts, err := c.service.ListAlerts(ctx.Request().Context(), userID, offset, limit)
+	if err != nil {
+		c.logError("list budget alerts", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return budgetHTTPError(err)
+	}
+
+	c.logSuccess("list budget alerts", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+		"count":        len(alerts),
+	})
+	if alerts == nil {
+		alerts = []entity.BudgetAlert{}
+	}
+	return ctx.JSON(http.StatusOK, BudgetAlertsResponse{
+		Items:  alerts,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
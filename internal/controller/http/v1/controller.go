@@ -0,0 +1,141 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	monthLayout = "01-2006"
+	dayLayout   = "2006-01-02"
+)
+
+// baseController holds the logging helpers shared by all controllers.
+type baseController struct {
+	logger *log.Logger
+}
+
+func newBaseController(logger *log.Logger) baseController {
+	if logger == nil {
+		logger = log.New()
+		logger.SetReportCaller(true)
+	}
+	return baseController{logger: logger}
+}
+
+func (c *baseController) logRequest(method, path string) {
+	c.logger.WithFields(log.Fields{
+		"method": method,
+		"path":   path,
+		"time":   time.Now().UTC().Format(time.RFC3339),
+	}).Info("request started")
+}
+
+func (c *baseController) logSuccess(action string, fields log.Fields) {
+	if fields == nil {
+		fields = log.Fields{}
+	}
+	fields["time"] = time.Now().UTC().Format(time.RFC3339)
+	c.logger.WithFields(fields).Infof("%s completed successfully", action)
+}
+
+func (c *baseController) logError(action string, err error, fields log.Fields) {
+	if fields == nil {
+		fields = log.Fields{}
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	fields["time"] = time.Now().UTC().Format(time.RFC3339)
+	c.logger.WithFields(fields).Errorf("failed to %s", action)
+}
+
+func hashString(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// parseMonthRange parses an inclusive MM-YYYY period the same way CalculateTotalCost does.
+func parseMonthRange(startRaw, endRaw string) (time.Time, time.Time, *ErrorResponse) {
+	startDate, err := time.Parse(monthLayout, startRaw)
+	if err != nil {
+		return time.Time{}, time.Time{}, &ErrInvalidDateFormat
+	}
+	endDate, err := time.Parse(monthLayout, endRaw)
+	if err != nil {
+		return time.Time{}, time.Time{}, &ErrInvalidDateFormat
+	}
+	if endDate.Before(startDate) {
+		return time.Time{}, time.Time{}, &ErrInvalidDateRange
+	}
+	return startDate, endDate, nil
+}
+
+// parseWithTotal reads the with_total query parameter, which is true unless
+// given.
+func parseWithTotal(ctx echo.Context) (bool, error) {
+	raw := ctx.QueryParam("with_total")
+	if raw == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(raw)
+}
+
+// parseOptional parses a value in layout that was already validated,
+// returning nil when it is empty.
+func parseOptional(layout, raw string) *time.Time {
+	t, err := time.Parse(layout, raw)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// setMonthCacheHeaders lets the client cache reports that only cover closed
+// months. They are admin-only, so shared caches must not keep them.
+func setMonthCacheHeaders(ctx echo.Context, endDate time.Time) {
+	now := time.Now().UTC()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if endDate.Before(currentMonth) {
+		ctx.Response().Header().Set(echo.HeaderCacheControl, "private, max-age=3600")
+		return
+	}
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-cache")
+}
+
+// parseLimitOffset reads limit/offset query parameters, falling back to the
+// same defaults ListByUser uses for page/limit.
+func parseLimitOffset(ctx echo.Context) (limit, offset int) {
+	limit, err := strconv.Atoi(ctx.QueryParam("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 10
+	}
+	offset, err = strconv.Atoi(ctx.QueryParam("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// parseUserIDQuery reads the required user_id query parameter.
+func (c *baseController) parseUserIDQuery(ctx echo.Context) (uuid.UUID, *ErrorResponse) {
+	req := UserIDQuery{UserID: ctx.QueryParam("user_id")}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return uuid.Nil, &ErrInvalidUserID
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return uuid.Nil, &ErrInvalidUserID
+	}
+	return userID, nil
+}
@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/google/uuid"
+)
+
+// cursorToken is the JSON inside an opaque cursor. Clients must not rely on
+// its layout.
+type cursorToken struct {
+	StartDate string    `json:"d"`
+	ID        uuid.UUID `json:"i"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+func encodeCursor(cursor *entity.SubscriptionCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(cursorToken{
+		StartDate: cursor.StartDate.Format(time.DateOnly),
+		ID:        cursor.ID,
+		Backward:  cursor.Backward,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (entity.SubscriptionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return entity.SubscriptionCursor{}, fmt.Errorf("decode cursor: %v", err)
+	}
+
+	var token cursorToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return entity.SubscriptionCursor{}, fmt.Errorf("decode cursor: %v", err)
+	}
+	startDate, err := time.Parse(time.DateOnly, token.StartDate)
+	if err != nil {
+		return entity.SubscriptionCursor{}, fmt.Errorf("decode cursor: %v", err)
+	}
+
+	return entity.SubscriptionCursor{StartDate: startDate, ID: token.ID, Backward: token.Backward}, nil
+}
@@ -1,16 +1,33 @@
 package v1
 
-import "github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+import (
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/google/uuid"
+)
 
 type CreateServiceRequest struct {
-	Name  string `json:"name" validate:"required,min=2,max=100"`
-	Price int    `json:"price" validate:"required,gt=0"`
+	Name     string `json:"name" validate:"required,min=2,max=100"`
+	Price    int    `json:"price" validate:"required,gt=0"`
+	Category string `json:"category" validate:"omitempty,min=2,max=50"`
 }
 
 type CreateRequest struct {
 	Service   CreateServiceRequest `json:"service" validate:"required"`
 	UserID    string               `json:"user_id" validate:"required,uuid4"`
 	StartDate string               `json:"start_date" validate:"required,datetime=01-2006"`
+	Status    string               `json:"status" validate:"omitempty,oneof=trial active"`
+	TrialEnd  string               `json:"trial_end" validate:"omitempty,datetime=01-2006"`
+	Discount  *DiscountRequest     `json:"discount" validate:"omitempty"`
+	PromoCode string               `json:"promo_code" validate:"omitempty,max=64"`
+	AutoRenew bool                 `json:"auto_renew"`
+	Notes     string               `json:"notes" validate:"omitempty,max=1000"`
+	Metadata  map[string]string    `json:"metadata" validate:"omitempty,max=20,dive,keys,min=1,max=40,excludes=:,endkeys,max=500"`
+}
+
+type DiscountRequest struct {
+	Type   string `json:"type" validate:"required,oneof=percent fixed"`
+	Value  int    `json:"value" validate:"required,gt=0"`
+	Months *int   `json:"months" validate:"omitempty,gt=0"`
 }
 
 type CalculateTotalCostRequest struct {
@@ -21,26 +38,293 @@ type CalculateTotalCostRequest struct {
 }
 
 type UpdateServiceRequest struct {
-	Name  string `json:"name" validate:"omitempty,min=2,max=100"`
-	Price int    `json:"price" validate:"omitempty,gt=0"`
+	Name     string `json:"name" validate:"omitempty,min=2,max=100"`
+	Price    int    `json:"price" validate:"omitempty,gt=0"`
+	Category string `json:"category" validate:"omitempty,min=2,max=50"`
 }
 
 type UpdateRequest struct {
-	Service UpdateServiceRequest `json:"service" validate:"required"`
-	EndDate string               `json:"end_date" validate:"omitempty,datetime=01-2006"`
+	Service   UpdateServiceRequest `json:"service" validate:"required"`
+	EndDate   string               `json:"end_date" validate:"omitempty,datetime=01-2006"`
+	AutoRenew bool                 `json:"auto_renew"`
+	Notes     string               `json:"notes" validate:"omitempty,max=1000"`
+	Metadata  map[string]string    `json:"metadata" validate:"omitempty,max=20,dive,keys,min=1,max=40,excludes=:,endkeys,max=500"`
+}
+
+// BatchCreateRequest, BatchUpdateRequest and BatchDeleteRequest apply up to
+// 1000 changes. Mode is atomic unless best_effort is given.
+type BatchCreateRequest struct {
+	Mode  string          `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Items []CreateRequest `json:"items" validate:"required,min=1,max=1000"`
+}
+
+type BatchUpdateItem struct {
+	ID string `json:"id" validate:"required,uuid"`
+	UpdateRequest
+}
+
+type BatchUpdateRequest struct {
+	Mode  string            `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Items []BatchUpdateItem `json:"items" validate:"required,min=1,max=1000"`
+}
+
+type BatchDeleteRequest struct {
+	Mode string   `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	IDs  []string `json:"ids" validate:"required,min=1,max=1000"`
+}
+
+// BatchItemResponse is the outcome of one item, with the status and error
+// the single-item endpoint would have responded with.
+type BatchItemResponse struct {
+	Index    int            `json:"index"`
+	ID       string         `json:"id,omitempty"`
+	Status   int            `json:"status"`
+	Error    *ErrorResponse `json:"error,omitempty"`
+	Overlaps []uuid.UUID    `json:"overlaps,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      string              `json:"mode"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Items     []BatchItemResponse `json:"items"`
 }
 
 // type ErrorResponse struct {
 // 	Message string `json:"message"`
 // }
 
+// TotalCostResponse reports the charged amount in Total, the cost at list
+// prices in Gross and what trials and discounts saved in Discount.
 type TotalCostResponse struct {
-	Total int `json:"total"`
+	Total    int `json:"total"`
+	Gross    int `json:"gross"`
+	Discount int `json:"discount"`
+}
+
+// ListSubscriptionsRequest holds the filters and sort of a subscription
+// listing. Months are MM-YYYY, days YYYY-MM-DD and ranges are inclusive.
+// Metadata filters are a key or key:value.
+type ListSubscriptionsRequest struct {
+	ActiveOnly        bool     `query:"active_only"`
+	ServiceName       string   `query:"service_name" validate:"omitempty,min=2,max=100"`
+	ServiceNamePrefix string   `query:"service_name_prefix" validate:"omitempty,max=100"`
+	MinPrice          *int     `query:"min_price" validate:"omitempty,gte=0"`
+	MaxPrice          *int     `query:"max_price" validate:"omitempty,gte=0"`
+	ActiveOn          string   `query:"active_on" validate:"omitempty,datetime=01-2006"`
+	StartedFrom       string   `query:"started_from" validate:"omitempty,datetime=01-2006"`
+	StartedTo         string   `query:"started_to" validate:"omitempty,datetime=01-2006"`
+	EndedFrom         string   `query:"ended_from" validate:"omitempty,datetime=01-2006"`
+	EndedTo           string   `query:"ended_to" validate:"omitempty,datetime=01-2006"`
+	CreatedFrom       string   `query:"created_from" validate:"omitempty,datetime=2006-01-02"`
+	CreatedTo         string   `query:"created_to" validate:"omitempty,datetime=2006-01-02"`
+	Status            []string `query:"status" validate:"omitempty,dive,oneof=trial active paused cancelled expired"`
+	Category          string   `query:"category" validate:"omitempty,min=2,max=50"`
+	Metadata          []string `query:"metadata" validate:"omitempty,max=10,dive,min=1,max=541"`
+	Sort              string   `query:"sort" validate:"omitempty,oneof=start_date created_at price service_name"`
+	Order             string   `query:"order" validate:"omitempty,oneof=asc desc"`
 }
 
+// PaginatedResponse is a page of an offset listing. Total is omitted when
+// the client asked to skip counting.
 type PaginatedResponse struct {
-	Items []entity.Subscription `json:"items"`
-	Total int                   `json:"total"`
-	Page  int                   `json:"page"`
-	Limit int                   `json:"limit"`
+	Items      []entity.Subscription `json:"items"`
+	Total      *int                  `json:"total,omitempty"`
+	HasMore    bool                  `json:"has_more"`
+	Page       int                   `json:"page"`
+	Limit      int                   `json:"limit"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	PrevCursor string                `json:"prev_cursor,omitempty"`
+}
+
+// CursorPaginatedResponse is a page of a cursor listing. An empty cursor
+// means there is no page in that direction.
+type CursorPaginatedResponse struct {
+	Items      []entity.Subscription `json:"items"`
+	Limit      int                   `json:"limit"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	PrevCursor string                `json:"prev_cursor,omitempty"`
+}
+
+type SearchSubscriptionsRequest struct {
+	Query string `query:"q" validate:"required,min=2,max=100"`
+}
+
+type SearchSubscriptionsResponse struct {
+	Items  []entity.SubscriptionMatch `json:"items"`
+	Limit  int                        `json:"limit"`
+	Offset int                        `json:"offset"`
+}
+
+type AnalyticsPeriodRequest struct {
+	ServiceName string `query:"service_name" validate:"omitempty,min=2,max=100"`
+	StartDate   string `query:"start_date" validate:"required,datetime=01-2006"`
+	EndDate     string `query:"end_date" validate:"required,datetime=01-2006"`
+}
+
+type MRRResponse struct {
+	Items []entity.MonthlyMRR `json:"items"`
+}
+
+type RetentionResponse struct {
+	Items []entity.RetentionCohort `json:"items"`
+}
+
+type TopServicesRequest struct {
+	OrderBy   string `query:"order_by" validate:"omitempty,oneof=subscribers revenue"`
+	StartDate string `query:"start_date" validate:"required,datetime=01-2006"`
+	EndDate   string `query:"end_date" validate:"required,datetime=01-2006"`
+}
+
+type TopUsersRequest struct {
+	StartDate string `query:"start_date" validate:"required,datetime=01-2006"`
+	EndDate   string `query:"end_date" validate:"required,datetime=01-2006"`
+}
+
+type TopServicesResponse struct {
+	Items  []entity.ServiceRanking `json:"items"`
+	Total  int                     `json:"total"`
+	Limit  int                     `json:"limit"`
+	Offset int                     `json:"offset"`
+}
+
+type TopUsersResponse struct {
+	Items  []entity.UserSpend `json:"items"`
+	Total  int                `json:"total"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+type ExportSubscriptionsRequest struct {
+	UserID string `query:"user_id" validate:"omitempty,uuid4"`
+	Format string `query:"format" validate:"omitempty,oneof=csv ndjson"`
+}
+
+type ExportTotalCostRequest struct {
+	CalculateTotalCostRequest
+	Format string `query:"format" validate:"omitempty,oneof=csv ndjson"`
+}
+
+type UpcomingRenewalsRequest struct {
+	UserID string `query:"user_id" validate:"required,uuid4"`
+	Days   int    `query:"days" validate:"min=1,max=365"`
+}
+
+type UpcomingRenewalsResponse struct {
+	Items []entity.Renewal `json:"items"`
+	Days  int              `json:"days"`
+}
+
+type CalendarFeedRequest struct {
+	UserID string `json:"user_id" validate:"required,uuid4"`
+}
+
+type CalendarFeedResponse struct {
+	URL string `json:"url"`
+}
+
+type CreatePromoCodeRequest struct {
+	Code       string `json:"code" validate:"required,min=3,max=64"`
+	Type       string `json:"type" validate:"required,oneof=percent fixed"`
+	Value      int    `json:"value" validate:"required,gt=0"`
+	Months     *int   `json:"months" validate:"omitempty,gt=0"`
+	ValidUntil string `json:"valid_until" validate:"omitempty,datetime=2006-01-02"`
+}
+
+type PromoCodesResponse struct {
+	Items []entity.PromoCode `json:"items"`
+}
+
+type CreateBudgetRequest struct {
+	UserID      string `json:"user_id" validate:"required,uuid4"`
+	ServiceName string `json:"service_name" validate:"omitempty,min=2,max=100"`
+	Amount      int    `json:"amount" validate:"required,gt=0"`
+}
+
+type UpdateBudgetRequest struct {
+	Amount int `json:"amount" validate:"required,gt=0"`
+}
+
+// NotificationPreferencesRequest omits reminder flags to enable them.
+type NotificationPreferencesRequest struct {
+	UserID           string `json:"user_id" validate:"required,uuid4"`
+	Email            string `json:"email" validate:"required,email,max=254"`
+	Locale           string `json:"locale" validate:"omitempty,oneof=ru en"`
+	RenewalReminders *bool  `json:"renewal_reminders"`
+	TrialReminders   *bool  `json:"trial_reminders"`
+	DaysBefore       int    `json:"days_before" validate:"omitempty,min=1,max=30"`
+}
+
+type UserIDQuery struct {
+	UserID string `query:"user_id" validate:"required,uuid4"`
+}
+
+type EraseUserDataRequest struct {
+	Reference string `query:"reference" validate:"omitempty,max=200"`
+}
+
+type BudgetsResponse struct {
+	Items []entity.Budget `json:"items"`
+}
+
+type BudgetAlertsResponse struct {
+	Items  []entity.BudgetAlert `json:"items"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
+}
+
+type CreateWebhookRequest struct {
+	UserID     string   `json:"user_id" validate:"required,uuid4"`
+	URL        string   `json:"url" validate:"required,url,max=2048"`
+	EventTypes []string `json:"event_types" validate:"omitempty,dive,oneof=subscription.created subscription.updated subscription.deleted subscription.expired subscription.renewed subscription.renewal_due"`
+}
+
+type WebhooksResponse struct {
+	Items []entity.WebhookEndpoint `json:"items"`
+}
+
+type WebhookDeliveriesRequest struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending delivered dead"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Items  []entity.WebhookDelivery `json:"items"`
+	Total  int                      `json:"total"`
+	Limit  int                      `json:"limit"`
+	Offset int                      `json:"offset"`
+}
+
+// ImportReportResponse is the outcome of a dry run of an import: the rows
+// that would be skipped and why.
+type ImportReportResponse struct {
+	TotalRows  int                     `json:"total_rows"`
+	ValidRows  int                     `json:"valid_rows"`
+	FailedRows int                     `json:"failed_rows"`
+	Errors     []entity.ImportRowError `json:"errors"`
+}
+
+type JobsResponse struct {
+	Items []entity.Job `json:"items"`
+}
+
+type JobRunsResponse struct {
+	Items  []entity.JobRun `json:"items"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+type DeadOutboxEventsResponse struct {
+	Items  []entity.DeadOutboxEvent `json:"items"`
+	Limit  int                      `json:"limit"`
+	Offset int                      `json:"offset"`
+}
+
+// RequeueOutboxEventsRequest lists the dead events to retry, an empty list
+// retries all of them.
+type RequeueOutboxEventsRequest struct {
+	IDs []string `json:"ids" validate:"max=1000,dive,uuid"`
+}
+
+type RequeueOutboxEventsResponse struct {
+	Requeued int `json:"requeued"`
 }
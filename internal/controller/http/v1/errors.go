@@ -6,13 +6,17 @@ import (
 	"net/http"
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 type ErrorResponse struct {
 	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
+	// ConflictingID is the subscription a rejected one overlaps.
+	ConflictingID *uuid.UUID `json:"conflicting_id,omitempty"`
 }
 
 const (
@@ -26,6 +30,20 @@ const (
 	CodeNotFound            = "NOT_FOUND"
 	CodeAlreadyExists       = "ALREADY_EXISTS"
 	CodeInternalError       = "INTERNAL_ERROR"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeInvalidTransition   = "INVALID_STATUS_TRANSITION"
+	CodeInvalidStatus       = "INVALID_STATUS"
+	CodeConflict            = "CONFLICT"
+	CodeInvalidDiscount     = "INVALID_DISCOUNT"
+	CodeInvalidPromoCode    = "INVALID_PROMO_CODE"
+	CodeInvalidTrial        = "INVALID_TRIAL"
+	CodeInvalidWebhook      = "INVALID_WEBHOOK"
+	CodeInvalidPreferences  = "INVALID_PREFERENCES"
+	CodeJobRunning          = "JOB_RUNNING"
+	CodeInvalidCursor       = "INVALID_CURSOR"
+	CodeBatchAborted        = "BATCH_ABORTED"
+	CodeInvalidImport       = "INVALID_IMPORT"
+	CodeOverlap             = "SUBSCRIPTION_OVERLAP"
 )
 
 var (
@@ -39,6 +57,32 @@ var (
 	ErrSubscriptionNotFound = ErrorResponse{Code: CodeNotFound, Message: "subscription not found"}
 	ErrSubscriptionExists   = ErrorResponse{Code: CodeAlreadyExists, Message: "subscription already exists"}
 	ErrInternalServer       = ErrorResponse{Code: CodeInternalError, Message: "internal server error"}
+	ErrUnauthorized         = ErrorResponse{Code: CodeUnauthorized, Message: "missing or invalid token"}
+	ErrCalendarFeedNotFound = ErrorResponse{Code: CodeNotFound, Message: "calendar feed not found"}
+	ErrInvalidTransition    = ErrorResponse{Code: CodeInvalidTransition, Message: "subscription cannot move to this status"}
+	ErrInvalidStatus        = ErrorResponse{Code: CodeInvalidStatus, Message: "invalid subscription status"}
+	ErrConflict             = ErrorResponse{Code: CodeConflict, Message: "subscription was modified concurrently, retry the request"}
+	ErrInvalidDiscount      = ErrorResponse{Code: CodeInvalidDiscount, Message: "invalid discount"}
+	ErrInvalidPromoCode     = ErrorResponse{Code: CodeInvalidPromoCode, Message: "promo code does not exist or has expired"}
+	ErrInvalidTrial         = ErrorResponse{Code: CodeInvalidTrial, Message: "trial must end after start date"}
+	ErrPromoCodeExists      = ErrorResponse{Code: CodeAlreadyExists, Message: "promo code already exists"}
+	ErrBudgetNotFound       = ErrorResponse{Code: CodeNotFound, Message: "budget not found"}
+	ErrBudgetExists         = ErrorResponse{Code: CodeAlreadyExists, Message: "budget for this user and service already exists"}
+	ErrInvalidWebhook       = ErrorResponse{Code: CodeInvalidWebhook, Message: "invalid webhook endpoint"}
+	ErrWebhookNotFound      = ErrorResponse{Code: CodeNotFound, Message: "webhook endpoint not found"}
+	ErrDeliveryNotFound     = ErrorResponse{Code: CodeNotFound, Message: "dead delivery not found"}
+	ErrInvalidPreferences   = ErrorResponse{Code: CodeInvalidPreferences, Message: "invalid notification preferences"}
+	ErrPreferencesNotFound  = ErrorResponse{Code: CodeNotFound, Message: "notification preferences not found"}
+	ErrJobNotFound          = ErrorResponse{Code: CodeNotFound, Message: "job not found"}
+	ErrJobRunning           = ErrorResponse{Code: CodeJobRunning, Message: "job is already running"}
+	ErrInvalidCursor        = ErrorResponse{Code: CodeInvalidCursor, Message: "invalid cursor"}
+	ErrCursorSort           = ErrorResponse{Code: CodeInvalidCursor, Message: "cursor pagination supports only the default sort"}
+	ErrInvalidPriceRange    = ErrorResponse{Code: CodeInvalidPrice, Message: "min_price must not exceed max_price"}
+	ErrBatchAborted         = ErrorResponse{Code: CodeBatchAborted, Message: "not applied because another item of the batch failed"}
+	ErrImportNotFound       = ErrorResponse{Code: CodeNotFound, Message: "import not found"}
+	ErrImportTooLarge       = ErrorResponse{Code: CodeInvalidImport, Message: "import file is too large"}
+	ErrInvalidImportDate    = ErrorResponse{Code: CodeInvalidDateFormat, Message: "invalid date format, use MM-YYYY, YYYY-MM or YYYY-MM-DD"}
+	ErrMetadataFilter       = ErrorResponse{Code: CodeBadRequest, Message: "invalid metadata filter, use key or key:value"}
 )
 
 type ValidationError struct {
@@ -81,6 +125,32 @@ func HTTPError(err error) *echo.HTTPError {
 		return echo.NewHTTPError(http.StatusNotFound, ErrSubscriptionNotFound)
 	case errors.Is(err, repoerrs.ErrAlreadyExists):
 		return echo.NewHTTPError(http.StatusConflict, ErrSubscriptionExists)
+	case errors.Is(err, repoerrs.ErrOverlap):
+		return echo.NewHTTPError(http.StatusConflict, overlapResponse(err))
+	case errors.Is(err, repoerrs.ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, ErrConflict)
+	case errors.Is(err, service.ErrInvalidTransition):
+		return echo.NewHTTPError(http.StatusConflict, ErrInvalidTransition)
+	case errors.Is(err, service.ErrInvalidStatus):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidStatus)
+	case errors.Is(err, service.ErrInvalidDiscount):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidDiscount)
+	case errors.Is(err, service.ErrInvalidPromoCode):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidPromoCode)
+	case errors.Is(err, service.ErrInvalidTrial):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidTrial)
+	case errors.Is(err, service.ErrInvalidWebhook):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidWebhook)
+	case errors.Is(err, service.ErrInvalidPreferences):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidPreferences)
+	case errors.Is(err, service.ErrJobNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, ErrJobNotFound)
+	case errors.Is(err, service.ErrJobRunning):
+		return echo.NewHTTPError(http.StatusConflict, ErrJobRunning)
+	case errors.Is(err, service.ErrInvalidPeriod):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, ErrInvalidDateRange)
+	case errors.Is(err, service.ErrBatchAborted):
+		return echo.NewHTTPError(http.StatusFailedDependency, ErrBatchAborted)
 
 	case errors.As(err, new(*validator.ValidationErrors)):
 		return handleValidationError(err)
@@ -94,6 +164,18 @@ func HTTPError(err error) *echo.HTTPError {
 	}
 }
 
+// overlapResponse names the subscription an overlapping one conflicts with,
+// when it is known.
+func overlapResponse(err error) ErrorResponse {
+	resp := ErrorResponse{Code: CodeOverlap, Message: "subscription overlaps another subscription of the same service"}
+	var overlapErr *repoerrs.OverlapError
+	if errors.As(err, &overlapErr) && overlapErr.SubscriptionID != uuid.Nil {
+		resp.Message = fmt.Sprintf("subscription overlaps subscription %s of the same service", overlapErr.SubscriptionID)
+		resp.ConflictingID = &overlapErr.SubscriptionID
+	}
+	return resp
+}
+
 func handleValidationError(err error) *echo.HTTPError {
 	var ve validator.ValidationErrors
 	if !errors.As(err, &ve) {
@@ -0,0 +1,425 @@
+package v1
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+
+	// exportFlushEvery is how many rows are buffered before they are pushed to the client.
+	exportFlushEvery = 100
+)
+
+var (
+	subscriptionExportHeader = []string{
+		"id", "user_id", "service_id", "service_name", "price", "status", "start_date", "end_date", "trial_end",
+		"discount_type", "discount_value", "discount_months", "promo_code", "auto_renew", "notes", "metadata", "created_at",
+	}
+	costExportHeader = []string{"month", "user_id", "service_name", "cost", "net_cost"}
+)
+
+type ExportController struct {
+	baseController
+	service service.ExportService
+}
+
+func NewExportController(s service.ExportService, logger *log.Logger) *ExportController {
+	return &ExportController{baseController: newBaseController(logger), service: s}
+}
+
+// negotiateExportFormat prefers the explicit format parameter and falls back
+// to the Accept header. CSV is the default.
+func negotiateExportFormat(ctx echo.Context, format string) string {
+	if format != "" {
+		return format
+	}
+	accept := ctx.Request().Header.Get(echo.HeaderAccept)
+	if strings.Contains(accept, mimeNDJSON) || strings.Contains(accept, "application/ndjson") {
+		return exportFormatNDJSON
+	}
+	return exportFormatCSV
+}
+
+// exportWriter writes rows as CSV records or NDJSON lines. The response is
+// committed on the first row, so an error before that can still be reported
+// with a proper status code.
+type exportWriter struct {
+	ctx      echo.Context
+	format   string
+	filename string
+	header   []string
+	csv      *csv.Writer
+	json     *json.Encoder
+	rows     int
+}
+
+func newExportWriter(ctx echo.Context, format, filename string, header []string) *exportWriter {
+	return &exportWriter{ctx: ctx, format: format, filename: filename, header: header}
+}
+
+func (w *exportWriter) started() bool {
+	return w.csv != nil || w.json != nil
+}
+
+func (w *exportWriter) start() error {
+	resp := w.ctx.Response()
+
+	// Exports may take longer than the server write timeout.
+	_ = http.NewResponseController(resp).SetWriteDeadline(time.Time{})
+
+	if w.format == exportFormatNDJSON {
+		resp.Header().Set(echo.HeaderContentType, mimeNDJSON)
+		resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", w.filename+".ndjson"))
+		resp.WriteHeader(http.StatusOK)
+		w.json = json.NewEncoder(resp)
+		return nil
+	}
+
+	resp.Header().Set(echo.HeaderContentType, mimeCSV+"; charset=utf-8")
+	resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", w.filename+".csv"))
+	resp.WriteHeader(http.StatusOK)
+	w.csv = csv.NewWriter(resp)
+	return w.csv.Write(w.header)
+}
+
+func (w *exportWriter) write(record []string, item any) error {
+	if !w.started() {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if w.json != nil {
+		err = w.json.Encode(item)
+	} else {
+		err = w.csv.Write(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%exportFlushEvery == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	w.ctx.Response().Flush()
+	return nil
+}
+
+// close finishes the export, writing the header of an empty one.
+func (w *exportWriter) close() error {
+	if !w.started() {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+func optionalDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+func subscriptionRecord(sub entity.Subscription) []string {
+	var discountType, discountValue, discountMonths, promoCode string
+	if d := sub.Discount; d != nil {
+		discountType, discountValue = string(d.Type), strconv.Itoa(d.Value)
+		if d.Months != nil {
+			discountMonths = strconv.Itoa(*d.Months)
+		}
+		if d.PromoCode != nil {
+			promoCode = *d.PromoCode
+		}
+	}
+	metadata := ""
+	if len(sub.Metadata) > 0 {
+		// A map of strings always marshals.
+		raw, _ := json.Marshal(sub.Metadata)
+		metadata = string(raw)
+	}
+	return []string{
+		sub.ID.String(),
+		sub.UserID.String(),
+		sub.Service.ID.String(),
+		sub.Service.Name,
+		strconv.Itoa(sub.Service.Price),
+		string(sub.Status),
+		sub.StartDate.Format(time.DateOnly),
+		optionalDate(sub.EndDate),
+		optionalDate(sub.TrialEnd),
+		discountType,
+		discountValue,
+		discountMonths,
+		promoCode,
+		strconv.FormatBool(sub.AutoRenew),
+		sub.Notes,
+		metadata,
+		sub.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func costRecord(item entity.CostBreakdownItem) []string {
+	return []string{
+		item.Month.Format(monthLayout),
+		item.UserID.String(),
+		item.ServiceName,
+		strconv.Itoa(item.Cost),
+		strconv.Itoa(item.NetCost),
+	}
+}
+
+// exportSubscriptions streams subscriptions of userID, or of everyone when it is nil.
+func (c *ExportController) exportSubscriptions(ctx echo.Context, userID *uuid.UUID, format string) error {
+	w := newExportWriter(ctx, negotiateExportFormat(ctx, format), "subscriptions", subscriptionExportHeader)
+
+	err := c.service.ExportSubscriptions(ctx.Request().Context(), userID, func(sub entity.Subscription) error {
+		return w.write(subscriptionRecord(sub), sub)
+	})
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		c.logError("export subscriptions", err, log.Fields{
+			"rows": w.rows,
+		})
+		if w.started() {
+			// The status line is already sent; the client sees a truncated body.
+			return nil
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("export subscriptions", log.Fields{
+		"rows": w.rows,
+	})
+	return nil
+}
+
+// Subscriptions godoc
+// @Summary Выгрузка подписок пользователя
+// @Description Потоково выгружает все подписки пользователя в CSV или NDJSON. Формат задается параметром format или заголовком Accept
+// @Tags Export
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param user_id query string true "ID пользователя"
+// @Param format query string false "Формат: csv (по умолчанию) или ndjson"
+// @Success 200
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/export/subscriptions [get]
+func (c *ExportController) Subscriptions(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := ExportSubscriptionsRequest{
+		UserID: ctx.QueryParam("user_id"),
+		Format: ctx.QueryParam("format"),
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	return c.exportSubscriptions(ctx, &userID, req.Format)
+}
+
+// AllSubscriptions godoc
+// @Summary Выгрузка подписок всех пользователей
+// @Description Потоково выгружает все подписки в CSV или NDJSON. Требует административный токен
+// @Tags Admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security AdminToken
+// @Param format query string false "Формат: csv (по умолчанию) или ndjson"
+// @Success 200
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/export/subscriptions [get]
+func (c *ExportController) AllSubscriptions(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := ExportSubscriptionsRequest{
+		Format: ctx.QueryParam("format"),
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	return c.exportSubscriptions(ctx, nil, req.Format)
+}
+
+// exportTotalCost streams the cost breakdown of userID, or of everyone when it is nil.
+func (c *ExportController) exportTotalCost(ctx echo.Context, userID *uuid.UUID, req ExportTotalCostRequest) error {
+	startDate, endDate, errResp := parseMonthRange(req.StartDate, req.EndDate)
+	if errResp != nil {
+		c.logError("parse period", nil, log.Fields{
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
+		})
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	var serviceName *string
+	if req.ServiceName != "" {
+		serviceName = &req.ServiceName
+	}
+
+	w := newExportWriter(ctx, negotiateExportFormat(ctx, req.Format), "total-cost", costExportHeader)
+
+	err := c.service.ExportCostBreakdown(ctx.Request().Context(), userID, serviceName, startDate, endDate, func(item entity.CostBreakdownItem) error {
+		return w.write(costRecord(item), item)
+	})
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		c.logError("export total cost", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+			"service_name": serviceName,
+			"rows":         w.rows,
+		})
+		if w.started() {
+			return nil
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("export total cost", log.Fields{
+		"user_id_hash": hashString(req.UserID),
+		"service_name": serviceName,
+		"rows":         w.rows,
+	})
+	return nil
+}
+
+func exportTotalCostRequest(ctx echo.Context) ExportTotalCostRequest {
+	return ExportTotalCostRequest{
+		CalculateTotalCostRequest: CalculateTotalCostRequest{
+			UserID:      ctx.QueryParam("user_id"),
+			ServiceName: ctx.QueryParam("service_name"),
+			StartDate:   ctx.QueryParam("start_date"),
+			EndDate:     ctx.QueryParam("end_date"),
+		},
+		Format: ctx.QueryParam("format"),
+	}
+}
+
+// TotalCost godoc
+// @Summary Выгрузка расчета стоимости пользователя
+// @Description Потоково выгружает стоимость подписок пользователя за период по месяцам. Как и в /subscriptions/total-cost, месяц оплачивается один раз самой ранней активной подпиской, поэтому сумма строк равна общей стоимости
+// @Tags Export
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param user_id query string true "ID пользователя"
+// @Param service_name query string false "Название сервиса"
+// @Param start_date query string true "Начало периода (MM-YYYY)"
+// @Param end_date query string true "Конец периода (MM-YYYY)"
+// @Param format query string false "Формат: csv (по умолчанию) или ndjson"
+// @Success 200
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/export/total-cost [get]
+func (c *ExportController) TotalCost(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := exportTotalCostRequest(ctx)
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	return c.exportTotalCost(ctx, &userID, req)
+}
+
+// AllTotalCost godoc
+// @Summary Выгрузка расчета стоимости всех пользователей
+// @Description Потоково выгружает стоимость подписок за период по месяцам. Как и в /subscriptions/total-cost, месяц оплачивается один раз самой ранней активной подпиской, поэтому сумма строк равна общей стоимости. Требует административный токен
+// @Tags Admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security AdminToken
+// @Param user_id query string false "ID пользователя"
+// @Param service_name query string false "Название сервиса"
+// @Param start_date query string true "Начало периода (MM-YYYY)"
+// @Param end_date query string true "Конец периода (MM-YYYY)"
+// @Param format query string false "Формат: csv (по умолчанию) или ndjson"
+// @Success 200
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/export/total-cost [get]
+func (c *ExportController) AllTotalCost(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := exportTotalCostRequest(ctx)
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	var userID *uuid.UUID
+	if req.UserID != "" {
+		parsedUUID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			c.logError("parse user ID", err, log.Fields{
+				"user_id_hash": hashString(req.UserID),
+			})
+			return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+		}
+		userID = &parsedUUID
+	}
+
+	return c.exportTotalCost(ctx, userID, req)
+}
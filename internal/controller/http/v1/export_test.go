@@ -0,0 +1,131 @@
+package v1
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/validator"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// fixedExport streams the same subscriptions to every caller.
+type fixedExport struct {
+	service.ExportService
+	subs []entity.Subscription
+}
+
+func (f fixedExport) ExportSubscriptions(_ context.Context, _ *uuid.UUID, fn func(entity.Subscription) error) error {
+	for _, sub := range f.subs {
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newExportServer(subs ...entity.Subscription) *echo.Echo {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+	SetupExportRoutes(e.Group("/api/v1"), fixedExport{subs: subs}, logger)
+	return e
+}
+
+func TestExportSubscriptionsColumns(t *testing.T) {
+	months, code := 3, "WELCOME"
+	trialEnd := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	sub := entity.Subscription{
+		ID:        uuid.New(),
+		Service:   entity.Service{ID: uuid.New(), Name: "Netflix", Price: 799},
+		UserID:    uuid.New(),
+		Status:    entity.StatusTrial,
+		StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		TrialEnd:  &trialEnd,
+		Discount:  &entity.Discount{Type: entity.DiscountPercent, Value: 20, Months: &months, PromoCode: &code},
+		AutoRenew: true,
+		Notes:     "family plan, shared",
+		Metadata:  map[string]string{"order_id": "A-17"},
+		CreatedAt: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	e := newExportServer(sub)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export/subscriptions?user_id="+sub.UserID.String(), nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want a header and one row", len(records))
+	}
+	got := make(map[string]string)
+	for i, column := range records[0] {
+		got[column] = records[1][i]
+	}
+	want := map[string]string{
+		"id":              sub.ID.String(),
+		"user_id":         sub.UserID.String(),
+		"service_id":      sub.Service.ID.String(),
+		"service_name":    "Netflix",
+		"price":           "799",
+		"status":          "trial",
+		"start_date":      "2025-01-01",
+		"end_date":        "",
+		"trial_end":       "2025-02-01",
+		"discount_type":   "percent",
+		"discount_value":  "20",
+		"discount_months": "3",
+		"promo_code":      "WELCOME",
+		"auto_renew":      "true",
+		"notes":           "family plan, shared",
+		"metadata":        `{"order_id":"A-17"}`,
+		"created_at":      "2025-01-01T12:00:00Z",
+	}
+	if len(got) != len(want) {
+		t.Errorf("columns %v, want %d columns", records[0], len(want))
+	}
+	for column, value := range want {
+		if got[column] != value {
+			t.Errorf("column %s = %q, want %q", column, got[column], value)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/export/subscriptions?format=ndjson&user_id="+sub.UserID.String(), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var decoded entity.Subscription
+	if err := json.NewDecoder(rec.Body).Decode(&decoded); err != nil {
+		t.Fatalf("decode ndjson: %v", err)
+	}
+	if decoded.Status != sub.Status || decoded.Discount == nil || decoded.Notes != sub.Notes || decoded.Metadata["order_id"] != "A-17" {
+		t.Errorf("ndjson row %+v does not carry the subscription fields", decoded)
+	}
+}
+
+func TestExportTotalCostRequiresUser(t *testing.T) {
+	e := newExportServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export/total-cost?start_date=01-2025&end_date=06-2025", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("export of all users on the public route: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,302 @@
+package v1
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxImportRows = 10000
+	maxImportSize = 10 << 20
+)
+
+var (
+	importRequiredColumns = []string{"service_name", "price", "user_id", "start_date"}
+	// importDateLayouts are the accepted date formats; dates are truncated to
+	// the month.
+	importDateLayouts = []string{monthLayout, "2006-01", dayLayout}
+)
+
+type ImportController struct {
+	baseController
+	service service.ImportService
+}
+
+func NewImportController(s service.ImportService, logger *log.Logger) *ImportController {
+	return &ImportController{baseController: newBaseController(logger), service: s}
+}
+
+// importHTTPError maps import-specific repository errors before falling back
+// to HTTPError, whose messages are about subscriptions.
+func importHTTPError(err error) *echo.HTTPError {
+	if errors.Is(err, repoerrs.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, ErrImportNotFound)
+	}
+	return HTTPError(err)
+}
+
+// Import godoc
+// @Summary Импорт подписок из CSV
+// @Description Импортирует до 10000 подписок из CSV с колонками service_name, price, user_id, start_date и необязательной end_date. Даты в формате MM-YYYY, YYYY-MM или YYYY-MM-DD, прочие колонки игнорируются, так что подходит файл выгрузки. Строки проверяются так же, как при создании подписки; некорректные пропускаются и попадают в отчет. С dry_run=true возвращается только отчет, иначе импорт выполняется в фоне, а его ход доступен по ссылке из заголовка Location
+// @Tags Subscriptions
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file false "CSV-файл, если тело запроса — multipart/form-data"
+// @Param dry_run query bool false "Только проверить файл"
+// @Success 200 {object} ImportReportResponse
+// @Success 202 {object} entity.Import
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/imports [post]
+func (c *ImportController) Import(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	dryRun := false
+	if raw := ctx.QueryParam("dry_run"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			c.logError("parse dry_run", err, log.Fields{
+				"dry_run": raw,
+			})
+			return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+		}
+	}
+
+	file, err := importFile(ctx)
+	if err != nil {
+		c.logError("open import file", err, nil)
+		return importFileError(err)
+	}
+	defer file.Close()
+
+	rows, err := c.readImport(ctx, file)
+	if err != nil {
+		c.logError("read import file", err, nil)
+		return importFileError(err)
+	}
+
+	if dryRun {
+		report := c.service.CheckImport(ctx.Request().Context(), rows)
+		c.logSuccess("check import", log.Fields{
+			"rows":   report.TotalRows,
+			"failed": report.FailedRows,
+		})
+		return ctx.JSON(http.StatusOK, ImportReportResponse{
+			TotalRows:  report.TotalRows,
+			ValidRows:  report.ValidRows,
+			FailedRows: report.FailedRows,
+			Errors:     report.Errors,
+		})
+	}
+
+	imp, err := c.service.StartImport(ctx.Request().Context(), rows)
+	if err != nil {
+		c.logError("start import", err, log.Fields{
+			"rows": len(rows),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("start import", log.Fields{
+		"import_id": imp.ID,
+		"rows":      imp.TotalRows,
+		"failed":    imp.FailedRows,
+	})
+	ctx.Response().Header().Set(echo.HeaderLocation, "/api/v1/subscriptions/imports/"+imp.ID.String())
+	return ctx.JSON(http.StatusAccepted, imp)
+}
+
+// GetImport godoc
+// @Summary Ход импорта подписок
+// @Description Возвращает статус импорта, число обработанных, импортированных и пропущенных строк и ошибки по строкам
+// @Tags Subscriptions
+// @Produce json
+// @Param id path string true "ID импорта"
+// @Success 200 {object} entity.Import
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/imports/{id} [get]
+func (c *ImportController) GetImport(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse import ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	imp, err := c.service.GetImport(ctx.Request().Context(), id)
+	if err != nil {
+		c.logError("get import", err, log.Fields{
+			"import_id": id,
+		})
+		return importHTTPError(err)
+	}
+
+	c.logSuccess("get import", log.Fields{
+		"import_id": id,
+		"status":    imp.Status,
+	})
+	return ctx.JSON(http.StatusOK, imp)
+}
+
+// importFile returns the uploaded file: the "file" part of a multipart form
+// or else the request body.
+func importFile(ctx echo.Context) (io.ReadCloser, error) {
+	req := ctx.Request()
+	req.Body = http.MaxBytesReader(ctx.Response(), req.Body, maxImportSize)
+	if !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return req.Body, nil
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return header.Open()
+}
+
+// importFileError is the response for a file that cannot be imported at all.
+func importFileError(err error) *echo.HTTPError {
+	if errors.As(err, new(*http.MaxBytesError)) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, ErrImportTooLarge)
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, ErrorResponse{Code: CodeInvalidImport, Message: err.Error()})
+}
+
+// readImport parses the CSV into rows. A row that does not make a valid
+// CreateRequest gets the message of the response Create would give for it.
+func (c *ImportController) readImport(ctx echo.Context, file io.Reader) ([]entity.ImportRow, error) {
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty file")
+		}
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range importRequiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+	}
+
+	var rows []entity.ImportRow
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("more than %d rows", maxImportRows)
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		line, _ := r.FieldPos(0)
+		row := entity.ImportRow{Line: line}
+		sub, errResp := c.importRow(ctx, field)
+		if errResp != nil {
+			row.Error = errResp.Message
+		} else {
+			row.Subscription = sub
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no rows")
+	}
+	return rows, nil
+}
+
+// importRow builds the subscription of a row through CreateRequest, so that
+// a row is held to the rules of Create.
+func (c *ImportController) importRow(ctx echo.Context, field func(name string) string) (entity.Subscription, *ErrorResponse) {
+	startDate := field("start_date")
+	if startDate != "" {
+		month, ok := parseImportDate(startDate)
+		if !ok {
+			return entity.Subscription{}, &ErrInvalidImportDate
+		}
+		startDate = month.Format(monthLayout)
+	}
+
+	price := 0
+	if raw := field("price"); raw != "" {
+		var err error
+		if price, err = strconv.Atoi(raw); err != nil {
+			return entity.Subscription{}, &ErrInvalidPrice
+		}
+	}
+
+	req := CreateRequest{
+		Service: CreateServiceRequest{
+			Name:  field("service_name"),
+			Price: price,
+		},
+		UserID:    field("user_id"),
+		StartDate: startDate,
+	}
+	if err := ctx.Validate(req); err != nil {
+		resp := ValidationErrorResponse(err)
+		return entity.Subscription{}, &resp
+	}
+	sub, errResp := c.subscriptionFromCreate(req)
+	if errResp != nil {
+		return entity.Subscription{}, errResp
+	}
+
+	if raw := field("end_date"); raw != "" {
+		endDate, ok := parseImportDate(raw)
+		if !ok {
+			return entity.Subscription{}, &ErrInvalidImportDate
+		}
+		sub.EndDate = &endDate
+	}
+	return sub, nil
+}
+
+func parseImportDate(raw string) (time.Time, bool) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type JobController struct {
+	baseController
+	service service.JobService
+}
+
+func NewJobController(s service.JobService, logger *log.Logger) *JobController {
+	return &JobController{baseController: newBaseController(logger), service: s}
+}
+
+// List godoc
+// @Summary Фоновые задачи
+// @Description Возвращает фоновые задачи с расписанием cron (UTC), временем следующего запуска и последним запуском
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} JobsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/jobs [get]
+func (c *JobController) List(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	jobs, err := c.service.ListJobs(ctx.Request().Context())
+	if err != nil {
+		c.logError("list jobs", err, nil)
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list jobs", log.Fields{
+		"count": len(jobs),
+	})
+	return ctx.JSON(http.StatusOK, JobsResponse{Items: jobs})
+}
+
+// Runs godoc
+// @Summary История запусков задачи
+// @Description Возвращает запуски задачи, начиная с последних: кто запустил, на каком экземпляре, результат и ошибку
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Имя задачи"
+// @Param limit query int false "Количество записей (по умолчанию 10, максимум 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} JobRunsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/jobs/{name}/runs [get]
+func (c *JobController) Runs(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	name := ctx.Param("name")
+	limit, offset := parseLimitOffset(ctx)
+
+	runs, err := c.service.ListRuns(ctx.Request().Context(), name, offset, limit)
+	if err != nil {
+		c.logError("list job runs", err, log.Fields{
+			"job": name,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list job runs", log.Fields{
+		"job":   name,
+		"count": len(runs),
+	})
+	if runs == nil {
+		runs = []entity.JobRun{}
+	}
+	return ctx.JSON(http.StatusOK, JobRunsResponse{
+		Items:  runs,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// Trigger godoc
+// @Summary Запустить задачу
+// @Description Запускает задачу вне расписания в фоне и возвращает запись о запуске. Задача выполняется не более чем на одном экземпляре сервиса одновременно
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Имя задачи"
+// @Success 202 {object} entity.JobRun
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/jobs/{name}/trigger [post]
+func (c *JobController) Trigger(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	name := ctx.Param("name")
+
+	run, err := c.service.TriggerJob(ctx.Request().Context(), name)
+	if err != nil {
+		c.logError("trigger job", err, log.Fields{
+			"job": name,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("trigger job", log.Fields{
+		"job":    name,
+		"run_id": run.ID,
+	})
+	return ctx.JSON(http.StatusAccepted, run)
+}
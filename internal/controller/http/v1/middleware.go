@@ -0,0 +1,22 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// adminAuth accepts requests carrying "Authorization: Bearer <token>". With an
+// empty token every request is rejected, so admin routes are never left open.
+func adminAuth(token string) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		Validator: func(key string, _ echo.Context) (bool, error) {
+			return token != "" && subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1, nil
+		},
+		ErrorHandler: func(_ error, c echo.Context) error {
+			return c.JSON(http.StatusUnauthorized, ErrUnauthorized)
+		},
+	})
+}
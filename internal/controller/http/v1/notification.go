@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type NotificationController struct {
+	baseController
+	service service.NotificationService
+}
+
+func NewNotificationController(s service.NotificationService, logger *log.Logger) *NotificationController {
+	return &NotificationController{baseController: newBaseController(logger), service: s}
+}
+
+// GetPreferences godoc
+// @Summary Настройки напоминаний
+// @Description Возвращает настройки email-напоминаний пользователя о списаниях и окончании пробного периода
+// @Tags Notifications
+// @Produce json
+// @Param user_id query string true "ID пользователя"
+// @Success 200 {object} entity.NotificationPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/notifications/preferences [get]
+func (c *NotificationController) GetPreferences(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDQuery(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	prefs, err := c.service.GetPreferences(ctx.Request().Context(), userID)
+	if err != nil {
+		c.logError("get notification preferences", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, ErrPreferencesNotFound)
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("get notification preferences", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+	})
+	return ctx.JSON(http.StatusOK, prefs)
+}
+
+// SavePreferences godoc
+// @Summary Сохранить настройки напоминаний
+// @Description Создает или заменяет настройки email-напоминаний пользователя. Напоминание приходит за days_before дней до списания (по умолчанию 3) один раз на каждое списание
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param request body NotificationPreferencesRequest true "Настройки"
+// @Success 200 {object} entity.NotificationPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/notifications/preferences [put]
+func (c *NotificationController) SavePreferences(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req NotificationPreferencesRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	prefs := entity.NotificationPreferences{
+		UserID:           userID,
+		Email:            req.Email,
+		Locale:           entity.Locale(req.Locale),
+		RenewalReminders: true,
+		TrialReminders:   true,
+		DaysBefore:       req.DaysBefore,
+	}
+	if req.RenewalReminders != nil {
+		prefs.RenewalReminders = *req.RenewalReminders
+	}
+	if req.TrialReminders != nil {
+		prefs.TrialReminders = *req.TrialReminders
+	}
+
+	saved, err := c.service.SavePreferences(ctx.Request().Context(), prefs)
+	if err != nil {
+		c.logError("save notification preferences", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("save notification preferences", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+	})
+	return ctx.JSON(http.StatusOK, saved)
+}
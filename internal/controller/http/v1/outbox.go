@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type OutboxController struct {
+	baseController
+	service service.OutboxService
+}
+
+func NewOutboxController(s service.OutboxService, logger *log.Logger) *OutboxController {
+	return &OutboxController{baseController: newBaseController(logger), service: s}
+}
+
+// ListDead godoc
+// @Summary Неотправленные события outbox
+// @Description Возвращает события, исчерпавшие попытки отправки, начиная с последних, с последней ошибкой. Пока событие не возвращено в очередь, следующие события его подписки не отправляются
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param limit query int false "Количество записей (по умолчанию 10, максимум 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} DeadOutboxEventsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/outbox/dead [get]
+func (c *OutboxController) ListDead(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	limit, offset := parseLimitOffset(ctx)
+
+	events, err := c.service.ListDead(ctx.Request().Context(), limit, offset)
+	if err != nil {
+		c.logError("list dead outbox events", err, nil)
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list dead outbox events", log.Fields{
+		"count": len(events),
+	})
+	if events == nil {
+		events = []entity.DeadOutboxEvent{}
+	}
+	return ctx.JSON(http.StatusOK, DeadOutboxEventsResponse{
+		Items:  events,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// RequeueDead godoc
+// @Summary Вернуть события outbox в очередь
+// @Description Сбрасывает счетчик попыток неотправленных событий и отправляет их заново. Без списка ids возвращает в очередь все такие события
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param request body RequeueOutboxEventsRequest false "ID событий"
+// @Success 200 {object} RequeueOutboxEventsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/outbox/dead/requeue [post]
+func (c *OutboxController) RequeueDead(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req RequeueOutboxEventsRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	ids := make([]uuid.UUID, len(req.IDs))
+	for i, raw := range req.IDs {
+		// Validated as UUIDs above.
+		ids[i] = uuid.MustParse(raw)
+	}
+
+	requeued, err := c.service.RequeueDead(ctx.Request().Context(), ids)
+	if err != nil {
+		c.logError("requeue dead outbox events", err, nil)
+		return HTTPError(err)
+	}
+
+	c.logSuccess("requeue dead outbox events", log.Fields{
+		"requeued": requeued,
+	})
+	return ctx.JSON(http.StatusOK, RequeueOutboxEventsResponse{Requeued: requeued})
+}
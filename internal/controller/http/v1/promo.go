@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type PromoCodeController struct {
+	baseController
+	service service.PromoCodeService
+}
+
+func NewPromoCodeController(s service.PromoCodeService, logger *log.Logger) *PromoCodeController {
+	return &PromoCodeController{baseController: newBaseController(logger), service: s}
+}
+
+// Create godoc
+// @Summary Создать промокод
+// @Description Создает промокод со скидкой в процентах или фиксированной суммой на N месяцев либо бессрочно
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param request body CreatePromoCodeRequest true "Данные промокода"
+// @Success 201 {object} entity.PromoCode
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/promo-codes [post]
+func (c *PromoCodeController) Create(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req CreatePromoCodeRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	promo := entity.PromoCode{
+		Code:   req.Code,
+		Type:   entity.DiscountType(req.Type),
+		Value:  req.Value,
+		Months: req.Months,
+	}
+	if req.ValidUntil != "" {
+		validUntil, err := time.Parse(time.DateOnly, req.ValidUntil)
+		if err != nil {
+			c.logError("parse valid until", err, log.Fields{
+				"valid_until": req.ValidUntil,
+			})
+			return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+		}
+		promo.ValidUntil = &validUntil
+	}
+
+	created, err := c.service.CreatePromoCode(ctx.Request().Context(), promo)
+	if err != nil {
+		c.logError("create promo code", err, log.Fields{
+			"code": req.Code,
+		})
+		if errors.Is(err, repoerrs.ErrAlreadyExists) {
+			return ctx.JSON(http.StatusConflict, ErrPromoCodeExists)
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("create promo code", log.Fields{
+		"code": created.Code,
+	})
+	return ctx.JSON(http.StatusCreated, created)
+}
+
+// List godoc
+// @Summary Список промокодов
+// @Description Возвращает все промокоды, начиная с последних созданных
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} PromoCodesResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/promo-codes [get]
+func (c *PromoCodeController) List(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	promos, err := c.service.ListPromoCodes(ctx.Request().Context())
+	if err != nil {
+		c.logError("list promo codes", err, nil)
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list promo codes", log.Fields{
+		"count": len(promos),
+	})
+	if promos == nil {
+		promos = []entity.PromoCode{}
+	}
+	return ctx.JSON(http.StatusOK, PromoCodesResponse{Items: promos})
+}
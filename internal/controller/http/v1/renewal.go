@@ -0,0 +1,195 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/ical"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultUpcomingDays = 7
+	mimeCalendar        = "text/calendar"
+)
+
+type RenewalController struct {
+	baseController
+	service service.RenewalService
+}
+
+func NewRenewalController(s service.RenewalService, logger *log.Logger) *RenewalController {
+	return &RenewalController{baseController: newBaseController(logger), service: s}
+}
+
+// Upcoming godoc
+// @Summary Ближайшие списания
+// @Description Возвращает даты ближайших списаний по активным подпискам пользователя на N дней вперед
+// @Tags Renewals
+// @Produce json
+// @Param user_id query string true "ID пользователя"
+// @Param days query int false "Количество дней (по умолчанию 7, максимум 365)"
+// @Success 200 {object} UpcomingRenewalsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/upcoming [get]
+func (c *RenewalController) Upcoming(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	req := UpcomingRenewalsRequest{
+		UserID: ctx.QueryParam("user_id"),
+		Days:   defaultUpcomingDays,
+	}
+	if raw := ctx.QueryParam("days"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil {
+			c.logError("parse days", err, log.Fields{
+				"days": raw,
+			})
+			return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+		}
+		req.Days = days
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	renewals, err := c.service.ListUpcoming(ctx.Request().Context(), userID, req.Days)
+	if err != nil {
+		c.logError("list upcoming renewals", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+			"days":         req.Days,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list upcoming renewals", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+		"count":        len(renewals),
+	})
+	if renewals == nil {
+		renewals = []entity.Renewal{}
+	}
+	return ctx.JSON(http.StatusOK, UpcomingRenewalsResponse{
+		Items: renewals,
+		Days:  req.Days,
+	})
+}
+
+// IssueCalendarFeed godoc
+// @Summary Ссылка на календарь списаний
+// @Description Создает секретную ссылку на iCalendar-ленту списаний пользователя. Предыдущая ссылка перестает работать
+// @Tags Renewals
+// @Accept json
+// @Produce json
+// @Param request body CalendarFeedRequest true "Пользователь"
+// @Success 201 {object} CalendarFeedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/calendar-feed [post]
+func (c *RenewalController) IssueCalendarFeed(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req CalendarFeedRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	token, err := c.service.IssueCalendarToken(ctx.Request().Context(), userID)
+	if err != nil {
+		c.logError("issue calendar token", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("issue calendar token", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+	})
+	return ctx.JSON(http.StatusCreated, CalendarFeedResponse{
+		URL: fmt.Sprintf("%s://%s/api/v1/calendar/%s.ics", ctx.Scheme(), ctx.Request().Host, token),
+	})
+}
+
+// CalendarFeed godoc
+// @Summary iCalendar-лента списаний
+// @Description Возвращает календарь списаний пользователя на год вперед для подписки в календарных приложениях
+// @Tags Renewals
+// @Produce text/calendar
+// @Param token path string true "Секретный токен ленты"
+// @Success 200
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/calendar/{token}.ics [get]
+func (c *RenewalController) CalendarFeed(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, "/api/v1/calendar/:token")
+
+	token := strings.TrimSuffix(ctx.Param("token"), ".ics")
+
+	renewals, err := c.service.CalendarRenewals(ctx.Request().Context(), token)
+	if err != nil {
+		// The token is a credential, so it is never logged.
+		c.logError("get calendar renewals", err, nil)
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, ErrCalendarFeedNotFound)
+		}
+		return HTTPError(err)
+	}
+
+	cal := ical.Calendar{
+		ProdID: "-//subscription-service//renewals//RU",
+		Name:   "Списания по подпискам",
+	}
+	for _, r := range renewals {
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         fmt.Sprintf("%s-%s@subscription-service", r.SubscriptionID, r.ChargeDate.Format("20060102")),
+			Date:        r.ChargeDate,
+			Summary:     fmt.Sprintf("Списание: %s — %d", r.ServiceName, r.Price),
+			Description: fmt.Sprintf("Продление подписки %s", r.ServiceName),
+		})
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, mimeCalendar+"; charset=utf-8")
+	ctx.Response().WriteHeader(http.StatusOK)
+	if _, err := cal.WriteTo(ctx.Response()); err != nil {
+		c.logError("write calendar", err, nil)
+		return nil
+	}
+
+	c.logSuccess("get calendar renewals", log.Fields{
+		"count": len(renewals),
+	})
+	return nil
+}
@@ -2,9 +2,11 @@ package v1
 
 import (
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/DmitriyKolesnikM8O/subscription-service/config"
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
 
 	"github.com/labstack/echo/v4"
@@ -12,11 +14,15 @@ import (
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
-func NewRouter(handler *echo.Echo, services service.SubscriptionService, logger *log.Logger) {
+func NewRouter(handler *echo.Echo, services *service.Services, cfg *config.Config, logger *log.Logger) {
 
 	handler.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: `{"time":"${time_rfc3339_nano}", "method":"${method}","uri":"${uri}", "status":${status},"error":"${error}"}` + "\n",
 		Output: setLogsFile(),
+		// Calendar feed URLs carry a secret token and must not end up in the request log.
+		Skipper: func(c echo.Context) bool {
+			return strings.HasPrefix(c.Request().URL.Path, "/api/v1/calendar/")
+		},
 	}))
 	handler.Use(middleware.Recover())
 
@@ -27,7 +33,25 @@ func NewRouter(handler *echo.Echo, services service.SubscriptionService, logger
 
 	api := handler.Group("/api/v1")
 	{
-		SetupSubscriptionRoutes(api, services, logger)
+		SetupSubscriptionRoutes(api, services.Subscription, logger)
+		SetupExportRoutes(api, services.Export, logger)
+		SetupRenewalRoutes(api, services.Renewal, logger)
+		SetupBudgetRoutes(api, services.Budget, logger)
+		SetupWebhookRoutes(api, services.Webhook, logger)
+		SetupStreamRoutes(api, services.EventStream, logger)
+		SetupNotificationRoutes(api, services.Notification, logger)
+		SetupImportRoutes(api, services.Import, logger)
+	}
+
+	admin := api.Group("/admin", adminAuth(cfg.Admin.Token))
+	{
+		SetupAdminAnalyticsRoutes(admin, services.Analytics, logger)
+		SetupAdminExportRoutes(admin, services.Export, logger)
+		SetupAdminPromoCodeRoutes(admin, services.PromoCode, logger)
+		SetupAdminJobRoutes(admin, services.Job, logger)
+		SetupAdminOutboxRoutes(admin, services.Outbox, logger)
+		SetupAdminSubscriptionRoutes(admin, services.Subscription, logger)
+		SetupAdminUserDataRoutes(admin, services.UserData, logger)
 	}
 }
 
@@ -38,10 +62,124 @@ func SetupSubscriptionRoutes(group *echo.Group, subService service.SubscriptionS
 	group.GET("/subscriptions/:id", ctrl.GetByID)
 	group.PUT("/subscriptions/:id", ctrl.Update)
 	group.DELETE("/subscriptions/:id", ctrl.Delete)
+	group.POST("/subscriptions/:id/pause", ctrl.Pause)
+	group.POST("/subscriptions/:id/resume", ctrl.Resume)
+	group.POST("/subscriptions/:id/cancel", ctrl.Cancel)
 	group.GET("/subscriptions", ctrl.ListByUser)
+	group.GET("/subscriptions/search", ctrl.Search)
+	group.POST("/subscriptions/batch", ctrl.BatchCreate)
+	group.PUT("/subscriptions/batch", ctrl.BatchUpdate)
+	group.DELETE("/subscriptions/batch", ctrl.BatchDelete)
 	group.GET("/subscriptions/total-cost", ctrl.CalculateTotalCost)
 }
 
+func SetupAdminSubscriptionRoutes(group *echo.Group, subService service.SubscriptionService, logger *log.Logger) {
+	ctrl := NewSubscriptionController(subService, logger)
+
+	group.GET("/subscriptions", ctrl.AdminList)
+	group.GET("/subscriptions/search", ctrl.AdminSearch)
+}
+
+func SetupAdminUserDataRoutes(group *echo.Group, userDataService service.UserDataService, logger *log.Logger) {
+	ctrl := NewUserDataController(userDataService, logger)
+
+	group.GET("/users/:user_id/data", ctrl.Export)
+	group.DELETE("/users/:user_id/data", ctrl.Erase)
+}
+
+func SetupAdminAnalyticsRoutes(group *echo.Group, analyticsService service.AnalyticsService, logger *log.Logger) {
+	ctrl := NewAnalyticsController(analyticsService, logger)
+
+	group.GET("/analytics/mrr", ctrl.MRR)
+	group.GET("/analytics/retention", ctrl.Retention)
+	group.GET("/analytics/top-services", ctrl.TopServices)
+	group.GET("/analytics/top-users", ctrl.TopUsers)
+}
+
+func SetupExportRoutes(group *echo.Group, exportService service.ExportService, logger *log.Logger) {
+	ctrl := NewExportController(exportService, logger)
+
+	group.GET("/export/subscriptions", ctrl.Subscriptions)
+	group.GET("/export/total-cost", ctrl.TotalCost)
+}
+
+func SetupAdminExportRoutes(group *echo.Group, exportService service.ExportService, logger *log.Logger) {
+	ctrl := NewExportController(exportService, logger)
+
+	group.GET("/export/subscriptions", ctrl.AllSubscriptions)
+	group.GET("/export/total-cost", ctrl.AllTotalCost)
+}
+
+func SetupAdminOutboxRoutes(group *echo.Group, outboxService service.OutboxService, logger *log.Logger) {
+	ctrl := NewOutboxController(outboxService, logger)
+
+	group.GET("/outbox/dead", ctrl.ListDead)
+	group.POST("/outbox/dead/requeue", ctrl.RequeueDead)
+}
+
+func SetupAdminPromoCodeRoutes(group *echo.Group, promoService service.PromoCodeService, logger *log.Logger) {
+	ctrl := NewPromoCodeController(promoService, logger)
+
+	group.POST("/promo-codes", ctrl.Create)
+	group.GET("/promo-codes", ctrl.List)
+}
+
+func SetupAdminJobRoutes(group *echo.Group, jobService service.JobService, logger *log.Logger) {
+	ctrl := NewJobController(jobService, logger)
+
+	group.GET("/jobs", ctrl.List)
+	group.GET("/jobs/:name/runs", ctrl.Runs)
+	group.POST("/jobs/:name/trigger", ctrl.Trigger)
+}
+
+func SetupBudgetRoutes(group *echo.Group, budgetService service.BudgetService, logger *log.Logger) {
+	ctrl := NewBudgetController(budgetService, logger)
+
+	group.POST("/budgets", ctrl.Create)
+	group.GET("/budgets", ctrl.List)
+	group.GET("/budgets/alerts", ctrl.Alerts)
+	group.PUT("/budgets/:id", ctrl.Update)
+	group.DELETE("/budgets/:id", ctrl.Delete)
+}
+
+func SetupWebhookRoutes(group *echo.Group, webhookService service.WebhookService, logger *log.Logger) {
+	ctrl := NewWebhookController(webhookService, logger)
+
+	group.POST("/webhooks", ctrl.Create)
+	group.GET("/webhooks", ctrl.List)
+	group.DELETE("/webhooks/:id", ctrl.Delete)
+	group.GET("/webhooks/:id/deliveries", ctrl.Deliveries)
+	group.POST("/webhooks/:id/deliveries/:delivery_id/retry", ctrl.RetryDelivery)
+}
+
+func SetupStreamRoutes(group *echo.Group, streamService service.EventStreamService, logger *log.Logger) {
+	ctrl := NewStreamController(streamService, logger)
+
+	group.GET("/subscriptions/stream", ctrl.Stream)
+}
+
+func SetupNotificationRoutes(group *echo.Group, notificationService service.NotificationService, logger *log.Logger) {
+	ctrl := NewNotificationController(notificationService, logger)
+
+	group.GET("/notifications/preferences", ctrl.GetPreferences)
+	group.PUT("/notifications/preferences", ctrl.SavePreferences)
+}
+
+func SetupImportRoutes(group *echo.Group, importService service.ImportService, logger *log.Logger) {
+	ctrl := NewImportController(importService, logger)
+
+	group.POST("/subscriptions/imports", ctrl.Import)
+	group.GET("/subscriptions/imports/:id", ctrl.GetImport)
+}
+
+func SetupRenewalRoutes(group *echo.Group, renewalService service.RenewalService, logger *log.Logger) {
+	ctrl := NewRenewalController(renewalService, logger)
+
+	group.GET("/subscriptions/upcoming", ctrl.Upcoming)
+	group.POST("/subscriptions/calendar-feed", ctrl.IssueCalendarFeed)
+	group.GET("/calendar/:token", ctrl.CalendarFeed)
+}
+
 func setLogsFile() *os.File {
 	err := os.MkdirAll("logs", 0755)
 	if err != nil {
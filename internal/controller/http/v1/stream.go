@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	mimeEventStream = "text/event-stream"
+
+	// sseHeartbeatInterval keeps idle connections open through proxies that
+	// close silent ones.
+	sseHeartbeatInterval = 15 * time.Second
+	// sseRetry is the reconnection delay suggested to clients, in milliseconds.
+	sseRetry = 3000
+)
+
+type StreamController struct {
+	baseController
+	service service.EventStreamService
+}
+
+func NewStreamController(s service.EventStreamService, logger *log.Logger) *StreamController {
+	return &StreamController{baseController: newBaseController(logger), service: s}
+}
+
+// Stream godoc
+// @Summary Поток изменений подписок
+// @Description Server-Sent Events с событиями subscription.created, subscription.updated, subscription.deleted, subscription.expired и subscription.renewed пользователя.
+// @Description Каждые 15 секунд отправляется комментарий-heartbeat. При переподключении заголовок Last-Event-ID
+// @Description (или параметр last_event_id) возобновляет поток с события, следующего за указанным
+// @Tags Subscriptions
+// @Produce text/event-stream
+// @Param user_id query string true "ID пользователя"
+// @Param Last-Event-ID header string false "ID последнего полученного события"
+// @Param last_event_id query string false "ID последнего полученного события, если заголовок задать нельзя"
+// @Success 200 {object} entity.SubscriptionEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/stream [get]
+func (c *StreamController) Stream(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDQuery(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, *errResp)
+	}
+
+	var lastEventID *uuid.UUID
+	raw := ctx.Request().Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = ctx.QueryParam("last_event_id")
+	}
+	if raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.logError("parse last event ID", err, log.Fields{
+				"last_event_id": raw,
+			})
+			return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+		}
+		lastEventID = &id
+	}
+
+	reqCtx := ctx.Request().Context()
+	events, err := c.service.Subscribe(reqCtx, userID, lastEventID)
+	if err != nil {
+		c.logError("subscribe to events", err, log.Fields{
+			"user_id": userID,
+		})
+		return ctx.JSON(http.StatusInternalServerError, ErrInternalServer)
+	}
+
+	resp := ctx.Response()
+	// The stream stays open far longer than the server write timeout.
+	_ = http.NewResponseController(resp).SetWriteDeadline(time.Time{})
+	resp.Header().Set(echo.HeaderContentType, mimeEventStream)
+	resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+	resp.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Stops nginx from buffering the stream.
+	resp.Header().Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(resp, "retry: %d\n\n", sseRetry); err != nil {
+		return nil
+	}
+	resp.Flush()
+
+	c.logSuccess("open event stream", log.Fields{
+		"user_id": userID,
+	})
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	sent := 0
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				c.logSuccess("close event stream", log.Fields{
+					"user_id": userID,
+					"events":  sent,
+				})
+				return nil
+			}
+			if err := writeSSEEvent(resp, event); err != nil {
+				return nil
+			}
+			sent++
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(resp, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		case <-reqCtx.Done():
+			return nil
+		}
+		resp.Flush()
+	}
+}
+
+// writeSSEEvent writes the event with its outbox ID, so the client sends it
+// back as Last-Event-ID. The payload is JSON without raw newlines, so it fits
+// a single data line.
+func writeSSEEvent(resp *echo.Response, event entity.OutboxEvent) error {
+	_, err := fmt.Fprintf(resp, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+	return err
+}
@@ -1,10 +1,11 @@
 package v1
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
@@ -16,50 +17,17 @@ import (
 )
 
 type SubscriptionController struct {
+	baseController
 	service service.SubscriptionService
-	logger  *log.Logger
 }
 
 func NewSubscriptionController(s service.SubscriptionService, logger *log.Logger) *SubscriptionController {
-	if logger == nil {
-		logger = log.New()
-		logger.SetReportCaller(true)
-	}
-	return &SubscriptionController{service: s, logger: logger}
-}
-
-func (c *SubscriptionController) logRequest(method, path string) {
-	c.logger.WithFields(log.Fields{
-		"method": method,
-		"path":   path,
-		"time":   time.Now().UTC().Format(time.RFC3339),
-	}).Info("request started")
-}
-
-func (c *SubscriptionController) logSuccess(action string, fields log.Fields) {
-	if fields == nil {
-		fields = log.Fields{}
-	}
-	fields["time"] = time.Now().UTC().Format(time.RFC3339)
-	c.logger.WithFields(fields).Infof("%s completed successfully", action)
-}
-
-func (c *SubscriptionController) logError(action string, err error, fields log.Fields) {
-	if fields == nil {
-		fields = log.Fields{}
-	}
-	fields["error"] = err.Error()
-	fields["time"] = time.Now().UTC().Format(time.RFC3339)
-	c.logger.WithFields(fields).Errorf("failed to %s", action)
-}
-
-func hashString(s string) string {
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+	return &SubscriptionController{baseController: newBaseController(logger), service: s}
 }
 
 // Create godoc
 // @Summary Создать подписку
-// @Description Создает новую подписку пользователя
+// @Description Создает новую подписку пользователя. Можно указать месяц окончания пробного периода и скидку либо промокод, заметку и метаданные (до 20 строковых значений). Подписка, период которой пересекается с другой подпиской пользователя на тот же сервис, по умолчанию отклоняется с кодом 409 и ID этой подписки; в режиме warn она создается, а пересекающиеся подписки перечисляются в поле overlaps
 // @Tags Subscriptions
 // @Accept json
 // @Produce json
@@ -67,6 +35,8 @@ func hashString(s string) string {
 // @Success 201 {object} entity.Subscription
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/subscriptions [post]
 func (c *SubscriptionController) Create(ctx echo.Context) error {
@@ -95,12 +65,35 @@ func (c *SubscriptionController) Create(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
 	}
 
+	newSub, errResp := c.subscriptionFromCreate(req)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	sub, err := c.service.CreateSubscription(ctx.Request().Context(), newSub)
+	if err != nil {
+		c.logError("create subscription", err, log.Fields{
+			"subscription": fmt.Sprintf("%+v", newSub),
+			"user_id_hash": hashString(newSub.UserID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("create subscription", log.Fields{
+		"subscription_id": sub.ID,
+		"user_id_hash":    hashString(sub.UserID.String()),
+	})
+	return ctx.JSON(http.StatusCreated, sub)
+}
+
+// subscriptionFromCreate parses a validated create request.
+func (c *baseController) subscriptionFromCreate(req CreateRequest) (entity.Subscription, *ErrorResponse) {
 	startDate, err := time.Parse("01-2006", req.StartDate)
 	if err != nil {
 		c.logError("parse start date", err, log.Fields{
 			"start_date": req.StartDate,
 		})
-		return ctx.JSON(http.StatusBadRequest, ErrInvalidDateFormat)
+		return entity.Subscription{}, &ErrInvalidDateFormat
 	}
 
 	userID, err := uuid.Parse(req.UserID)
@@ -108,32 +101,50 @@ func (c *SubscriptionController) Create(ctx echo.Context) error {
 		c.logError("parse user ID", err, log.Fields{
 			"user_id_hash": hashString(req.UserID),
 		})
-		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+		return entity.Subscription{}, &ErrInvalidUserID
 	}
 
-	sub := &entity.Subscription{
+	sub := entity.Subscription{
 		Service: entity.Service{
-			Name:  req.Service.Name,
-			Price: req.Service.Price,
+			Name:     req.Service.Name,
+			Price:    req.Service.Price,
+			Category: req.Service.Category,
 		},
 		UserID:    userID,
+		Status:    entity.SubscriptionStatus(req.Status),
 		StartDate: startDate,
+		AutoRenew: req.AutoRenew,
+		Notes:     req.Notes,
+		Metadata:  req.Metadata,
 	}
 
-	sub, err = c.service.CreateSubscription(ctx.Request().Context(), *sub)
-	if err != nil {
-		c.logError("create subscription", err, log.Fields{
-			"subscription": fmt.Sprintf("%+v", sub),
-			"user_id_hash": hashString(userID.String()),
-		})
-		return HTTPError(err)
+	if req.TrialEnd != "" {
+		trialEnd, err := time.Parse("01-2006", req.TrialEnd)
+		if err != nil {
+			c.logError("parse trial end", err, log.Fields{
+				"trial_end": req.TrialEnd,
+			})
+			return entity.Subscription{}, &ErrInvalidDateFormat
+		}
+		sub.TrialEnd = &trialEnd
 	}
 
-	c.logSuccess("create subscription", log.Fields{
-		"subscription_id": sub.ID,
-		"user_id_hash":    hashString(userID.String()),
-	})
-	return ctx.JSON(http.StatusCreated, sub)
+	switch {
+	case req.Discount != nil && req.PromoCode != "":
+		c.logError("validate discount", nil, log.Fields{
+			"promo_code": req.PromoCode,
+		})
+		return entity.Subscription{}, &ErrInvalidDiscount
+	case req.Discount != nil:
+		sub.Discount = &entity.Discount{
+			Type:   entity.DiscountType(req.Discount.Type),
+			Value:  req.Discount.Value,
+			Months: req.Discount.Months,
+		}
+	case req.PromoCode != "":
+		sub.Discount = &entity.Discount{PromoCode: &req.PromoCode}
+	}
+	return sub, nil
 }
 
 // GetByID godoc
@@ -173,7 +184,7 @@ func (c *SubscriptionController) GetByID(ctx echo.Context) error {
 
 // Update godoc
 // @Summary Обновить подписку
-// @Description Обновляет данные существующей подписки
+// @Description Обновляет данные существующей подписки. Изменение, после которого период пересекается с другой подпиской пользователя на тот же сервис, отклоняется так же, как при создании
 // @Tags Subscriptions
 // @Accept json
 // @Produce json
@@ -182,6 +193,7 @@ func (c *SubscriptionController) GetByID(ctx echo.Context) error {
 // @Success 204
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/subscriptions/{id} [put]
 func (c *SubscriptionController) Update(ctx echo.Context) error {
@@ -208,24 +220,9 @@ func (c *SubscriptionController) Update(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
 	}
 
-	var endDate *time.Time
-	if req.EndDate != "" {
-		parsedDate, err := time.Parse("01-2006", req.EndDate)
-		if err != nil {
-			c.logError("parse end date", err, log.Fields{
-				"end_date": req.EndDate,
-			})
-			return ctx.JSON(http.StatusBadRequest, ErrInvalidDateFormat)
-		}
-		endDate = &parsedDate
-	}
-
-	sub := entity.Subscription{
-		Service: entity.Service{
-			Name:  req.Service.Name,
-			Price: req.Service.Price,
-		},
-		EndDate: endDate,
+	sub, errResp := c.subscriptionFromUpdate(req)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
 	}
 
 	err = c.service.UpdateSubscription(ctx.Request().Context(), id, sub)
@@ -243,6 +240,33 @@ func (c *SubscriptionController) Update(ctx echo.Context) error {
 	return ctx.NoContent(http.StatusNoContent)
 }
 
+// subscriptionFromUpdate parses a validated update request.
+func (c *SubscriptionController) subscriptionFromUpdate(req UpdateRequest) (entity.Subscription, *ErrorResponse) {
+	var endDate *time.Time
+	if req.EndDate != "" {
+		parsedDate, err := time.Parse("01-2006", req.EndDate)
+		if err != nil {
+			c.logError("parse end date", err, log.Fields{
+				"end_date": req.EndDate,
+			})
+			return entity.Subscription{}, &ErrInvalidDateFormat
+		}
+		endDate = &parsedDate
+	}
+
+	return entity.Subscription{
+		Service: entity.Service{
+			Name:     req.Service.Name,
+			Price:    req.Service.Price,
+			Category: req.Service.Category,
+		},
+		EndDate:   endDate,
+		AutoRenew: req.AutoRenew,
+		Notes:     req.Notes,
+		Metadata:  req.Metadata,
+	}, nil
+}
+
 // Delete godoc
 // @Summary Удалить подписку
 // @Description Удаляет подписку по её идентификатору
@@ -280,14 +304,35 @@ func (c *SubscriptionController) Delete(ctx echo.Context) error {
 
 // ListByUser godoc
 // @Summary Список подписок пользователя
-// @Description Возвращает все подписки указанного пользователя с пагинацией
+// @Description Возвращает подписки указанного пользователя, начиная с последних по дате начала. С active_only=true возвращаются только подписки в статусе trial или active, срок которых не истек.
+// @Description Ответ содержит next_cursor и prev_cursor; переданный в cursor, он возвращает следующую или предыдущую страницу без подсчета total. Без cursor работает постраничная выдача по page
 // @Tags Subscriptions
 // @Produce json
 // @Param user_id query string true "ID пользователя"
-// @Param page query int false "Номер страницы (по умолчанию 1)"
+// @Param active_only query bool false "Только действующие подписки"
+// @Param service_name query string false "Название сервиса (точное совпадение)"
+// @Param service_name_prefix query string false "Начало названия сервиса без учета регистра"
+// @Param min_price query int false "Минимальная цена"
+// @Param max_price query int false "Максимальная цена"
+// @Param active_on query string false "Подписка действует в этом месяце (MM-YYYY)"
+// @Param started_from query string false "Начало не раньше месяца (MM-YYYY)"
+// @Param started_to query string false "Начало не позже месяца (MM-YYYY)"
+// @Param ended_from query string false "Окончание не раньше месяца (MM-YYYY)"
+// @Param ended_to query string false "Окончание не позже месяца (MM-YYYY)"
+// @Param created_from query string false "Создана не раньше дня (YYYY-MM-DD, UTC)"
+// @Param created_to query string false "Создана не позже дня (YYYY-MM-DD, UTC)"
+// @Param status query []string false "Статусы: trial, active, paused, cancelled, expired" collectionFormat(multi)
+// @Param category query string false "Категория сервиса"
+// @Param metadata query []string false "Фильтр по метаданным: ключ или ключ:значение, до 10 фильтров" collectionFormat(multi)
+// @Param sort query string false "Сортировка: start_date (по умолчанию), created_at, price или service_name"
+// @Param order query string false "Направление сортировки: desc (по умолчанию) или asc"
+// @Param cursor query string false "Курсор из next_cursor или prev_cursor предыдущего ответа"
+// @Param page query int false "Номер страницы (по умолчанию 1), без cursor"
 // @Param limit query int false "Количество записей на странице (по умолчанию 10, максимум 100)"
-// @Success 200 {array}  PaginatedResponse
+// @Param with_total query bool false "Считать total (по умолчанию true), без cursor"
+// @Success 200 {object} PaginatedResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/subscriptions [get]
 func (c *SubscriptionController) ListByUser(ctx echo.Context) error {
@@ -301,16 +346,46 @@ func (c *SubscriptionController) ListByUser(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
 	}
 
-	page, err := strconv.Atoi(ctx.QueryParam("page"))
-	if err != nil || page < 1 {
-		page = 1
+	filter, sort, httpErr := c.parseListQuery(ctx)
+	if httpErr != nil {
+		return httpErr
 	}
+	filter.UserID = userID
+
 	limit, err := strconv.Atoi(ctx.QueryParam("limit"))
 	if err != nil || limit < 1 || limit > 100 {
 		limit = 10
 	}
 
-	subscriptions, total, err := c.service.ListSubscriptionsByUser(ctx.Request().Context(), userID, page, limit)
+	if raw := ctx.QueryParam("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			c.logError("parse cursor", err, nil)
+			return ctx.JSON(http.StatusBadRequest, ErrInvalidCursor)
+		}
+		if !sort.IsDefault() {
+			c.logError("parse cursor", nil, log.Fields{
+				"sort":  sort.Field,
+				"order": ctx.QueryParam("order"),
+			})
+			return ctx.JSON(http.StatusBadRequest, ErrCursorSort)
+		}
+		return c.listByCursor(ctx, filter, &cursor, limit)
+	}
+
+	page, err := strconv.Atoi(ctx.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	withTotal, err := parseWithTotal(ctx)
+	if err != nil {
+		c.logError("parse with_total", err, log.Fields{
+			"with_total": ctx.QueryParam("with_total"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	list, err := c.service.ListSubscriptionsByUser(ctx.Request().Context(), filter, sort, page, limit, withTotal)
 	if err != nil {
 		c.logError("list subscriptions by user", err, log.Fields{
 			"user_id_hash": hashString(userID.String()),
@@ -320,19 +395,306 @@ func (c *SubscriptionController) ListByUser(ctx echo.Context) error {
 
 	c.logSuccess("list subscriptions by user", log.Fields{
 		"user_id_hash": hashString(userID.String()),
-		"count":        len(subscriptions),
+		"count":        len(list.Items),
+	})
+	resp := paginatedResponse(list, page, limit)
+	// Cursors let a client continue from any page without OFFSET. They follow
+	// the default order only.
+	if len(list.Items) > 0 && sort.IsDefault() {
+		if list.HasMore {
+			next := list.Items[len(list.Items)-1].CursorOf()
+			resp.NextCursor = encodeCursor(&next)
+		}
+		if page > 1 {
+			prev := list.Items[0].CursorOf()
+			prev.Backward = true
+			resp.PrevCursor = encodeCursor(&prev)
+		}
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// AdminList godoc
+// @Summary Список подписок всех пользователей
+// @Description Возвращает подписки всех пользователей с теми же фильтрами и постраничной выдачей, что и список подписок пользователя. По умолчанию сначала идут недавно созданные. Требует административный токен
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param active_only query bool false "Только действующие подписки"
+// @Param service_name query string false "Название сервиса (точное совпадение)"
+// @Param service_name_prefix query string false "Начало названия сервиса без учета регистра"
+// @Param min_price query int false "Минимальная цена"
+// @Param max_price query int false "Максимальная цена"
+// @Param active_on query string false "Подписка действует в этом месяце (MM-YYYY)"
+// @Param started_from query string false "Начало не раньше месяца (MM-YYYY)"
+// @Param started_to query string false "Начало не позже месяца (MM-YYYY)"
+// @Param ended_from query string false "Окончание не раньше месяца (MM-YYYY)"
+// @Param ended_to query string false "Окончание не позже месяца (MM-YYYY)"
+// @Param created_from query string false "Создана не раньше дня (YYYY-MM-DD, UTC)"
+// @Param created_to query string false "Создана не позже дня (YYYY-MM-DD, UTC)"
+// @Param status query []string false "Статусы: trial, active, paused, cancelled, expired" collectionFormat(multi)
+// @Param category query string false "Категория сервиса"
+// @Param metadata query []string false "Фильтр по метаданным: ключ или ключ:значение, до 10 фильтров" collectionFormat(multi)
+// @Param sort query string false "Сортировка: created_at (по умолчанию), start_date, price или service_name"
+// @Param order query string false "Направление сортировки: desc (по умолчанию) или asc"
+// @Param page query int false "Номер страницы (по умолчанию 1)"
+// @Param limit query int false "Количество записей на странице (по умолчанию 10, максимум 100)"
+// @Param with_total query bool false "Считать total (по умолчанию true)"
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/subscriptions [get]
+func (c *SubscriptionController) AdminList(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	filter, sort, httpErr := c.parseListQuery(ctx)
+	if httpErr != nil {
+		return httpErr
+	}
+	if sort.Field == "" {
+		sort.Field = entity.SortByCreatedAt
+	}
+
+	limit, err := strconv.Atoi(ctx.QueryParam("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 10
+	}
+	page, err := strconv.Atoi(ctx.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	withTotal, err := parseWithTotal(ctx)
+	if err != nil {
+		c.logError("parse with_total", err, log.Fields{
+			"with_total": ctx.QueryParam("with_total"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	list, err := c.service.ListAllSubscriptions(ctx.Request().Context(), filter, sort, page, limit, withTotal)
+	if err != nil {
+		c.logError("list all subscriptions", err, nil)
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list all subscriptions", log.Fields{
+		"count": len(list.Items),
+	})
+	return ctx.JSON(http.StatusOK, paginatedResponse(list, page, limit))
+}
+
+// paginatedResponse renders a page of an offset listing.
+func paginatedResponse(list entity.SubscriptionList, page, limit int) PaginatedResponse {
+	if list.Items == nil {
+		list.Items = []entity.Subscription{}
+	}
+	return PaginatedResponse{
+		Items:   list.Items,
+		Total:   list.Total,
+		HasMore: list.HasMore,
+		Page:    page,
+		Limit:   limit,
+	}
+}
+
+// Search godoc
+// @Summary Поиск подписок пользователя
+// @Description Ищет подписки пользователя по названию сервиса с учетом опечаток и по словам заметок. Сначала идут самые близкие совпадения
+// @Tags Subscriptions
+// @Produce json
+// @Param q query string true "Поисковый запрос"
+// @Param user_id query string true "ID пользователя"
+// @Param limit query int false "Количество результатов (1-100, по умолчанию 10)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} SearchSubscriptionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/search [get]
+func (c *SubscriptionController) Search(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDQuery(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+	return c.search(ctx, &userID)
+}
+
+// AdminSearch godoc
+// @Summary Поиск подписок всех пользователей
+// @Description Ищет подписки по названию сервиса с учетом опечаток и по словам заметок. Требует административный токен
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param q query string true "Поисковый запрос"
+// @Param user_id query string false "ID пользователя"
+// @Param limit query int false "Количество результатов (1-100, по умолчанию 10)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} SearchSubscriptionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/subscriptions/search [get]
+func (c *SubscriptionController) AdminSearch(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var userID *uuid.UUID
+	if ctx.QueryParam("user_id") != "" {
+		parsed, errResp := c.parseUserIDQuery(ctx)
+		if errResp != nil {
+			return ctx.JSON(http.StatusBadRequest, errResp)
+		}
+		userID = &parsed
+	}
+	return c.search(ctx, userID)
+}
+
+// search runs a search limited to the subscriptions of userID, or of all
+// users when it is nil.
+func (c *SubscriptionController) search(ctx echo.Context, userID *uuid.UUID) error {
+	req := SearchSubscriptionsRequest{Query: strings.TrimSpace(ctx.QueryParam("q"))}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	limit, offset := parseLimitOffset(ctx)
+	search := entity.SubscriptionSearch{Query: req.Query, UserID: userID}
+	matches, err := c.service.SearchSubscriptions(ctx.Request().Context(), search, offset, limit)
+	if err != nil {
+		c.logError("search subscriptions", err, log.Fields{
+			"query_hash": hashString(req.Query),
+		})
+		return HTTPError(err)
+	}
+
+	if matches == nil {
+		matches = []entity.SubscriptionMatch{}
+	}
+	c.logSuccess("search subscriptions", log.Fields{
+		"query_hash": hashString(req.Query),
+		"count":      len(matches),
+	})
+	return ctx.JSON(http.StatusOK, SearchSubscriptionsResponse{
+		Items:  matches,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// parseListQuery reads the filters and sort of a subscription listing.
+func (c *SubscriptionController) parseListQuery(ctx echo.Context) (entity.SubscriptionFilter, entity.SubscriptionSort, *echo.HTTPError) {
+	var req ListSubscriptionsRequest
+	if err := (&echo.DefaultBinder{}).BindQueryParams(ctx, &req); err != nil {
+		c.logError("bind query", err, nil)
+		return entity.SubscriptionFilter{}, entity.SubscriptionSort{}, echo.NewHTTPError(http.StatusBadRequest, ErrBadRequest)
+	}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return entity.SubscriptionFilter{}, entity.SubscriptionSort{}, handleValidationError(err)
+	}
+	if req.MinPrice != nil && req.MaxPrice != nil && *req.MinPrice > *req.MaxPrice {
+		c.logError("validate price range", nil, log.Fields{
+			"min_price": *req.MinPrice,
+			"max_price": *req.MaxPrice,
+		})
+		return entity.SubscriptionFilter{}, entity.SubscriptionSort{}, echo.NewHTTPError(http.StatusBadRequest, ErrInvalidPriceRange)
+	}
+
+	filter := entity.SubscriptionFilter{
+		ActiveOnly: req.ActiveOnly,
+		MinPrice:   req.MinPrice,
+		MaxPrice:   req.MaxPrice,
+		ActiveOn:   parseOptional(monthLayout, req.ActiveOn),
+	}
+	if req.ServiceName != "" {
+		filter.ServiceName = &req.ServiceName
+	}
+	if req.ServiceNamePrefix != "" {
+		filter.ServiceNamePrefix = &req.ServiceNamePrefix
+	}
+	if req.Category != "" {
+		filter.Category = &req.Category
+	}
+	for _, status := range req.Status {
+		filter.Statuses = append(filter.Statuses, entity.SubscriptionStatus(status))
+	}
+	for _, raw := range req.Metadata {
+		key, value, hasValue := strings.Cut(raw, ":")
+		if key == "" {
+			c.logError("parse metadata filter", nil, log.Fields{
+				"metadata": raw,
+			})
+			return entity.SubscriptionFilter{}, entity.SubscriptionSort{}, echo.NewHTTPError(http.StatusBadRequest, ErrMetadataFilter)
+		}
+		m := entity.MetadataFilter{Key: key}
+		if hasValue {
+			m.Value = &value
+		}
+		filter.Metadata = append(filter.Metadata, m)
+	}
+
+	ranges := []struct {
+		from, to   string
+		layout     string
+		fromT, toT **time.Time
+	}{
+		{req.StartedFrom, req.StartedTo, monthLayout, &filter.StartedFrom, &filter.StartedTo},
+		{req.EndedFrom, req.EndedTo, monthLayout, &filter.EndedFrom, &filter.EndedTo},
+		{req.CreatedFrom, req.CreatedTo, dayLayout, &filter.CreatedFrom, &filter.CreatedTo},
+	}
+	for _, r := range ranges {
+		*r.fromT, *r.toT = parseOptional(r.layout, r.from), parseOptional(r.layout, r.to)
+		if *r.fromT != nil && *r.toT != nil && (*r.toT).Before(**r.fromT) {
+			c.logError("validate date range", nil, log.Fields{
+				"from": r.from,
+				"to":   r.to,
+			})
+			return entity.SubscriptionFilter{}, entity.SubscriptionSort{}, echo.NewHTTPError(http.StatusBadRequest, ErrInvalidDateRange)
+		}
+	}
+
+	sort := entity.SubscriptionSort{
+		Field: entity.SubscriptionSortField(req.Sort),
+		Asc:   req.Order == "asc",
+	}
+	return filter, sort, nil
+}
+
+func (c *SubscriptionController) listByCursor(
+	ctx echo.Context,
+	filter entity.SubscriptionFilter,
+	cursor *entity.SubscriptionCursor,
+	limit int,
+) error {
+	page, err := c.service.ListSubscriptionsByCursor(ctx.Request().Context(), filter, cursor, limit)
+	if err != nil {
+		c.logError("list subscriptions by cursor", err, log.Fields{
+			"user_id_hash": hashString(filter.UserID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list subscriptions by cursor", log.Fields{
+		"user_id_hash": hashString(filter.UserID.String()),
+		"count":        len(page.Items),
 	})
-	return ctx.JSON(http.StatusOK, PaginatedResponse{
-		Items: subscriptions,
-		Total: total,
-		Page:  page,
-		Limit: limit,
+	if page.Items == nil {
+		page.Items = []entity.Subscription{}
+	}
+	return ctx.JSON(http.StatusOK, CursorPaginatedResponse{
+		Items:      page.Items,
+		Limit:      limit,
+		NextCursor: encodeCursor(page.Next),
+		PrevCursor: encodeCursor(page.Prev),
 	})
 }
 
 // CalculateTotalCost godoc
 // @Summary Расчет стоимости подписок
-// @Description Возвращает суммарную стоимость подписок за период
+// @Description Возвращает суммарную стоимость подписок за период с учетом пробных периодов и скидок (total), стоимость по прайсу (gross) и размер скидки
 // @Tags Subscriptions
 // @Produce json
 // @Param user_id query string false "ID пользователя"
@@ -417,11 +779,101 @@ func (c *SubscriptionController) CalculateTotalCost(ctx echo.Context) error {
 	}
 
 	c.logSuccess("calculate total cost", log.Fields{
-		"total":        total,
+		"gross":        total.Gross,
+		"net":          total.Net,
 		"user_id_hash": hashString(req.UserID),
 		"service_name": serviceName,
 		"start_date":   startDate.Format("01-2006"),
 		"end_date":     endDate.Format("01-2006"),
 	})
-	return ctx.JSON(http.StatusOK, TotalCostResponse{Total: total})
+	return ctx.JSON(http.StatusOK, TotalCostResponse{
+		Total:    total.Net,
+		Gross:    total.Gross,
+		Discount: total.Gross - total.Net,
+	})
+}
+
+// Pause godoc
+// @Summary Приостановить подписку
+// @Description Приостанавливает подписку со следующего месяца. Месяцы паузы не учитываются в расчете стоимости
+// @Tags Subscriptions
+// @Produce json
+// @Param id path string true "ID подписки"
+// @Success 200 {object} entity.Subscription
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/{id}/pause [post]
+func (c *SubscriptionController) Pause(ctx echo.Context) error {
+	return c.changeStatus(ctx, "pause subscription", c.service.PauseSubscription)
+}
+
+// Resume godoc
+// @Summary Возобновить подписку
+// @Description Возобновляет приостановленную подписку с текущего месяца
+// @Tags Subscriptions
+// @Produce json
+// @Param id path string true "ID подписки"
+// @Success 200 {object} entity.Subscription
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/{id}/resume [post]
+func (c *SubscriptionController) Resume(ctx echo.Context) error {
+	return c.changeStatus(ctx, "resume subscription", c.service.ResumeSubscription)
+}
+
+// Cancel godoc
+// @Summary Отменить подписку
+// @Description Отменяет подписку: текущий месяц становится последним оплачиваемым
+// @Tags Subscriptions
+// @Produce json
+// @Param id path string true "ID подписки"
+// @Success 200 {object} entity.Subscription
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subscriptions/{id}/cancel [post]
+func (c *SubscriptionController) Cancel(ctx echo.Context) error {
+	return c.changeStatus(ctx, "cancel subscription", c.service.CancelSubscription)
+}
+
+func (c *SubscriptionController) changeStatus(
+	ctx echo.Context,
+	action string,
+	change func(ctx context.Context, id uuid.UUID) error,
+) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse subscription ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidSubscription)
+	}
+
+	if err := change(ctx.Request().Context(), id); err != nil {
+		c.logError(action, err, log.Fields{
+			"subscription_id": id,
+		})
+		return HTTPError(err)
+	}
+
+	sub, err := c.service.GetSubscriptionByID(ctx.Request().Context(), id)
+	if err != nil {
+		c.logError("get subscription by ID", err, log.Fields{
+			"subscription_id": id,
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess(action, log.Fields{
+		"subscription_id": id,
+		"status":          sub.Status,
+	})
+	return ctx.JSON(http.StatusOK, sub)
 }
@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type UserDataController struct {
+	baseController
+	service service.UserDataService
+}
+
+func NewUserDataController(s service.UserDataService, logger *log.Logger) *UserDataController {
+	return &UserDataController{baseController: newBaseController(logger), service: s}
+}
+
+// parseUserIDParam reads the user_id path parameter.
+func (c *UserDataController) parseUserIDParam(ctx echo.Context) (uuid.UUID, *ErrorResponse) {
+	userID, err := uuid.Parse(ctx.Param("user_id"))
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(ctx.Param("user_id")),
+		})
+		return uuid.Nil, &ErrInvalidUserID
+	}
+	return userID, nil
+}
+
+// Export godoc
+// @Summary Выгрузка всех данных пользователя
+// @Description Возвращает JSON-архив со всеми данными пользователя для ответа на запрос субъекта данных: подписки, паузы, история событий, снимки расходов, бюджеты и оповещения, настройки и отправленные напоминания, вебхуки с доставками и прошлые удаления данных. Секреты вебхуков и токен календаря не выгружаются
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param user_id path string true "ID пользователя"
+// @Success 200 {object} entity.UserData
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/users/{user_id}/data [get]
+func (c *UserDataController) Export(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDParam(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	data, err := c.service.ExportUserData(ctx.Request().Context(), userID)
+	if err != nil {
+		c.logError("export user data", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("export user data", log.Fields{
+		"user_id_hash":  hashString(userID.String()),
+		"subscriptions": len(data.Subscriptions),
+	})
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "user-"+userID.String()+".json"))
+	return ctx.JSON(http.StatusOK, data)
+}
+
+// Erase godoc
+// @Summary Удаление всех данных пользователя
+// @Description Удаляет все данные пользователя одной транзакцией и сохраняет запись об удалении с SHA-256 от ID пользователя и числом удаленных строк по таблицам. События об удалении подписок не публикуются
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param user_id path string true "ID пользователя"
+// @Param reference query string false "Номер обращения, до 200 символов"
+// @Success 200 {object} entity.UserErasure
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/users/{user_id}/data [delete]
+func (c *UserDataController) Erase(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDParam(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	req := EraseUserDataRequest{Reference: ctx.QueryParam("reference")}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	erasure, err := c.service.EraseUserData(ctx.Request().Context(), userID, req.Reference)
+	if err != nil {
+		c.logError("erase user data", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("erase user data", log.Fields{
+		"user_id_hash": erasure.UserIDHash,
+		"erasure_id":   erasure.ID,
+		"deleted":      erasure.Deleted,
+	})
+	return ctx.JSON(http.StatusOK, erasure)
+}
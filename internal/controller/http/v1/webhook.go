@@ -0,0 +1,260 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type WebhookController struct {
+	baseController
+	service service.WebhookService
+}
+
+func NewWebhookController(s service.WebhookService, logger *log.Logger) *WebhookController {
+	return &WebhookController{baseController: newBaseController(logger), service: s}
+}
+
+// Create godoc
+// @Summary Зарегистрировать вебхук
+// @Description Регистрирует URL, на который отправляются события подписок пользователя. Тело запроса подписывается HMAC-SHA256 секретом, который возвращается только в ответе на этот запрос
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param request body CreateWebhookRequest true "Данные вебхука"
+// @Success 201 {object} entity.WebhookEndpoint
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks [post]
+func (c *WebhookController) Create(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	var req CreateWebhookRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logError("bind request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.logError("parse user ID", err, log.Fields{
+			"user_id_hash": hashString(req.UserID),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	endpoint := entity.WebhookEndpoint{UserID: userID, URL: req.URL, EventTypes: []entity.EventType{}}
+	for _, t := range req.EventTypes {
+		endpoint.EventTypes = append(endpoint.EventTypes, entity.EventType(t))
+	}
+
+	created, err := c.service.CreateEndpoint(ctx.Request().Context(), endpoint)
+	if err != nil {
+		c.logError("create webhook", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("create webhook", log.Fields{
+		"webhook_id":   created.ID,
+		"user_id_hash": hashString(userID.String()),
+	})
+	return ctx.JSON(http.StatusCreated, created)
+}
+
+// List godoc
+// @Summary Вебхуки пользователя
+// @Description Возвращает зарегистрированные вебхуки пользователя без секретов
+// @Tags Webhooks
+// @Produce json
+// @Param user_id query string true "ID пользователя"
+// @Success 200 {object} WebhooksResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks [get]
+func (c *WebhookController) List(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	userID, errResp := c.parseUserIDQuery(ctx)
+	if errResp != nil {
+		return ctx.JSON(http.StatusBadRequest, errResp)
+	}
+
+	endpoints, err := c.service.ListEndpoints(ctx.Request().Context(), userID)
+	if err != nil {
+		c.logError("list webhooks", err, log.Fields{
+			"user_id_hash": hashString(userID.String()),
+		})
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list webhooks", log.Fields{
+		"user_id_hash": hashString(userID.String()),
+		"count":        len(endpoints),
+	})
+	if endpoints == nil {
+		endpoints = []entity.WebhookEndpoint{}
+	}
+	return ctx.JSON(http.StatusOK, WebhooksResponse{Items: endpoints})
+}
+
+// Delete godoc
+// @Summary Удалить вебхук
+// @Description Удаляет вебхук вместе с очередью и журналом доставок
+// @Tags Webhooks
+// @Param id path string true "ID вебхука"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks/{id} [delete]
+func (c *WebhookController) Delete(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse webhook ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := c.service.DeleteEndpoint(ctx.Request().Context(), id); err != nil {
+		c.logError("delete webhook", err, log.Fields{
+			"webhook_id": id,
+		})
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, ErrWebhookNotFound)
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("delete webhook", log.Fields{
+		"webhook_id": id,
+	})
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// Deliveries godoc
+// @Summary Журнал доставок вебхука
+// @Description Возвращает доставки вебхука, начиная с последних: статус, число попыток, код ответа и ошибку последней попытки
+// @Tags Webhooks
+// @Produce json
+// @Param id path string true "ID вебхука"
+// @Param status query string false "Статус: pending, delivered или dead"
+// @Param limit query int false "Количество записей (по умолчанию 10, максимум 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} WebhookDeliveriesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (c *WebhookController) Deliveries(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse webhook ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	req := WebhookDeliveriesRequest{Status: ctx.QueryParam("status")}
+	if err := ctx.Validate(req); err != nil {
+		c.logError("validate request", err, nil)
+		return ctx.JSON(http.StatusBadRequest, handleValidationError(err))
+	}
+	limit, offset := parseLimitOffset(ctx)
+
+	var status *entity.DeliveryStatus
+	if req.Status != "" {
+		s := entity.DeliveryStatus(req.Status)
+		status = &s
+	}
+
+	deliveries, total, err := c.service.ListDeliveries(ctx.Request().Context(), id, status, offset, limit)
+	if err != nil {
+		c.logError("list webhook deliveries", err, log.Fields{
+			"webhook_id": id,
+		})
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, ErrWebhookNotFound)
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("list webhook deliveries", log.Fields{
+		"webhook_id": id,
+		"count":      len(deliveries),
+	})
+	if deliveries == nil {
+		deliveries = []entity.WebhookDelivery{}
+	}
+	return ctx.JSON(http.StatusOK, WebhookDeliveriesResponse{
+		Items:  deliveries,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// RetryDelivery godoc
+// @Summary Повторить доставку
+// @Description Возвращает доставку из состояния dead в очередь с полным числом попыток
+// @Tags Webhooks
+// @Param id path string true "ID вебхука"
+// @Param delivery_id path string true "ID доставки"
+// @Success 202
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/webhooks/{id}/deliveries/{delivery_id}/retry [post]
+func (c *WebhookController) RetryDelivery(ctx echo.Context) error {
+	c.logRequest(ctx.Request().Method, ctx.Request().URL.Path)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		c.logError("parse webhook ID", err, log.Fields{
+			"input_id": ctx.Param("id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+	deliveryID, err := uuid.Parse(ctx.Param("delivery_id"))
+	if err != nil {
+		c.logError("parse delivery ID", err, log.Fields{
+			"input_id": ctx.Param("delivery_id"),
+		})
+		return ctx.JSON(http.StatusBadRequest, ErrBadRequest)
+	}
+
+	if err := c.service.RetryDelivery(ctx.Request().Context(), id, deliveryID); err != nil {
+		c.logError("retry webhook delivery", err, log.Fields{
+			"webhook_id":  id,
+			"delivery_id": deliveryID,
+		})
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, ErrDeliveryNotFound)
+		}
+		return HTTPError(err)
+	}
+
+	c.logSuccess("retry webhook delivery", log.Fields{
+		"webhook_id":  id,
+		"delivery_id": deliveryID,
+	})
+	return ctx.NoContent(http.StatusAccepted)
+}
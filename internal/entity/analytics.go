@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MonthlyMRR struct {
+	Month          time.Time `json:"month"`
+	MRR            int       `json:"mrr"`
+	NewMRR         int       `json:"new_mrr"`
+	ChurnedMRR     int       `json:"churned_mrr"`
+	ReactivatedMRR int       `json:"reactivated_mrr"`
+	ActiveCount    int       `json:"active_count"`
+}
+
+type RetentionCohort struct {
+	ServiceName string    `json:"service_name"`
+	Cohort      time.Time `json:"cohort"`
+	Size        int       `json:"size"`
+	// Retained[i] is the number of cohort users still subscribed i months after the cohort month.
+	Retained []int `json:"retained"`
+}
+
+type ServiceRankingMetric string
+
+const (
+	RankBySubscribers ServiceRankingMetric = "subscribers"
+	RankByRevenue     ServiceRankingMetric = "revenue"
+)
+
+type ServiceRanking struct {
+	ServiceName string `json:"service_name"`
+	Subscribers int    `json:"subscribers"`
+	Revenue     int    `json:"revenue"`
+}
+
+type UserSpend struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Spend         int       `json:"spend"`
+	Subscriptions int       `json:"subscriptions"`
+}
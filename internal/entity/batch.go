@@ -0,0 +1,22 @@
+package entity
+
+import "github.com/google/uuid"
+
+// BatchMode selects how a batch treats items that fail.
+type BatchMode string
+
+const (
+	// BatchAtomic applies every item of the batch or none of them.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies the items that succeed and reports the others.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// BatchItemResult is the outcome of one item of a batch. Err is nil when the
+// item was applied. Overlaps are the subscriptions an applied item overlaps
+// under OverlapWarn.
+type BatchItemResult struct {
+	ID       uuid.UUID
+	Err      error
+	Overlaps []uuid.UUID
+}
@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Budget caps the monthly net spend of a user, on everything or, when
+// ServiceName is set, on a single service.
+type Budget struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	ServiceName *string   `json:"service_name,omitempty"`
+	Amount      int       `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type BudgetAlertKind string
+
+const (
+	// AlertActual means the spend of the current month exceeds the budget.
+	AlertActual BudgetAlertKind = "actual"
+	// AlertProjected means the next month will exceed the budget if the
+	// subscriptions stay as they are.
+	AlertProjected BudgetAlertKind = "projected"
+)
+
+// BudgetAlert is raised at most once per budget, month and kind.
+type BudgetAlert struct {
+	ID          uuid.UUID       `json:"id"`
+	BudgetID    uuid.UUID       `json:"budget_id"`
+	UserID      uuid.UUID       `json:"user_id"`
+	ServiceName *string         `json:"service_name,omitempty"`
+	Kind        BudgetAlertKind `json:"kind"`
+	Month       time.Time       `json:"month"`
+	Spend       int             `json:"spend"`
+	Amount      int             `json:"amount"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
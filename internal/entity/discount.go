@@ -0,0 +1,77 @@
+package entity
+
+import "time"
+
+type DiscountType string
+
+const (
+	DiscountPercent DiscountType = "percent"
+	DiscountFixed   DiscountType = "fixed"
+)
+
+// Discount lowers the monthly price of a subscription. It applies from the
+// first paid month after the trial for Months months, or for good when Months
+// is nil.
+type Discount struct {
+	Type      DiscountType `json:"type"`
+	Value     int          `json:"value"`
+	Months    *int         `json:"months,omitempty"`
+	PromoCode *string      `json:"promo_code,omitempty"`
+}
+
+// Apply returns price after the discount, never below zero.
+func (d Discount) Apply(price int) int {
+	switch d.Type {
+	case DiscountPercent:
+		price = price * (100 - d.Value) / 100
+	case DiscountFixed:
+		price -= d.Value
+	}
+	if price < 0 {
+		return 0
+	}
+	return price
+}
+
+type PromoCode struct {
+	Code       string       `json:"code"`
+	Type       DiscountType `json:"type"`
+	Value      int          `json:"value"`
+	Months     *int         `json:"months,omitempty"`
+	ValidUntil *time.Time   `json:"valid_until,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// Discount returns the rule a subscription gets when the code is redeemed.
+func (p PromoCode) Discount() Discount {
+	code := p.Code
+	return Discount{Type: p.Type, Value: p.Value, Months: p.Months, PromoCode: &code}
+}
+
+// NetPrice returns what a subscription with the given list price is charged
+// for month: nothing during the trial, which covers the months before the one
+// trialEnd falls into, and the discounted price while the discount lasts.
+func NetPrice(price int, startDate time.Time, trialEnd *time.Time, discount *Discount, month time.Time) int {
+	paidFrom := firstOfMonth(startDate)
+	if trialEnd != nil {
+		trialMonth := firstOfMonth(*trialEnd)
+		if month.Before(trialMonth) {
+			return 0
+		}
+		if trialMonth.After(paidFrom) {
+			paidFrom = trialMonth
+		}
+	}
+
+	if discount == nil {
+		return price
+	}
+	if discount.Months != nil && !month.Before(paidFrom.AddDate(0, *discount.Months, 0)) {
+		return price
+	}
+	return discount.Apply(price)
+}
+
+func firstOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	EventSubscriptionCreated EventType = "subscription.created"
+	EventSubscriptionUpdated EventType = "subscription.updated"
+	EventSubscriptionDeleted EventType = "subscription.deleted"
+	EventSubscriptionExpired EventType = "subscription.expired"
+	EventSubscriptionRenewed EventType = "subscription.renewed"
+	EventRenewalDue          EventType = "subscription.renewal_due"
+)
+
+// SubscriptionEvent describes a change of a subscription. For deletions
+// Subscription holds the state before the delete.
+type SubscriptionEvent struct {
+	ID           uuid.UUID    `json:"id"`
+	Type         EventType    `json:"type"`
+	OccurredAt   time.Time    `json:"occurred_at"`
+	Subscription Subscription `json:"subscription"`
+}
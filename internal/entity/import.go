@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ImportStatus string
+
+const (
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// ImportRow is a parsed row of an import file. Error is set when the row
+// could not be turned into a subscription.
+type ImportRow struct {
+	Line         int
+	Subscription Subscription
+	Error        string
+}
+
+// ImportRowError is a row that was skipped and the reason.
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Import is an import of subscriptions from a file. Invalid rows are skipped
+// and listed in Errors; the valid ones are created in the background, and
+// ProcessedRows counts those already handled.
+type Import struct {
+	ID            uuid.UUID        `json:"id"`
+	Status        ImportStatus     `json:"status"`
+	TotalRows     int              `json:"total_rows"`
+	ValidRows     int              `json:"valid_rows"`
+	ProcessedRows int              `json:"processed_rows"`
+	ImportedRows  int              `json:"imported_rows"`
+	FailedRows    int              `json:"failed_rows"`
+	Errors        []ImportRowError `json:"errors"`
+	// Error tells why a failed import stopped.
+	Error      *string    `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
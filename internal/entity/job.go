@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobTrigger string
+
+const (
+	JobTriggerSchedule JobTrigger = "schedule"
+	JobTriggerManual   JobTrigger = "manual"
+)
+
+type JobRunStatus string
+
+const (
+	JobRunning   JobRunStatus = "running"
+	JobSucceeded JobRunStatus = "succeeded"
+	JobFailed    JobRunStatus = "failed"
+)
+
+// Job is a scheduled background task with its cron schedule.
+type Job struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Schedule    string    `json:"schedule"`
+	NextRunAt   time.Time `json:"next_run_at"`
+	LastRun     *JobRun   `json:"last_run,omitempty"`
+}
+
+// JobRun is one execution of a job. ScheduledAt is the cron slot of a
+// scheduled run, every slot runs at most once across all instances.
+type JobRun struct {
+	ID          uuid.UUID    `json:"id"`
+	Job         string       `json:"job"`
+	Trigger     JobTrigger   `json:"trigger"`
+	Status      JobRunStatus `json:"status"`
+	Instance    string       `json:"instance"`
+	ScheduledAt *time.Time   `json:"scheduled_at,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	// Processed is the number of items the run handled, e.g. emails sent.
+	Processed *int    `json:"processed,omitempty"`
+	Error     *string `json:"error,omitempty"`
+}
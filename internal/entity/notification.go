@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Locale string
+
+const (
+	LocaleRU Locale = "ru"
+	LocaleEN Locale = "en"
+)
+
+// NotificationPreferences controls which email reminders a user receives and
+// how many days before the charge they are sent.
+type NotificationPreferences struct {
+	UserID           uuid.UUID `json:"user_id"`
+	Email            string    `json:"email"`
+	Locale           Locale    `json:"locale"`
+	RenewalReminders bool      `json:"renewal_reminders"`
+	TrialReminders   bool      `json:"trial_reminders"`
+	DaysBefore       int       `json:"days_before"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type ReminderKind string
+
+const (
+	// ReminderRenewal is sent before a regular charge.
+	ReminderRenewal ReminderKind = "renewal"
+	// ReminderTrialEnd is sent before the first charge after a free trial.
+	ReminderTrialEnd ReminderKind = "trial_end"
+)
+
+// Reminder identifies a reminder email. Each one is sent at most once per
+// subscription, kind and charge date.
+type Reminder struct {
+	SubscriptionID uuid.UUID    `json:"subscription_id"`
+	UserID         uuid.UUID    `json:"user_id"`
+	Kind           ReminderKind `json:"kind"`
+	ChargeDate     time.Time    `json:"charge_date"`
+	Email          string       `json:"email"`
+}
@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const AggregateSubscription = "subscription"
+
+// OutboxEvent is a domain event stored in the same transaction as the change
+// it describes and published later by the relay. Payload holds the JSON of
+// the event, a SubscriptionEvent for subscription events.
+type OutboxEvent struct {
+	ID            uuid.UUID       `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   uuid.UUID       `json:"aggregate_id"`
+	UserID        uuid.UUID       `json:"user_id"`
+	Type          EventType       `json:"type"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Attempts      int             `json:"attempts"`
+}
+
+// DeadOutboxEvent is an event that ran out of attempts. It holds back the
+// later events of its aggregate until it is requeued.
+type DeadOutboxEvent struct {
+	OutboxEvent
+	LastError string    `json:"last_error"`
+	DeadAt    time.Time `json:"dead_at"`
+}
+
+// OutboxNotification is sent over LISTEN/NOTIFY when an event is committed.
+type OutboxNotification struct {
+	EventID uuid.UUID `json:"event_id"`
+	UserID  uuid.UUID `json:"user_id"`
+}
@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Renewal is a single upcoming charge of a subscription.
+type Renewal struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	ServiceName    string    `json:"service_name"`
+	Price          int       `json:"price"`
+	ChargeDate     time.Time `json:"charge_date"`
+	// TrialEnding marks the first charge after a free trial.
+	TrialEnding bool `json:"trial_ending"`
+}
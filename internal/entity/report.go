@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubscriptionCost is the part of a subscription the cost calculation needs.
+type SubscriptionCost struct {
+	UserID      uuid.UUID
+	ServiceName string
+	Price       int
+	StartDate   time.Time
+	EndDate     *time.Time
+	TrialEnd    *time.Time
+	Discount    *Discount
+	Pauses      []PausePeriod
+}
+
+// PausePeriod covers the months from From up to, but not including, Until.
+// A nil Until means the subscription is still paused.
+type PausePeriod struct {
+	From  time.Time
+	Until *time.Time
+}
+
+// PausedIn reports whether month falls into one of the pauses.
+func (c SubscriptionCost) PausedIn(month time.Time) bool {
+	for _, p := range c.Pauses {
+		if !p.From.After(month) && (p.Until == nil || p.Until.After(month)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NetPriceIn returns the price charged for month after the trial and discount.
+func (c SubscriptionCost) NetPriceIn(month time.Time) int {
+	return NetPrice(c.Price, c.StartDate, c.TrialEnd, c.Discount, month)
+}
+
+// MonthlyCost holds the list price total (Cost) and the charged total
+// (NetCost) of a month.
+type MonthlyCost struct {
+	Month   time.Time
+	Cost    int
+	NetCost int
+}
+
+// CostSummary is the cost of a period at list prices (Gross) and after
+// trials and discounts (Net).
+type CostSummary struct {
+	Gross int
+	Net   int
+}
+
+type CostBreakdownItem struct {
+	Month       time.Time `json:"month"`
+	UserID      uuid.UUID `json:"user_id"`
+	ServiceName string    `json:"service_name"`
+	Cost        int       `json:"cost"`
+	NetCost     int       `json:"net_cost"`
+}
@@ -6,17 +6,171 @@ import (
 	"github.com/google/uuid"
 )
 
+type SubscriptionStatus string
+
+const (
+	StatusTrial     SubscriptionStatus = "trial"
+	StatusActive    SubscriptionStatus = "active"
+	StatusPaused    SubscriptionStatus = "paused"
+	StatusCancelled SubscriptionStatus = "cancelled"
+	StatusExpired   SubscriptionStatus = "expired"
+)
+
+// OverlapPolicy decides what happens to a subscription whose period overlaps
+// another subscription of the same user to a service of the same name.
+type OverlapPolicy string
+
+const (
+	// OverlapReject refuses the subscription.
+	OverlapReject OverlapPolicy = "reject"
+	// OverlapWarn saves the subscription and reports the overlapped ones.
+	OverlapWarn OverlapPolicy = "warn"
+	// OverlapAllow saves the subscription silently.
+	OverlapAllow OverlapPolicy = "allow"
+)
+
 type Service struct {
-	ID    uuid.UUID `json:"id"`
-	Name  string    `json:"name"`
-	Price int       `json:"price"`
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Price    int       `json:"price"`
+	Category string    `json:"category,omitempty"`
 }
 
+// Subscription is charged monthly from StartDate through EndDate. When
+// EndDate passes the subscription expires, or with AutoRenew is extended by
+// a month.
 type Subscription struct {
-	ID        uuid.UUID  `json:"id"`
-	Service   Service    `json:"service"`
-	UserID    uuid.UUID  `json:"user_id"`
-	StartDate time.Time  `json:"start_date"`
-	EndDate   *time.Time `json:"end_date,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID        uuid.UUID          `json:"id"`
+	Service   Service            `json:"service"`
+	UserID    uuid.UUID          `json:"user_id"`
+	Status    SubscriptionStatus `json:"status"`
+	StartDate time.Time          `json:"start_date"`
+	EndDate   *time.Time         `json:"end_date,omitempty"`
+	TrialEnd  *time.Time         `json:"trial_end,omitempty"`
+	Discount  *Discount          `json:"discount,omitempty"`
+	AutoRenew bool               `json:"auto_renew"`
+	Notes     string             `json:"notes,omitempty"`
+	// Metadata holds data of the client, such as an external order ID.
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	// Overlaps are the subscriptions the period overlapped when it was saved
+	// under OverlapWarn.
+	Overlaps []uuid.UUID `json:"overlaps,omitempty"`
+	// OverlapPolicy is applied when the subscription is saved, the zero
+	// value rejects overlaps.
+	OverlapPolicy OverlapPolicy `json:"-"`
+}
+
+// SubscriptionSearch is a fuzzy search over service names and subscription
+// notes. A nil UserID searches the subscriptions of all users.
+type SubscriptionSearch struct {
+	Query  string
+	UserID *uuid.UUID
+}
+
+// SubscriptionMatch is a search hit. A higher Score is a closer match.
+type SubscriptionMatch struct {
+	Subscription Subscription `json:"subscription"`
+	Score        float64      `json:"score"`
+}
+
+// SubscriptionFilter selects subscriptions in listings. Nil and empty fields
+// do not filter; date bounds are months and inclusive, except the creation
+// bounds, which are UTC days. UserID scopes listings of a single user.
+type SubscriptionFilter struct {
+	UserID uuid.UUID
+	// ActiveOnly leaves out paused, cancelled and expired subscriptions and
+	// those whose end date has passed.
+	ActiveOnly        bool
+	ServiceName       *string
+	ServiceNamePrefix *string
+	MinPrice          *int
+	MaxPrice          *int
+	// ActiveOn keeps subscriptions that run in this month.
+	ActiveOn    *time.Time
+	StartedFrom *time.Time
+	StartedTo   *time.Time
+	EndedFrom   *time.Time
+	EndedTo     *time.Time
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Statuses    []SubscriptionStatus
+	Category    *string
+	// Metadata keeps subscriptions matching every one of the filters.
+	Metadata []MetadataFilter
+}
+
+// MetadataFilter keeps subscriptions whose metadata has Key, with Value when
+// it is not nil.
+type MetadataFilter struct {
+	Key   string
+	Value *string
+}
+
+type SubscriptionSortField string
+
+const (
+	SortByStartDate   SubscriptionSortField = "start_date"
+	SortByCreatedAt   SubscriptionSortField = "created_at"
+	SortByPrice       SubscriptionSortField = "price"
+	SortByServiceName SubscriptionSortField = "service_name"
+)
+
+// SubscriptionSort orders a listing. The zero value sorts by start date,
+// newest first.
+type SubscriptionSort struct {
+	Field SubscriptionSortField
+	Asc   bool
+}
+
+// IsDefault reports whether the sort is the order cursors are built on.
+func (s SubscriptionSort) IsDefault() bool {
+	return (s.Field == "" || s.Field == SortByStartDate) && !s.Asc
+}
+
+// NetPriceIn returns the price charged for month after the trial and discount.
+func (s Subscription) NetPriceIn(month time.Time) int {
+	return NetPrice(s.Service.Price, s.StartDate, s.TrialEnd, s.Discount, month)
+}
+
+// SubscriptionCursor is a position in a listing ordered by start date and ID,
+// newest first.
+type SubscriptionCursor struct {
+	StartDate time.Time
+	ID        uuid.UUID
+	// Backward selects the page before the position instead of after it.
+	Backward bool
+}
+
+// CursorOf returns the position of the subscription in a listing.
+func (s Subscription) CursorOf() SubscriptionCursor {
+	return SubscriptionCursor{StartDate: s.StartDate, ID: s.ID}
+}
+
+// SubscriptionList is a page of an offset listing. Total is nil when counting
+// was skipped.
+type SubscriptionList struct {
+	Items   []Subscription
+	Total   *int
+	HasMore bool
+}
+
+// SubscriptionPage is a page of a cursor listing. Next and Prev are nil when
+// there is nothing after or before the page.
+type SubscriptionPage struct {
+	Items []Subscription
+	Next  *SubscriptionCursor
+	Prev  *SubscriptionCursor
+}
+
+// StatusChange describes a lifecycle transition. Only the non-nil dates are applied.
+type StatusChange struct {
+	From SubscriptionStatus
+	To   SubscriptionStatus
+	// PausedFrom opens a pause starting with this month.
+	PausedFrom *time.Time
+	// ResumedFrom closes the open pause; this month is charged again.
+	ResumedFrom *time.Time
+	// EndDate becomes the last charged month unless the subscription already ends earlier.
+	EndDate *time.Time
 }
@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubscriptionPause is a period in which a subscription was not charged.
+type SubscriptionPause struct {
+	SubscriptionID uuid.UUID  `json:"subscription_id"`
+	PausedFrom     time.Time  `json:"paused_from"`
+	ResumedFrom    *time.Time `json:"resumed_from,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// SentReminder is a reminder email that was sent.
+type SentReminder struct {
+	Reminder
+	SentAt time.Time `json:"sent_at"`
+}
+
+// UserData is everything stored about a user, as handed out on a subject
+// access request. Webhook secrets and the calendar feed token are
+// credentials rather than data about the user and are left out.
+type UserData struct {
+	UserID                  uuid.UUID                `json:"user_id"`
+	ExportedAt              time.Time                `json:"exported_at"`
+	Subscriptions           []Subscription           `json:"subscriptions"`
+	Pauses                  []SubscriptionPause      `json:"pauses"`
+	Events                  []OutboxEvent            `json:"events"`
+	MonthlyCosts            []CostBreakdownItem      `json:"monthly_costs"`
+	Budgets                 []Budget                 `json:"budgets"`
+	BudgetAlerts            []BudgetAlert            `json:"budget_alerts"`
+	NotificationPreferences *NotificationPreferences `json:"notification_preferences,omitempty"`
+	Reminders               []SentReminder           `json:"reminders"`
+	Webhooks                []WebhookEndpoint        `json:"webhooks"`
+	WebhookDeliveries       []WebhookDelivery        `json:"webhook_deliveries"`
+	CalendarFeedCreatedAt   *time.Time               `json:"calendar_feed_created_at,omitempty"`
+	// Erasures are earlier erasures of the user's data.
+	Erasures []UserErasure `json:"erasures"`
+}
+
+// UserErasure is the tombstone of an erasure of a user's data. It keeps a
+// hash of the user ID instead of the ID, which proves the erasure to anyone
+// who knows the ID.
+type UserErasure struct {
+	ID         uuid.UUID `json:"id"`
+	UserIDHash string    `json:"user_id_hash"`
+	// Reference identifies the erasure request, e.g. a ticket number.
+	Reference string `json:"reference,omitempty"`
+	// Deleted is the number of deleted rows by table.
+	Deleted  map[string]int `json:"deleted"`
+	ErasedAt time.Time      `json:"erased_at"`
+}
+
+// UserIDHash is the hex SHA-256 of the user ID, as kept in erasure tombstones.
+func UserIDHash(userID uuid.UUID) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(userID.String())))
+}
@@ -0,0 +1,158 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+)
+
+type NATSSettings struct {
+	URL string
+	// Stream is the JetStream stream that captures SubjectPrefix.>, it is
+	// created on the first publish if it does not exist.
+	Stream        string
+	SubjectPrefix string
+	// Tenant is the platform tenant this deployment serves, the second
+	// segment of every subject.
+	Tenant string
+	// DuplicateWindow is how long JetStream remembers event IDs to drop
+	// events the relay publishes again.
+	DuplicateWindow time.Duration
+	PublishTimeout  time.Duration
+}
+
+// NATSPublisher sends outbox events to JetStream subjects
+// <prefix>.<tenant>.<event>, e.g. subscriptions.acme.created, with the owner
+// of the subscription in the User-Id header. While NATS is unavailable
+// Publish fails fast with service.ErrPublisherUnavailable and the events wait
+// in the outbox.
+type NATSPublisher struct {
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	settings NATSSettings
+
+	mu            sync.Mutex
+	streamEnsured bool
+}
+
+// NewNATSPublisher connects to NATS. An unreachable server is not an error,
+// the connection keeps retrying in the background.
+func NewNATSPublisher(settings NATSSettings) (*NATSPublisher, error) {
+	if settings.Stream == "" {
+		settings.Stream = "SUBSCRIPTIONS"
+	}
+	if settings.SubjectPrefix == "" {
+		settings.SubjectPrefix = "subscriptions"
+	}
+	if settings.Tenant == "" {
+		settings.Tenant = "default"
+	}
+	if strings.ContainsAny(settings.Tenant, ".*> \t") {
+		return nil, fmt.Errorf("NATSPublisher - tenant %q is not a valid subject token", settings.Tenant)
+	}
+	if settings.DuplicateWindow <= 0 {
+		settings.DuplicateWindow = 24 * time.Hour
+	}
+	if settings.PublishTimeout <= 0 {
+		settings.PublishTimeout = 5 * time.Second
+	}
+
+	conn, err := nats.Connect(settings.URL,
+		nats.Name("subscription-service"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Warnf("NATSPublisher - disconnected: %v", err)
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.Infof("NATSPublisher - connected to %s", c.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("NATSPublisher - connect: %v", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("NATSPublisher - jetstream: %v", err)
+	}
+
+	return &NATSPublisher{conn: conn, js: js, settings: settings}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event entity.OutboxEvent) error {
+	if !p.conn.IsConnected() {
+		return fmt.Errorf("NATSPublisher.Publish - %w: %v", service.ErrPublisherUnavailable, nats.ErrConnectionClosed)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.settings.PublishTimeout)
+	defer cancel()
+
+	if err := p.ensureStream(ctx); err != nil {
+		return fmt.Errorf("NATSPublisher.Publish - %w", unavailable(err))
+	}
+
+	subject := p.subject(event)
+	msg := nats.NewMsg(subject)
+	msg.Data = event.Payload
+	msg.Header.Set("Event-Type", string(event.Type))
+	msg.Header.Set("User-Id", event.UserID.String())
+	if _, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(event.ID.String())); err != nil {
+		return fmt.Errorf("NATSPublisher.Publish - publish to %s: %w", subject, unavailable(err))
+	}
+	return nil
+}
+
+// unavailable marks errors of a lost connection or a missing JetStream as
+// service.ErrPublisherUnavailable, the event itself is not at fault.
+func unavailable(err error) error {
+	if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrDisconnected) ||
+		errors.Is(err, nats.ErrConnectionReconnecting) || errors.Is(err, nats.ErrNoResponders) ||
+		errors.Is(err, jetstream.ErrJetStreamNotEnabled) || errors.Is(err, jetstream.ErrNoStreamResponse) {
+		return fmt.Errorf("%w: %v", service.ErrPublisherUnavailable, err)
+	}
+	return err
+}
+
+// subject builds <prefix>.<tenant>.<event> with the event name without its
+// aggregate prefix, so subscription.created becomes created.
+func (p *NATSPublisher) subject(event entity.OutboxEvent) string {
+	name := strings.TrimPrefix(string(event.Type), event.AggregateType+".")
+	return fmt.Sprintf("%s.%s.%s", p.settings.SubjectPrefix, p.settings.Tenant, name)
+}
+
+func (p *NATSPublisher) ensureStream(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.streamEnsured {
+		return nil
+	}
+
+	_, err := p.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       p.settings.Stream,
+		Subjects:   []string{p.settings.SubjectPrefix + ".>"},
+		Duplicates: p.settings.DuplicateWindow,
+	})
+	if err != nil {
+		return fmt.Errorf("ensure stream %s: %w", p.settings.Stream, err)
+	}
+	p.streamEnsured = true
+	return nil
+}
+
+// Close flushes pending messages and closes the connection.
+func (p *NATSPublisher) Close() {
+	if err := p.conn.Drain(); err != nil {
+		p.conn.Close()
+	}
+}
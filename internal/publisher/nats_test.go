@@ -0,0 +1,128 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runServer starts an in-process nats-server with JetStream on a random port.
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("nats-server: %v", err)
+	}
+	srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats-server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func testEvent() entity.OutboxEvent {
+	return entity.OutboxEvent{
+		ID:            uuid.New(),
+		AggregateType: "subscription",
+		AggregateID:   uuid.New(),
+		UserID:        uuid.New(),
+		Type:          entity.EventSubscriptionCreated,
+		Payload:       []byte(`{"type":"subscription.created"}`),
+	}
+}
+
+func TestNATSPublisherPublishesToTenantSubject(t *testing.T) {
+	srv := runServer(t)
+	ctx := context.Background()
+
+	p, err := NewNATSPublisher(NATSSettings{URL: srv.ClientURL(), Tenant: "acme", PublishTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewNATSPublisher: %v", err)
+	}
+	defer p.Close()
+
+	event := testEvent()
+	for range 2 {
+		if err := p.Publish(ctx, event); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	stream, err := js.Stream(ctx, "SUBSCRIPTIONS")
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("stream holds %d messages, want the duplicate dropped", info.State.Msgs)
+	}
+
+	msg, err := stream.GetLastMsgForSubject(ctx, "subscriptions.acme.created")
+	if err != nil {
+		t.Fatalf("no message on subscriptions.acme.created: %v", err)
+	}
+	if string(msg.Data) != string(event.Payload) {
+		t.Errorf("message body %q, want %q", msg.Data, event.Payload)
+	}
+	if got := msg.Header.Get("User-Id"); got != event.UserID.String() {
+		t.Errorf("User-Id = %q, want %s", got, event.UserID)
+	}
+	if got := msg.Header.Get("Event-Type"); got != string(event.Type) {
+		t.Errorf("Event-Type = %q, want %s", got, event.Type)
+	}
+}
+
+func TestNATSPublisherFailsFastWhileUnavailable(t *testing.T) {
+	srv := runServer(t)
+	url := srv.ClientURL()
+	srv.Shutdown()
+
+	p, err := NewNATSPublisher(NATSSettings{URL: url, PublishTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewNATSPublisher with the server down: %v", err)
+	}
+	defer p.Close()
+
+	start := time.Now()
+	err = p.Publish(context.Background(), testEvent())
+	if !errors.Is(err, service.ErrPublisherUnavailable) {
+		t.Fatalf("Publish without a server = %v, want ErrPublisherUnavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Publish took %v, want it to fail fast", elapsed)
+	}
+}
+
+func TestNATSPublisherRejectsInvalidTenant(t *testing.T) {
+	if _, err := NewNATSPublisher(NATSSettings{URL: "nats://127.0.0.1:1", Tenant: "acme.eu"}); err == nil {
+		t.Error("NewNATSPublisher accepted a tenant with a dot")
+	}
+}
@@ -0,0 +1,317 @@
+package pgdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type AnalyticsRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewAnalyticsRepo(pg *pgxpool.Pool) *AnalyticsRepo {
+	return &AnalyticsRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// A subscription is active in a month when it started in or before that month,
+// has no end date or ends in or after it, and is not paused. Movements are
+// tracked per (user, service name) pair, so a price change of the same service
+// is not reported as churn followed by a new subscription.
+var monthlyMRRQuery = `
+WITH months AS (
+    SELECT gs.month::date AS month
+    FROM generate_series($1::date - interval '1 month', $2::date, interval '1 month') AS gs(month)
+),
+active AS (
+    SELECT m.month, s.user_id, svc.name AS service_name, SUM(svc.price) AS amount
+    FROM months m
+    JOIN subscriptions s
+        ON date_trunc('month', s.start_date) <= m.month
+        AND (s.end_date IS NULL OR s.end_date >= m.month)
+        AND ` + notPausedIn("m.month") + `
+    JOIN services svc ON svc.id = s.service_id
+    GROUP BY m.month, s.user_id, svc.name
+),
+first_months AS (
+    SELECT s.user_id, svc.name AS service_name, MIN(date_trunc('month', s.start_date))::date AS first_month
+    FROM subscriptions s
+    JOIN services svc ON svc.id = s.service_id
+    GROUP BY s.user_id, svc.name
+),
+gains AS (
+    SELECT cur.month,
+        SUM(cur.amount) AS mrr,
+        COUNT(*) AS active_count,
+        SUM(cur.amount) FILTER (WHERE prev.user_id IS NULL AND fm.first_month = cur.month) AS new_mrr,
+        SUM(cur.amount) FILTER (WHERE prev.user_id IS NULL AND fm.first_month < cur.month) AS reactivated_mrr
+    FROM active cur
+    LEFT JOIN active prev
+        ON prev.month = (cur.month - interval '1 month')::date
+        AND prev.user_id = cur.user_id
+        AND prev.service_name = cur.service_name
+    JOIN first_months fm ON fm.user_id = cur.user_id AND fm.service_name = cur.service_name
+    GROUP BY cur.month
+),
+losses AS (
+    SELECT (prev.month + interval '1 month')::date AS month, SUM(prev.amount) AS churned_mrr
+    FROM active prev
+    LEFT JOIN active cur
+        ON cur.month = (prev.month + interval '1 month')::date
+        AND cur.user_id = prev.user_id
+        AND cur.service_name = prev.service_name
+    WHERE cur.user_id IS NULL
+    GROUP BY 1
+)
+SELECT m.month,
+    COALESCE(g.mrr, 0),
+    COALESCE(g.new_mrr, 0),
+    COALESCE(l.churned_mrr, 0),
+    COALESCE(g.reactivated_mrr, 0),
+    COALESCE(g.active_count, 0)
+FROM months m
+LEFT JOIN gains g ON g.month = m.month
+LEFT JOIN losses l ON l.month = m.month
+WHERE m.month >= $1::date
+ORDER BY m.month`
+
+func (r *AnalyticsRepo) GetMonthlyMRR(ctx context.Context, startDate, endDate time.Time) ([]entity.MonthlyMRR, error) {
+	rows, err := r.pool.Query(ctx, monthlyMRRQuery, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("AnalyticsRepo.GetMonthlyMRR - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var result []entity.MonthlyMRR
+	for rows.Next() {
+		var m entity.MonthlyMRR
+		if err := rows.Scan(&m.Month, &m.MRR, &m.NewMRR, &m.ChurnedMRR, &m.ReactivatedMRR, &m.ActiveCount); err != nil {
+			return nil, fmt.Errorf("AnalyticsRepo.GetMonthlyMRR - row scan: %v", err)
+		}
+		result = append(result, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("AnalyticsRepo.GetMonthlyMRR - rows error: %v", err)
+	}
+
+	return result, nil
+}
+
+// A cohort is the month of the first subscription of a user to a service;
+// period N counts cohort members with an active subscription N months later.
+var retentionCohortsQuery = `
+WITH firsts AS (
+    SELECT s.user_id, svc.name AS service_name, MIN(date_trunc('month', s.start_date))::date AS cohort
+    FROM subscriptions s
+    JOIN services svc ON svc.id = s.service_id
+    WHERE ($3::text IS NULL OR svc.name = $3::text)
+    GROUP BY s.user_id, svc.name
+),
+periods AS (
+    SELECT f.service_name, f.cohort, gs.month::date AS month,
+        EXISTS (
+            SELECT 1
+            FROM subscriptions s
+            JOIN services svc ON svc.id = s.service_id
+            WHERE s.user_id = f.user_id
+                AND svc.name = f.service_name
+                AND date_trunc('month', s.start_date) <= gs.month
+                AND (s.end_date IS NULL OR s.end_date >= gs.month)
+                AND ` + notPausedIn("gs.month") + `
+        ) AS active
+    FROM firsts f
+    CROSS JOIN LATERAL generate_series(f.cohort, $2::date, interval '1 month') AS gs(month)
+    WHERE f.cohort BETWEEN $1::date AND $2::date
+)
+SELECT service_name, cohort,
+    ((EXTRACT(YEAR FROM month) - EXTRACT(YEAR FROM cohort)) * 12
+        + EXTRACT(MONTH FROM month) - EXTRACT(MONTH FROM cohort))::int AS period,
+    COUNT(*) AS size,
+    COUNT(*) FILTER (WHERE active) AS retained
+FROM periods
+GROUP BY service_name, cohort, period
+ORDER BY service_name, cohort, period`
+
+func (r *AnalyticsRepo) GetRetentionCohorts(
+	ctx context.Context,
+	serviceName *string,
+	startDate, endDate time.Time,
+) ([]entity.RetentionCohort, error) {
+	rows, err := r.pool.Query(ctx, retentionCohortsQuery, startDate, endDate, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("AnalyticsRepo.GetRetentionCohorts - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var cohorts []entity.RetentionCohort
+	for rows.Next() {
+		var (
+			name     string
+			cohort   time.Time
+			period   int
+			size     int
+			retained int
+		)
+		if err := rows.Scan(&name, &cohort, &period, &size, &retained); err != nil {
+			return nil, fmt.Errorf("AnalyticsRepo.GetRetentionCohorts - row scan: %v", err)
+		}
+
+		last := len(cohorts) - 1
+		if last < 0 || cohorts[last].ServiceName != name || !cohorts[last].Cohort.Equal(cohort) {
+			cohorts = append(cohorts, entity.RetentionCohort{
+				ServiceName: name,
+				Cohort:      cohort,
+				Size:        size,
+			})
+			last++
+		}
+		cohorts[last].Retained = append(cohorts[last].Retained, retained)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("AnalyticsRepo.GetRetentionCohorts - rows error: %v", err)
+	}
+
+	return cohorts, nil
+}
+
+// activeMonths selects one row per subscription and month of the period in
+// which it is active and not paused, so summing prices charges every such
+// month once.
+func activeMonths(psql squirrel.StatementBuilderType, startDate, endDate time.Time) squirrel.SelectBuilder {
+	return psql.
+		Select().
+		Prefix("WITH months AS (SELECT gs.month::date AS month FROM generate_series(?::date, ?::date, interval '1 month') AS gs(month))", startDate, endDate).
+		From("months m").
+		Join("subscriptions s ON date_trunc('month', s.start_date) <= m.month AND (s.end_date IS NULL OR s.end_date >= m.month) AND " + notPausedIn("m.month")).
+		Join("services svc ON svc.id = s.service_id")
+}
+
+// countActive counts the distinct values of column among activeMonths. The
+// rankings take their total by a window function, which leaves a page past
+// the end without rows to carry it; that page is counted with this instead.
+func (r *AnalyticsRepo) countActive(ctx context.Context, column string, startDate, endDate time.Time) (int, error) {
+	sql, args, err := activeMonths(r.psql, startDate, endDate).
+		Columns("COUNT(DISTINCT " + column + ")").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("sql build: %v", err)
+	}
+
+	var total int
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("query exec: %v", err)
+	}
+	return total, nil
+}
+
+func (r *AnalyticsRepo) GetTopServices(
+	ctx context.Context,
+	orderBy entity.ServiceRankingMetric,
+	startDate, endDate time.Time,
+	offset, limit int,
+) ([]entity.ServiceRanking, int, error) {
+	order := "subscribers DESC"
+	if orderBy == entity.RankByRevenue {
+		order = "revenue DESC"
+	}
+
+	sql, args, err := activeMonths(r.psql, startDate, endDate).
+		Columns("svc.name", "COUNT(DISTINCT s.user_id) AS subscribers", "SUM(svc.price) AS revenue", "COUNT(*) OVER ()").
+		GroupBy("svc.name").
+		OrderBy(order, "svc.name").
+		Offset(uint64(offset)).
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopServices - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopServices - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var (
+		ranking []entity.ServiceRanking
+		total   int
+	)
+	for rows.Next() {
+		var item entity.ServiceRanking
+		if err := rows.Scan(&item.ServiceName, &item.Subscribers, &item.Revenue, &total); err != nil {
+			return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopServices - row scan: %v", err)
+		}
+		ranking = append(ranking, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopServices - rows error: %v", err)
+	}
+
+	if len(ranking) == 0 && offset > 0 {
+		total, err = r.countActive(ctx, "svc.name", startDate, endDate)
+		if err != nil {
+			return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopServices - count: %v", err)
+		}
+	}
+
+	return ranking, total, nil
+}
+
+func (r *AnalyticsRepo) GetTopUsers(
+	ctx context.Context,
+	startDate, endDate time.Time,
+	offset, limit int,
+) ([]entity.UserSpend, int, error) {
+	sql, args, err := activeMonths(r.psql, startDate, endDate).
+		Columns("s.user_id", "SUM(svc.price) AS spend", "COUNT(DISTINCT s.id)", "COUNT(*) OVER ()").
+		GroupBy("s.user_id").
+		OrderBy("spend DESC", "s.user_id").
+		Offset(uint64(offset)).
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopUsers - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopUsers - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var (
+		ranking []entity.UserSpend
+		total   int
+	)
+	for rows.Next() {
+		var item entity.UserSpend
+		if err := rows.Scan(&item.UserID, &item.Spend, &item.Subscriptions, &total); err != nil {
+			return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopUsers - row scan: %v", err)
+		}
+		ranking = append(ranking, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopUsers - rows error: %v", err)
+	}
+
+	if len(ranking) == 0 && offset > 0 {
+		total, err = r.countActive(ctx, "s.user_id", startDate, endDate)
+		if err != nil {
+			return nil, 0, fmt.Errorf("AnalyticsRepo.GetTopUsers - count: %v", err)
+		}
+	}
+
+	return ranking, total, nil
+}
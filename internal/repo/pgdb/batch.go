@@ -0,0 +1,578 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// errBatchRollback rolls back the transaction of an atomic batch in which an
+// item failed. The per-item errors are still reported.
+var errBatchRollback = errors.New("batch rolled back")
+
+// batchReader reads the results of the statements one batch item queued, in
+// the order they were queued. A reader that fails an item for a reason other
+// than a failed statement, e.g. a row count, must read all of its results
+// first: the statements after it have run by then.
+type batchReader func(br pgx.BatchResults) error
+
+// queueQueries queues queries and returns a reader that executes them.
+func queueQueries(b *pgx.Batch, queries ...batchQuery) batchReader {
+	for _, query := range queries {
+		b.Queue(query.sql, query.args...)
+	}
+	return func(br pgx.BatchResults) error {
+		for range queries {
+			if _, err := br.Exec(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// runBatchItems sends the statements queue queues for each of the items in
+// pending as one pgx batch. In atomic mode the first failing item stops the
+// batch. Otherwise every item runs under a savepoint: an item with a failed
+// statement is rolled back alone and the items after it, which the server
+// skipped, are sent again. The returned slice holds the error of each item
+// in pending.
+func runBatchItems(
+	ctx context.Context,
+	tx pgx.Tx,
+	pending []int,
+	atomic bool,
+	queue func(b *pgx.Batch, i int) (batchReader, error),
+) ([]error, error) {
+	errs := make([]error, len(pending))
+	for start := 0; start < len(pending); {
+		b := &pgx.Batch{}
+		readers := make([]batchReader, 0, len(pending)-start)
+		for _, i := range pending[start:] {
+			if !atomic {
+				b.Queue("SAVEPOINT batch_item")
+			}
+			read, err := queue(b, i)
+			if err != nil {
+				return nil, err
+			}
+			readers = append(readers, read)
+			if !atomic {
+				b.Queue("RELEASE SAVEPOINT batch_item")
+			}
+		}
+
+		itemErrs, failed, err := readBatch(tx.SendBatch(ctx, b), readers, atomic)
+		if err != nil {
+			return nil, err
+		}
+		copy(errs[start:], itemErrs)
+		if failed < 0 || atomic {
+			return errs, nil
+		}
+		if _, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+			return nil, fmt.Errorf("rollback item: %v", err)
+		}
+		start += failed + 1
+	}
+	return errs, nil
+}
+
+// readBatch reads the results of readers and returns the error of each item
+// read and the index of the item with a failed statement, or -1 when no
+// statement failed. The server skips the rest of the batch after a failed
+// statement, so reading stops there; an item failed by its reader alone is
+// not rolled back and reading goes on.
+func readBatch(br pgx.BatchResults, readers []batchReader, atomic bool) (itemErrs []error, failed int, err error) {
+	defer br.Close()
+
+	itemErrs = make([]error, len(readers))
+	for k, read := range readers {
+		if !atomic {
+			if _, err := br.Exec(); err != nil {
+				return nil, 0, fmt.Errorf("savepoint: %v", err)
+			}
+		}
+		if err := read(br); err != nil {
+			itemErrs[k] = batchItemError(err)
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) || atomic {
+				return itemErrs, k, nil
+			}
+		}
+		if !atomic {
+			if _, err := br.Exec(); err != nil {
+				return nil, 0, fmt.Errorf("release savepoint: %v", err)
+			}
+		}
+	}
+	return itemErrs, -1, nil
+}
+
+// batchItemError turns a database error of a batch item into a repoerrs
+// sentinel where one applies.
+func batchItemError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return repoerrs.ErrAlreadyExists
+		case exclusionViolation:
+			// Another transaction saved the overlapped subscription, so it
+			// cannot be named from here.
+			return &repoerrs.OverlapError{}
+		}
+	}
+	return err
+}
+
+// batchFailed reports whether any item of a batch failed.
+func batchFailed(results []entity.BatchItemResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// period is the span of months a subscription is charged for.
+type period struct {
+	start time.Time
+	end   *time.Time
+}
+
+// invalidatePeriods marks every closed month touched by periods as stale,
+// with a single statement covering all of them.
+func invalidatePeriods(ctx context.Context, q querier, periods []period) error {
+	if len(periods) == 0 {
+		return nil
+	}
+	from, to := periods[0].start, periods[0].end
+	for _, p := range periods[1:] {
+		if p.start.Before(from) {
+			from = p.start
+		}
+		if to != nil && (p.end == nil || p.end.After(*to)) {
+			to = p.end
+		}
+	}
+	return invalidateMonthlyCosts(ctx, q, from, to)
+}
+
+// resolveServices points every subscription at its service, creating
+// missing ones, and loads the categories the services are stored with.
+func (r *SubscriptionRepo) resolveServices(ctx context.Context, q querier, subs []*entity.Subscription) error {
+	type serviceKey struct {
+		name  string
+		price int
+	}
+	resolved := make(map[serviceKey]uuid.UUID)
+	var ids []uuid.UUID
+	for _, sub := range subs {
+		key := serviceKey{sub.Service.Name, sub.Service.Price}
+		id, ok := resolved[key]
+		if !ok {
+			var err error
+			id, err = r.getOrCreateService(ctx, q, sub.Service)
+			if err != nil {
+				return err
+			}
+			resolved[key] = id
+			ids = append(ids, id)
+		}
+		sub.Service.ID = id
+	}
+
+	rows, err := q.Query(ctx, "SELECT id, COALESCE(category, '') FROM services WHERE id = ANY($1)", ids)
+	if err != nil {
+		return fmt.Errorf("service categories: %v", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[uuid.UUID]string, len(ids))
+	for rows.Next() {
+		var (
+			id       uuid.UUID
+			category string
+		)
+		if err := rows.Scan(&id, &category); err != nil {
+			return fmt.Errorf("service categories scan: %v", err)
+		}
+		categories[id] = category
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("service categories rows: %v", err)
+	}
+
+	for _, sub := range subs {
+		sub.Service.Category = categories[sub.Service.ID]
+	}
+	return nil
+}
+
+// CreateSubscriptions inserts subs in one transaction and returns the
+// outcome of each. In atomic mode nothing is committed when an item fails.
+func (r *SubscriptionRepo) CreateSubscriptions(ctx context.Context, subs []entity.Subscription, atomic bool) ([]entity.BatchItemResult, error) {
+	results := make([]entity.BatchItemResult, len(subs))
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		now := time.Now().UTC()
+		ptrs := make([]*entity.Subscription, len(subs))
+		for i := range subs {
+			subs[i].ID, subs[i].CreatedAt = uuid.New(), now
+			results[i].ID = subs[i].ID
+			ptrs[i] = &subs[i]
+		}
+		if err := r.resolveServices(ctx, tx, ptrs); err != nil {
+			return err
+		}
+
+		exempt, overlapErrs, err := applyOverlapPolicy(ctx, tx, ptrs)
+		if err != nil {
+			return err
+		}
+		var pending []int
+		for i, err := range overlapErrs {
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			pending = append(pending, i)
+		}
+		if atomic && batchFailed(results) {
+			return errBatchRollback
+		}
+
+		errs, err := runBatchItems(ctx, tx, pending, atomic, func(b *pgx.Batch, i int) (batchReader, error) {
+			sub := subs[i]
+			discountType, discountValue, discountMonths, promoCode := discountValues(sub.Discount)
+			sql, args, err := r.psql.
+				Insert("subscriptions").
+				Columns(
+					"id", "service_id", "service_name", "user_id", "status", "start_date", "end_date", "trial_end",
+					"discount_type", "discount_value", "discount_months", "promo_code", "auto_renew", "notes", "metadata",
+					"overlap_allowed", "created_at",
+				).
+				Values(
+					sub.ID, sub.Service.ID, sub.Service.Name, sub.UserID, sub.Status, sub.StartDate, sub.EndDate, sub.TrialEnd,
+					discountType, discountValue, discountMonths, promoCode, sub.AutoRenew, nullString(sub.Notes), metadataValue(sub.Metadata),
+					exempt[i], sub.CreatedAt,
+				).
+				ToSql()
+			if err != nil {
+				return nil, fmt.Errorf("subscription sql build: %v", err)
+			}
+			events, err := subscriptionEventQueries(entity.EventSubscriptionCreated, sub)
+			if err != nil {
+				return nil, err
+			}
+			return queueQueries(b, append([]batchQuery{{sql: sql, args: args}}, events...)...), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var periods []period
+		for k, i := range pending {
+			results[i].Err = errs[k]
+			if errs[k] == nil {
+				results[i].Overlaps = subs[i].Overlaps
+				periods = append(periods, period{subs[i].StartDate, subs[i].EndDate})
+			}
+		}
+		if atomic && batchFailed(results) {
+			return errBatchRollback
+		}
+		return invalidatePeriods(ctx, tx, periods)
+	})
+	if err != nil && !errors.Is(err, errBatchRollback) {
+		return nil, fmt.Errorf("SubscriptionRepo.CreateSubscriptions - %v", err)
+	}
+	return results, nil
+}
+
+// GetSubscriptionsByIDs returns the subscriptions among ids that exist.
+func (r *SubscriptionRepo) GetSubscriptionsByIDs(ctx context.Context, ids []uuid.UUID) ([]entity.Subscription, error) {
+	subscriptions, err := loadSubscriptions(ctx, r.pool, ids, false)
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionRepo.GetSubscriptionsByIDs - %v", err)
+	}
+	return subscriptions, nil
+}
+
+// loadSubscriptions reads the subscriptions among ids, locking them in ID
+// order when lock is set.
+func loadSubscriptions(ctx context.Context, q querier, ids []uuid.UUID, lock bool) ([]entity.Subscription, error) {
+	sql := "SELECT " + strings.Join(subscriptionColumns, ", ") + `
+		FROM subscriptions s
+		JOIN services svc ON s.service_id = svc.id
+		WHERE s.id = ANY($1)
+		ORDER BY s.id`
+	if lock {
+		sql += " FOR UPDATE OF s"
+	}
+	rows, err := q.Query(ctx, sql, ids)
+	if err != nil {
+		return nil, fmt.Errorf("load subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []entity.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("load subscriptions scan: %v", err)
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load subscriptions rows: %v", err)
+	}
+	return subscriptions, nil
+}
+
+// writeChangedEvents reloads the subscriptions with ids and writes an event
+// about the new state of each to the outbox in one round trip, in the order
+// of ids, as writeChangedEvent does for one subscription.
+func writeChangedEvents(ctx context.Context, tx pgx.Tx, eventType entity.EventType, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	loaded, err := loadSubscriptions(ctx, tx, ids, false)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]entity.Subscription, len(loaded))
+	for _, sub := range loaded {
+		byID[sub.ID] = sub
+	}
+
+	b := &pgx.Batch{}
+	readers := make([]batchReader, 0, len(ids))
+	for _, id := range ids {
+		sub, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("load subscriptions: %s: %w", id, repoerrs.ErrNotFound)
+		}
+		queries, err := subscriptionEventQueries(eventType, sub)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, queueQueries(b, queries...))
+	}
+	br := tx.SendBatch(ctx, b)
+	defer br.Close()
+	for _, read := range readers {
+		if err := read(br); err != nil {
+			return fmt.Errorf("write outbox event: %v", err)
+		}
+	}
+	return br.Close()
+}
+
+// UpdateSubscriptions stores the service, end date, auto-renewal, notes and
+// metadata of subs in one transaction and returns the outcome of each. In
+// atomic mode nothing is committed when an item fails.
+func (r *SubscriptionRepo) UpdateSubscriptions(ctx context.Context, subs []entity.Subscription, atomic bool) ([]entity.BatchItemResult, error) {
+	results := make([]entity.BatchItemResult, len(subs))
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		ids := make([]uuid.UUID, len(subs))
+		for i, sub := range subs {
+			ids[i], results[i].ID = sub.ID, sub.ID
+		}
+		locked, err := loadSubscriptions(ctx, tx, ids, true)
+		if err != nil {
+			return err
+		}
+		old := make(map[uuid.UUID]period, len(locked))
+		stored := make(map[uuid.UUID]*entity.Subscription, len(locked))
+		for k, sub := range locked {
+			old[sub.ID], stored[sub.ID] = period{sub.StartDate, sub.EndDate}, &locked[k]
+		}
+		storedExempt, err := exemptSubscriptions(ctx, tx, ids)
+		if err != nil {
+			return err
+		}
+
+		var (
+			pending []int
+			ptrs    []*entity.Subscription
+		)
+		for i := range subs {
+			if _, ok := old[subs[i].ID]; !ok {
+				results[i].Err = repoerrs.ErrNotFound
+				continue
+			}
+			pending, ptrs = append(pending, i), append(ptrs, &subs[i])
+		}
+		if atomic && batchFailed(results) {
+			return errBatchRollback
+		}
+		exempt := make([]bool, len(subs))
+		if len(ptrs) > 0 {
+			if err := r.resolveServices(ctx, tx, ptrs); err != nil {
+				return err
+			}
+			var (
+				checked []int
+				check   []*entity.Subscription
+			)
+			for _, i := range pending {
+				if storedExempt[subs[i].ID] && keepsExemption(stored[subs[i].ID], &subs[i]) {
+					exempt[i] = true
+					continue
+				}
+				checked, check = append(checked, i), append(check, &subs[i])
+			}
+			overlapExempt, overlapErrs, err := applyOverlapPolicy(ctx, tx, check)
+			if err != nil {
+				return err
+			}
+			for k, i := range checked {
+				if overlapErrs[k] != nil {
+					results[i].Err = overlapErrs[k]
+					continue
+				}
+				exempt[i] = overlapExempt[k]
+			}
+			pending = slices.DeleteFunc(pending, func(i int) bool { return results[i].Err != nil })
+			if atomic && batchFailed(results) {
+				return errBatchRollback
+			}
+		}
+
+		errs, err := runBatchItems(ctx, tx, pending, atomic, func(b *pgx.Batch, i int) (batchReader, error) {
+			sub := subs[i]
+			sql, args, err := r.psql.
+				Update("subscriptions").
+				Set("service_id", sub.Service.ID).
+				Set("service_name", sub.Service.Name).
+				Set("end_date", sub.EndDate).
+				Set("auto_renew", sub.AutoRenew).
+				Set("notes", nullString(sub.Notes)).
+				Set("metadata", metadataValue(sub.Metadata)).
+				Set("overlap_allowed", exempt[i]).
+				Where("id = ?", sub.ID).
+				ToSql()
+			if err != nil {
+				return nil, fmt.Errorf("subscription sql build: %v", err)
+			}
+			return queueQueries(b, batchQuery{sql: sql, args: args}), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var (
+			periods []period
+			updated []uuid.UUID
+		)
+		for k, i := range pending {
+			results[i].Err = errs[k]
+			if errs[k] == nil {
+				results[i].Overlaps = subs[i].Overlaps
+				periods = append(periods, old[subs[i].ID], period{subs[i].StartDate, subs[i].EndDate})
+				updated = append(updated, subs[i].ID)
+			}
+		}
+		if atomic && batchFailed(results) {
+			return errBatchRollback
+		}
+		if err := writeChangedEvents(ctx, tx, entity.EventSubscriptionUpdated, updated); err != nil {
+			return err
+		}
+		return invalidatePeriods(ctx, tx, periods)
+	})
+	if err != nil && !errors.Is(err, errBatchRollback) {
+		return nil, fmt.Errorf("SubscriptionRepo.UpdateSubscriptions - %v", err)
+	}
+	return results, nil
+}
+
+// DeleteSubscriptions deletes the subscriptions with ids in one transaction
+// and returns the outcome of each. In atomic mode nothing is committed when
+// an item fails.
+func (r *SubscriptionRepo) DeleteSubscriptions(ctx context.Context, ids []uuid.UUID, atomic bool) ([]entity.BatchItemResult, error) {
+	results := make([]entity.BatchItemResult, len(ids))
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		locked, err := loadSubscriptions(ctx, tx, ids, true)
+		if err != nil {
+			return err
+		}
+		// Events carry the last state of the subscriptions.
+		last := make(map[uuid.UUID]entity.Subscription, len(locked))
+		for _, sub := range locked {
+			last[sub.ID] = sub
+		}
+
+		// An ID given again is not found, as deleting it twice one by one
+		// would be.
+		var pending []int
+		queued := make(map[uuid.UUID]bool, len(ids))
+		for i, id := range ids {
+			results[i].ID = id
+			if _, ok := last[id]; !ok || queued[id] {
+				results[i].Err = repoerrs.ErrNotFound
+				continue
+			}
+			queued[id] = true
+			pending = append(pending, i)
+		}
+		if atomic && batchFailed(results) {
+			return errBatchRollback
+		}
+
+		errs, err := runBatchItems(ctx, tx, pending, atomic, func(b *pgx.Batch, i int) (batchReader, error) {
+			events, err := subscriptionEventQueries(entity.EventSubscriptionDeleted, last[ids[i]])
+			if err != nil {
+				return nil, err
+			}
+			b.Queue("DELETE FROM subscriptions WHERE id = $1", ids[i])
+			readEvents := queueQueries(b, events...)
+			return func(br pgx.BatchResults) error {
+				tag, err := br.Exec()
+				if err != nil {
+					return err
+				}
+				if err := readEvents(br); err != nil {
+					return err
+				}
+				// The rows are locked and each ID is queued once, so a miss
+				// is not expected.
+				if tag.RowsAffected() == 0 {
+					return repoerrs.ErrNotFound
+				}
+				return nil
+			}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var periods []period
+		for k, i := range pending {
+			results[i].Err = errs[k]
+			if errs[k] == nil {
+				sub := last[ids[i]]
+				periods = append(periods, period{sub.StartDate, sub.EndDate})
+			}
+		}
+		if atomic && batchFailed(results) {
+			return errBatchRollback
+		}
+		return invalidatePeriods(ctx, tx, periods)
+	})
+	if err != nil && !errors.Is(err, errBatchRollback) {
+		return nil, fmt.Errorf("SubscriptionRepo.DeleteSubscriptions - %v", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,211 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// scriptedResults replays command tags and errors of a batch in order.
+type scriptedResults struct {
+	pgx.BatchResults
+	results []scriptedResult
+	read    int
+}
+
+type scriptedResult struct {
+	tag pgconn.CommandTag
+	err error
+}
+
+func (s *scriptedResults) Exec() (pgconn.CommandTag, error) {
+	if s.read == len(s.results) {
+		return nil, errors.New("no more results")
+	}
+	r := s.results[s.read]
+	s.read++
+	return r.tag, r.err
+}
+
+func (s *scriptedResults) Close() error { return nil }
+
+func TestReadBatchKeepsReadingAfterRowCountFailure(t *testing.T) {
+	ok := scriptedResult{tag: pgconn.CommandTag("OK")}
+	deleted := scriptedResult{tag: pgconn.CommandTag("DELETE 1")}
+	missed := scriptedResult{tag: pgconn.CommandTag("DELETE 0")}
+	read := func(br pgx.BatchResults) error {
+		tag, err := br.Exec()
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repoerrs.ErrNotFound
+		}
+		return nil
+	}
+
+	// savepoint, delete, release for each of three items; the second one
+	// misses, which fails it without a failed statement.
+	br := &scriptedResults{results: []scriptedResult{ok, deleted, ok, ok, missed, ok, ok, deleted, ok}}
+	errs, failed, err := readBatch(br, []batchReader{read, read, read}, false)
+	if err != nil {
+		t.Fatalf("readBatch: %v", err)
+	}
+	if failed != -1 {
+		t.Errorf("failed = %d, want -1: no statement failed and no savepoint must be rolled back", failed)
+	}
+	if errs[0] != nil || !errors.Is(errs[1], repoerrs.ErrNotFound) || errs[2] != nil {
+		t.Errorf("item errors %v, want only the second not found", errs)
+	}
+	if br.read != len(br.results) {
+		t.Errorf("read %d of %d results", br.read, len(br.results))
+	}
+
+	// A failed statement stops reading, the server skipped the rest.
+	br = &scriptedResults{results: []scriptedResult{ok, deleted, ok, ok, {err: &pgconn.PgError{Code: "23503"}}}}
+	errs, failed, err = readBatch(br, []batchReader{read, read, read}, false)
+	if err != nil {
+		t.Fatalf("readBatch: %v", err)
+	}
+	if failed != 1 || errs[1] == nil {
+		t.Errorf("failed = %d with errors %v, want the second item failed", failed, errs)
+	}
+}
+
+// createTestSubscriptions saves subscriptions to different services of one
+// user, so they do not overlap.
+func createTestSubscriptions(t *testing.T, r *SubscriptionRepo, names ...string) []uuid.UUID {
+	t.Helper()
+	userID := uuid.New()
+	subs := make([]entity.Subscription, len(names))
+	for i, name := range names {
+		subs[i] = entity.Subscription{
+			Service:   entity.Service{Name: name, Price: 100},
+			UserID:    userID,
+			Status:    entity.StatusActive,
+			StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	results, err := r.CreateSubscriptions(context.Background(), subs, true)
+	if err != nil {
+		t.Fatalf("CreateSubscriptions: %v", err)
+	}
+	ids := make([]uuid.UUID, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatalf("CreateSubscriptions item %d: %v", i, result.Err)
+		}
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestDeleteSubscriptionsDuplicateID(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepo(pool)
+
+	t.Run("best effort", func(t *testing.T) {
+		ids := createTestSubscriptions(t, r, "Netflix", "Spotify")
+		results, err := r.DeleteSubscriptions(ctx, []uuid.UUID{ids[0], ids[0], ids[1]}, false)
+		if err != nil {
+			t.Fatalf("DeleteSubscriptions: %v", err)
+		}
+		for i, want := range []error{nil, repoerrs.ErrNotFound, nil} {
+			if !errors.Is(results[i].Err, want) {
+				t.Errorf("item %d: %v, want %v", i, results[i].Err, want)
+			}
+		}
+		if left, _ := r.GetSubscriptionsByIDs(ctx, ids); len(left) != 0 {
+			t.Errorf("%d subscriptions left after the delete", len(left))
+		}
+
+		var events int
+		if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM outbox_events WHERE event_type = $1 AND aggregate_id = ANY($2)",
+			string(entity.EventSubscriptionDeleted), ids).Scan(&events); err != nil {
+			t.Fatalf("count events: %v", err)
+		}
+		if events != 2 {
+			t.Errorf("%d delete events, want one per subscription", events)
+		}
+	})
+
+	t.Run("atomic", func(t *testing.T) {
+		ids := createTestSubscriptions(t, r, "Netflix", "Spotify")
+		results, err := r.DeleteSubscriptions(ctx, []uuid.UUID{ids[0], ids[1], ids[0]}, true)
+		if err != nil {
+			t.Fatalf("DeleteSubscriptions: %v", err)
+		}
+		if !errors.Is(results[2].Err, repoerrs.ErrNotFound) {
+			t.Errorf("repeated item: %v, want ErrNotFound", results[2].Err)
+		}
+		if left, _ := r.GetSubscriptionsByIDs(ctx, ids); len(left) != 2 {
+			t.Errorf("%d subscriptions left after the failed atomic delete, want 2", len(left))
+		}
+	})
+}
+
+// TestUpdateSubscriptionsEventsCarryStoredRows runs against PostgreSQL: the
+// update events describe the rows as stored, not the subscriptions the
+// caller read before the transaction.
+func TestUpdateSubscriptionsEventsCarryStoredRows(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepo(pool)
+
+	ids := createTestSubscriptions(t, r, "Netflix", "Spotify")
+	subs, err := r.GetSubscriptionsByIDs(ctx, ids)
+	if err != nil {
+		t.Fatalf("GetSubscriptionsByIDs: %v", err)
+	}
+	// Pause the subscriptions after they were read: the stale status must not
+	// reach the events.
+	if _, err := pool.Exec(ctx, "UPDATE subscriptions SET status = $1 WHERE id = ANY($2)", string(entity.StatusPaused), ids); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	for i := range subs {
+		subs[i].Notes = "updated"
+	}
+	results, err := r.UpdateSubscriptions(ctx, subs, true)
+	if err != nil {
+		t.Fatalf("UpdateSubscriptions: %v", err)
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatalf("item %d: %v", i, result.Err)
+		}
+	}
+
+	rows, err := pool.Query(ctx, "SELECT payload FROM outbox_events WHERE event_type = $1 AND aggregate_id = ANY($2)",
+		string(entity.EventSubscriptionUpdated), ids)
+	if err != nil {
+		t.Fatalf("query events: %v", err)
+	}
+	defer rows.Close()
+	var events int
+	for rows.Next() {
+		var event entity.SubscriptionEvent
+		if err := rows.Scan(&event); err != nil {
+			t.Fatalf("scan event: %v", err)
+		}
+		events++
+		if event.Subscription.Status != entity.StatusPaused || event.Subscription.Notes != "updated" {
+			t.Errorf("event of %s: status %s, notes %q, want the stored paused row with the new notes",
+				event.Subscription.ID, event.Subscription.Status, event.Subscription.Notes)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("read events: %v", err)
+	}
+	if events != len(ids) {
+		t.Errorf("%d update events, want one per subscription", events)
+	}
+}
@@ -0,0 +1,253 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type BudgetRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewBudgetRepo(pg *pgxpool.Pool) *BudgetRepo {
+	return &BudgetRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+var budgetColumns = []string{"id", "user_id", "service_name", "amount", "created_at", "updated_at"}
+
+func scanBudget(row pgx.Row) (entity.Budget, error) {
+	var b entity.Budget
+	err := row.Scan(&b.ID, &b.UserID, &b.ServiceName, &b.Amount, &b.CreatedAt, &b.UpdatedAt)
+	return b, err
+}
+
+var budgetAlertColumns = []string{"id", "budget_id", "user_id", "service_name", "kind", "month", "spend", "amount", "created_at"}
+
+func scanBudgetAlert(row pgx.Row) (entity.BudgetAlert, error) {
+	var a entity.BudgetAlert
+	err := row.Scan(&a.ID, &a.BudgetID, &a.UserID, &a.ServiceName, &a.Kind, &a.Month, &a.Spend, &a.Amount, &a.CreatedAt)
+	return a, err
+}
+
+func (r *BudgetRepo) CreateBudget(ctx context.Context, budget entity.Budget) (*entity.Budget, error) {
+	sql, args, err := r.psql.
+		Insert("budgets").
+		Columns("id", "user_id", "service_name", "amount").
+		Values(uuid.New(), budget.UserID, budget.ServiceName, budget.Amount).
+		Suffix("RETURNING " + strings.Join(budgetColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.CreateBudget - sql build: %v", err)
+	}
+
+	created, err := scanBudget(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, repoerrs.ErrAlreadyExists
+		}
+		return nil, fmt.Errorf("BudgetRepo.CreateBudget - query exec: %v", err)
+	}
+
+	return &created, nil
+}
+
+func (r *BudgetRepo) GetBudget(ctx context.Context, id uuid.UUID) (entity.Budget, error) {
+	sql, args, err := r.psql.
+		Select(budgetColumns...).
+		From("budgets").
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return entity.Budget{}, fmt.Errorf("BudgetRepo.GetBudget - sql build: %v", err)
+	}
+
+	budget, err := scanBudget(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.Budget{}, repoerrs.ErrNotFound
+		}
+		return entity.Budget{}, fmt.Errorf("BudgetRepo.GetBudget - query exec: %v", err)
+	}
+
+	return budget, nil
+}
+
+func (r *BudgetRepo) ListBudgets(ctx context.Context, userID uuid.UUID) ([]entity.Budget, error) {
+	sql, args, err := r.psql.
+		Select(budgetColumns...).
+		From("budgets").
+		Where("user_id = ?", userID).
+		OrderBy("service_name NULLS FIRST").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListBudgets - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListBudgets - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var budgets []entity.Budget
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("BudgetRepo.ListBudgets - row scan: %v", err)
+		}
+		budgets = append(budgets, budget)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListBudgets - rows error: %v", err)
+	}
+
+	return budgets, nil
+}
+
+// UpdateBudget changes the amount and forgets the alerts of the current and
+// later months, so they are raised again against the new amount.
+func (r *BudgetRepo) UpdateBudget(ctx context.Context, id uuid.UUID, amount int) (*entity.Budget, error) {
+	sql, args, err := r.psql.
+		Update("budgets").
+		Set("amount", amount).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where("id = ?", id).
+		Suffix("RETURNING " + strings.Join(budgetColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.UpdateBudget - sql build: %v", err)
+	}
+
+	var updated entity.Budget
+	err = r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		updated, err = scanBudget(tx.QueryRow(ctx, sql, args...))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repoerrs.ErrNotFound
+			}
+			return fmt.Errorf("query exec: %v", err)
+		}
+
+		_, err = tx.Exec(ctx,
+			"DELETE FROM budget_alerts WHERE budget_id = $1 AND month >= date_trunc('month', CURRENT_DATE)", id)
+		if err != nil {
+			return fmt.Errorf("reset alerts: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("BudgetRepo.UpdateBudget - %v", err)
+	}
+
+	return &updated, nil
+}
+
+func (r *BudgetRepo) DeleteBudget(ctx context.Context, id uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, "DELETE FROM budgets WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("BudgetRepo.DeleteBudget - query exec: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return repoerrs.ErrNotFound
+	}
+	return nil
+}
+
+func (r *BudgetRepo) ListBudgetUserIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.pool.Query(ctx, "SELECT DISTINCT user_id FROM budgets ORDER BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListBudgetUserIDs - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("BudgetRepo.ListBudgetUserIDs - row scan: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListBudgetUserIDs - rows error: %v", err)
+	}
+
+	return userIDs, nil
+}
+
+// SaveAlert stores the alert unless one of the same budget, month and kind
+// exists. It reports whether the alert is new.
+func (r *BudgetRepo) SaveAlert(ctx context.Context, alert *entity.BudgetAlert) (bool, error) {
+	sql, args, err := r.psql.
+		Insert("budget_alerts").
+		Columns("id", "budget_id", "user_id", "service_name", "kind", "month", "spend", "amount").
+		Values(uuid.New(), alert.BudgetID, alert.UserID, alert.ServiceName, alert.Kind, alert.Month, alert.Spend, alert.Amount).
+		Suffix("ON CONFLICT (budget_id, month, kind) DO NOTHING RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("BudgetRepo.SaveAlert - sql build: %v", err)
+	}
+
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&alert.ID, &alert.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("BudgetRepo.SaveAlert - query exec: %v", err)
+	}
+	return true, nil
+}
+
+func (r *BudgetRepo) ListAlerts(ctx context.Context, userID uuid.UUID, offset, limit int) ([]entity.BudgetAlert, error) {
+	sql, args, err := r.psql.
+		Select(budgetAlertColumns...).
+		From("budget_alerts").
+		Where("user_id = ?", userID).
+		OrderBy("created_at DESC", "id").
+		Offset(uint64(offset)).
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListAlerts - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListAlerts - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var alerts []entity.BudgetAlert
+	for rows.Next() {
+		alert, err := scanBudgetAlert(rows)
+		if err != nil {
+			return nil, fmt.Errorf("BudgetRepo.ListAlerts - row scan: %v", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("BudgetRepo.ListAlerts - rows error: %v", err)
+	}
+
+	return alerts, nil
+}
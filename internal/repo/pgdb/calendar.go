@@ -0,0 +1,44 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type CalendarFeedRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewCalendarFeedRepo(pg *pgxpool.Pool) *CalendarFeedRepo {
+	return &CalendarFeedRepo{pool: pg}
+}
+
+// SaveToken stores the feed token of the user, replacing the previous one.
+func (r *CalendarFeedRepo) SaveToken(ctx context.Context, userID uuid.UUID, token string) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO calendar_feeds (user_id, token, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = EXCLUDED.created_at`, userID, token)
+	if err != nil {
+		return fmt.Errorf("CalendarFeedRepo.SaveToken - query exec: %v", err)
+	}
+	return nil
+}
+
+func (r *CalendarFeedRepo) GetUserIDByToken(ctx context.Context, token string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := r.pool.QueryRow(ctx, "SELECT user_id FROM calendar_feeds WHERE token = $1", token).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, repoerrs.ErrNotFound
+		}
+		return uuid.Nil, fmt.Errorf("CalendarFeedRepo.GetUserIDByToken - query exec: %v", err)
+	}
+	return userID, nil
+}
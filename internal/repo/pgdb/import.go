@@ -0,0 +1,172 @@
+package pgdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ImportRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewImportRepo(pg *pgxpool.Pool) *ImportRepo {
+	return &ImportRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+var importColumns = []string{
+	"id", "status", "total_rows", "valid_rows", "processed_rows", "imported_rows", "failed_rows",
+	"errors", "error", "created_at", "finished_at",
+}
+
+func scanImport(row pgx.Row) (entity.Import, error) {
+	var (
+		imp       entity.Import
+		rowErrors []byte
+	)
+	err := row.Scan(&imp.ID, &imp.Status, &imp.TotalRows, &imp.ValidRows, &imp.ProcessedRows, &imp.ImportedRows,
+		&imp.FailedRows, &rowErrors, &imp.Error, &imp.CreatedAt, &imp.FinishedAt)
+	if err != nil {
+		return imp, err
+	}
+	if err := json.Unmarshal(rowErrors, &imp.Errors); err != nil {
+		return imp, fmt.Errorf("decode errors: %v", err)
+	}
+	return imp, nil
+}
+
+func encodeImportErrors(errs []entity.ImportRowError) (string, error) {
+	if errs == nil {
+		errs = []entity.ImportRowError{}
+	}
+	data, err := json.Marshal(errs)
+	return string(data), err
+}
+
+// CreateImport records the import. An import created in a final status is
+// marked finished.
+func (r *ImportRepo) CreateImport(ctx context.Context, imp *entity.Import) error {
+	errs, err := encodeImportErrors(imp.Errors)
+	if err != nil {
+		return fmt.Errorf("ImportRepo.CreateImport - encode errors: %v", err)
+	}
+	var finishedAt any
+	if imp.Status != entity.ImportRunning {
+		finishedAt = squirrel.Expr("NOW()")
+	}
+
+	sql, args, err := r.psql.
+		Insert("subscription_imports").
+		Columns("id", "status", "total_rows", "valid_rows", "processed_rows", "imported_rows", "failed_rows", "errors", "error", "finished_at").
+		Values(uuid.New(), imp.Status, imp.TotalRows, imp.ValidRows, imp.ProcessedRows, imp.ImportedRows, imp.FailedRows,
+			squirrel.Expr("?::jsonb", errs), imp.Error, finishedAt).
+		Suffix("RETURNING " + strings.Join(importColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("ImportRepo.CreateImport - sql build: %v", err)
+	}
+
+	created, err := scanImport(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		return fmt.Errorf("ImportRepo.CreateImport - query exec: %v", err)
+	}
+	*imp = created
+	return nil
+}
+
+func (r *ImportRepo) GetImport(ctx context.Context, id uuid.UUID) (entity.Import, error) {
+	sql, args, err := r.psql.
+		Select(importColumns...).
+		From("subscription_imports").
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return entity.Import{}, fmt.Errorf("ImportRepo.GetImport - sql build: %v", err)
+	}
+
+	imp, err := scanImport(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.Import{}, repoerrs.ErrNotFound
+		}
+		return entity.Import{}, fmt.Errorf("ImportRepo.GetImport - query exec: %v", err)
+	}
+	return imp, nil
+}
+
+// UpdateImport saves the progress of a running import. An import that is no
+// longer running is marked finished. An import failed as stale is not found.
+func (r *ImportRepo) UpdateImport(ctx context.Context, imp *entity.Import) error {
+	errs, err := encodeImportErrors(imp.Errors)
+	if err != nil {
+		return fmt.Errorf("ImportRepo.UpdateImport - encode errors: %v", err)
+	}
+
+	qb := r.psql.
+		Update("subscription_imports").
+		Set("status", imp.Status).
+		Set("processed_rows", imp.ProcessedRows).
+		Set("imported_rows", imp.ImportedRows).
+		Set("failed_rows", imp.FailedRows).
+		Set("errors", squirrel.Expr("?::jsonb", errs)).
+		Set("error", imp.Error).
+		Set("heartbeat_at", squirrel.Expr("NOW()")).
+		Where("id = ? AND status = ?", imp.ID, entity.ImportRunning).
+		Suffix("RETURNING " + strings.Join(importColumns, ", "))
+	if imp.Status != entity.ImportRunning {
+		qb = qb.Set("finished_at", squirrel.Expr("NOW()"))
+	}
+	sql, args, err := qb.ToSql()
+	if err != nil {
+		return fmt.Errorf("ImportRepo.UpdateImport - sql build: %v", err)
+	}
+
+	updated, err := scanImport(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrs.ErrNotFound
+		}
+		return fmt.Errorf("ImportRepo.UpdateImport - query exec: %v", err)
+	}
+	*imp = updated
+	return nil
+}
+
+// TouchImport records that a running import is still being worked on.
+func (r *ImportRepo) TouchImport(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.Exec(ctx,
+		"UPDATE subscription_imports SET heartbeat_at = NOW() WHERE id = $1 AND status = $2",
+		id, entity.ImportRunning)
+	if err != nil {
+		return fmt.Errorf("ImportRepo.TouchImport - exec: %v", err)
+	}
+	return nil
+}
+
+// FailStaleImports fails running imports without a heartbeat for longer than
+// timeout and returns how many there were.
+func (r *ImportRepo) FailStaleImports(ctx context.Context, timeout time.Duration, reason string) (int, error) {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE subscription_imports
+		SET status = $1, error = $2, finished_at = NOW()
+		WHERE status = $3 AND heartbeat_at < NOW() - make_interval(secs => $4)`,
+		entity.ImportFailed, reason, entity.ImportRunning, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("ImportRepo.FailStaleImports - exec: %v", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
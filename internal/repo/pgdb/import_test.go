@@ -0,0 +1,52 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+)
+
+func TestFailStaleImports(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	r := NewImportRepo(pool)
+
+	stale := entity.Import{Status: entity.ImportRunning, TotalRows: 10, ValidRows: 10}
+	alive := stale
+	for _, imp := range []*entity.Import{&stale, &alive} {
+		if err := r.CreateImport(ctx, imp); err != nil {
+			t.Fatalf("CreateImport: %v", err)
+		}
+	}
+	if _, err := pool.Exec(ctx, "UPDATE subscription_imports SET heartbeat_at = NOW() - interval '10 minutes' WHERE id = $1", stale.ID); err != nil {
+		t.Fatalf("age heartbeat: %v", err)
+	}
+
+	n, err := r.FailStaleImports(ctx, 5*time.Minute, "interrupted")
+	if err != nil || n != 1 {
+		t.Fatalf("FailStaleImports = %d, %v; want 1, nil", n, err)
+	}
+
+	got, err := r.GetImport(ctx, stale.ID)
+	if err != nil {
+		t.Fatalf("GetImport: %v", err)
+	}
+	if got.Status != entity.ImportFailed || got.Error == nil || *got.Error != "interrupted" || got.FinishedAt == nil {
+		t.Errorf("stale import is %s with error %v, want failed and finished", got.Status, got.Error)
+	}
+	if got, _ := r.GetImport(ctx, alive.ID); got.Status != entity.ImportRunning {
+		t.Errorf("import with a fresh heartbeat is %s, want running", got.Status)
+	}
+
+	// A late progress update of the failed import must not revive it.
+	stale.ProcessedRows = 10
+	stale.Status = entity.ImportCompleted
+	if err := r.UpdateImport(ctx, &stale); !errors.Is(err, repoerrs.ErrNotFound) {
+		t.Errorf("UpdateImport of a failed import = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,186 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// jobLockClass is the first key of job advisory locks, keeping them apart
+// from other advisory locks in the database.
+const jobLockClass int32 = 0x4a4f42
+
+type JobRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewJobRepo(pg *pgxpool.Pool) *JobRepo {
+	return &JobRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+var jobRunColumns = []string{
+	"id", "job_name", "trigger", "status", "instance", "scheduled_at", "started_at", "finished_at", "processed", "error",
+}
+
+func scanJobRun(row pgx.Row) (entity.JobRun, error) {
+	var r entity.JobRun
+	err := row.Scan(&r.ID, &r.Job, &r.Trigger, &r.Status, &r.Instance, &r.ScheduledAt, &r.StartedAt, &r.FinishedAt, &r.Processed, &r.Error)
+	return r, err
+}
+
+// WithJobLock runs fn while holding the session advisory lock of the job on
+// a dedicated connection. It reports false without running fn when another
+// instance holds the lock. The lock is released with the connection if the
+// instance dies.
+func (r *JobRepo) WithJobLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("JobRepo.WithJobLock - acquire: %v", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1, hashtext($2))", jobLockClass, name).Scan(&locked)
+	if err != nil {
+		return false, fmt.Errorf("JobRepo.WithJobLock - lock: %v", err)
+	}
+	if !locked {
+		return false, nil
+	}
+
+	defer func() {
+		_, err := conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1, hashtext($2))", jobLockClass, name)
+		if err != nil {
+			// Closing the session is the only other way to drop the lock.
+			_ = conn.Hijack().Close(context.Background())
+		}
+	}()
+
+	return true, fn(ctx)
+}
+
+// StartRun records a new run. A scheduled run of a slot that already ran
+// is not recorded and false is returned. Runs of the job still marked as
+// running are marked failed first: the caller holds the job lock, so they
+// belong to an instance that died.
+func (r *JobRepo) StartRun(ctx context.Context, run *entity.JobRun) (bool, error) {
+	started := false
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE job_runs
+			SET status = $2, finished_at = NOW(), error = 'interrupted'
+			WHERE job_name = $1 AND status = $3`,
+			run.Job, entity.JobFailed, entity.JobRunning)
+		if err != nil {
+			return fmt.Errorf("close interrupted runs: %v", err)
+		}
+
+		sql, args, err := r.psql.
+			Insert("job_runs").
+			Columns("id", "job_name", "trigger", "status", "instance", "scheduled_at").
+			Values(uuid.New(), run.Job, run.Trigger, entity.JobRunning, run.Instance, run.ScheduledAt).
+			Suffix("ON CONFLICT (job_name, scheduled_at) WHERE scheduled_at IS NOT NULL DO NOTHING RETURNING " + strings.Join(jobRunColumns, ", ")).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("sql build: %v", err)
+		}
+
+		created, err := scanJobRun(tx.QueryRow(ctx, sql, args...))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("insert run: %v", err)
+		}
+		*run = created
+		started = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("JobRepo.StartRun - %v", err)
+	}
+	return started, nil
+}
+
+func (r *JobRepo) FinishRun(ctx context.Context, run *entity.JobRun) error {
+	sql, args, err := r.psql.
+		Update("job_runs").
+		Set("status", run.Status).
+		Set("finished_at", squirrel.Expr("NOW()")).
+		Set("processed", run.Processed).
+		Set("error", run.Error).
+		Where("id = ?", run.ID).
+		Suffix("RETURNING " + strings.Join(jobRunColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("JobRepo.FinishRun - sql build: %v", err)
+	}
+
+	finished, err := scanJobRun(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		return fmt.Errorf("JobRepo.FinishRun - query exec: %v", err)
+	}
+	*run = finished
+	return nil
+}
+
+// ListRuns returns runs of the job, or of all jobs when name is empty, newest first.
+func (r *JobRepo) ListRuns(ctx context.Context, name string, offset, limit int) ([]entity.JobRun, error) {
+	qb := r.psql.
+		Select(jobRunColumns...).
+		From("job_runs").
+		OrderBy("started_at DESC", "id").
+		Offset(uint64(offset)).
+		Limit(uint64(limit))
+	if name != "" {
+		qb = qb.Where("job_name = ?", name)
+	}
+	sql, args, err := qb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("JobRepo.ListRuns - sql build: %v", err)
+	}
+
+	return r.queryRuns(ctx, "ListRuns", sql, args...)
+}
+
+// ListLastRuns returns the latest run of every job that ran at least once.
+func (r *JobRepo) ListLastRuns(ctx context.Context) ([]entity.JobRun, error) {
+	sql := "SELECT DISTINCT ON (job_name) " + strings.Join(jobRunColumns, ", ") + `
+		FROM job_runs
+		ORDER BY job_name, started_at DESC`
+	return r.queryRuns(ctx, "ListLastRuns", sql)
+}
+
+func (r *JobRepo) queryRuns(ctx context.Context, method, sql string, args ...any) ([]entity.JobRun, error) {
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("JobRepo.%s - query exec: %v", method, err)
+	}
+	defer rows.Close()
+
+	var runs []entity.JobRun
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("JobRepo.%s - row scan: %v", method, err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("JobRepo.%s - rows error: %v", method, err)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,143 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type NotificationRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewNotificationRepo(pg *pgxpool.Pool) *NotificationRepo {
+	return &NotificationRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+var notificationPreferencesColumns = []string{
+	"user_id", "email", "locale", "renewal_reminders", "trial_reminders", "days_before", "updated_at",
+}
+
+func scanNotificationPreferences(row pgx.Row) (entity.NotificationPreferences, error) {
+	var p entity.NotificationPreferences
+	err := row.Scan(&p.UserID, &p.Email, &p.Locale, &p.RenewalReminders, &p.TrialReminders, &p.DaysBefore, &p.UpdatedAt)
+	return p, err
+}
+
+func (r *NotificationRepo) GetPreferences(ctx context.Context, userID uuid.UUID) (entity.NotificationPreferences, error) {
+	sql, args, err := r.psql.
+		Select(notificationPreferencesColumns...).
+		From("notification_preferences").
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		return entity.NotificationPreferences{}, fmt.Errorf("NotificationRepo.GetPreferences - sql build: %v", err)
+	}
+
+	prefs, err := scanNotificationPreferences(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.NotificationPreferences{}, repoerrs.ErrNotFound
+		}
+		return entity.NotificationPreferences{}, fmt.Errorf("NotificationRepo.GetPreferences - query exec: %v", err)
+	}
+	return prefs, nil
+}
+
+func (r *NotificationRepo) SavePreferences(ctx context.Context, prefs entity.NotificationPreferences) (*entity.NotificationPreferences, error) {
+	sql, args, err := r.psql.
+		Insert("notification_preferences").
+		Columns("user_id", "email", "locale", "renewal_reminders", "trial_reminders", "days_before").
+		Values(prefs.UserID, prefs.Email, prefs.Locale, prefs.RenewalReminders, prefs.TrialReminders, prefs.DaysBefore).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			email = EXCLUDED.email,
+			locale = EXCLUDED.locale,
+			renewal_reminders = EXCLUDED.renewal_reminders,
+			trial_reminders = EXCLUDED.trial_reminders,
+			days_before = EXCLUDED.days_before,
+			updated_at = NOW()
+			RETURNING ` + strings.Join(notificationPreferencesColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("NotificationRepo.SavePreferences - sql build: %v", err)
+	}
+
+	saved, err := scanNotificationPreferences(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		return nil, fmt.Errorf("NotificationRepo.SavePreferences - query exec: %v", err)
+	}
+	return &saved, nil
+}
+
+// ListReminderRecipients returns the preferences of users with at least one
+// kind of reminder enabled.
+func (r *NotificationRepo) ListReminderRecipients(ctx context.Context) ([]entity.NotificationPreferences, error) {
+	sql, args, err := r.psql.
+		Select(notificationPreferencesColumns...).
+		From("notification_preferences").
+		Where("renewal_reminders OR trial_reminders").
+		OrderBy("user_id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("NotificationRepo.ListReminderRecipients - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("NotificationRepo.ListReminderRecipients - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var recipients []entity.NotificationPreferences
+	for rows.Next() {
+		p, err := scanNotificationPreferences(rows)
+		if err != nil {
+			return nil, fmt.Errorf("NotificationRepo.ListReminderRecipients - row scan: %v", err)
+		}
+		recipients = append(recipients, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("NotificationRepo.ListReminderRecipients - rows error: %v", err)
+	}
+
+	return recipients, nil
+}
+
+// ClaimReminder records the reminder before it is sent and reports whether it
+// was new, so concurrent runs send each reminder once.
+func (r *NotificationRepo) ClaimReminder(ctx context.Context, reminder entity.Reminder) (bool, error) {
+	result, err := r.pool.Exec(ctx, `
+		INSERT INTO email_reminders (subscription_id, user_id, kind, charge_date, email)
+		VALUES ($1, $2, $3, $4::date, $5)
+		ON CONFLICT (subscription_id, kind, charge_date) DO NOTHING`,
+		reminder.SubscriptionID, reminder.UserID, reminder.Kind, reminder.ChargeDate, reminder.Email)
+	if err != nil {
+		return false, fmt.Errorf("NotificationRepo.ClaimReminder - query exec: %v", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReleaseReminder removes the claim of a reminder that could not be sent, so
+// the next run tries again.
+func (r *NotificationRepo) ReleaseReminder(ctx context.Context, reminder entity.Reminder) error {
+	_, err := r.pool.Exec(ctx,
+		"DELETE FROM email_reminders WHERE subscription_id = $1 AND kind = $2 AND charge_date = $3::date",
+		reminder.SubscriptionID, reminder.Kind, reminder.ChargeDate)
+	if err != nil {
+		return fmt.Errorf("NotificationRepo.ReleaseReminder - query exec: %v", err)
+	}
+	return nil
+}
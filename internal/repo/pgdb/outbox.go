@@ -0,0 +1,320 @@
+package pgdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// outboxChannel is notified with the ID and owner of every event written to
+// the outbox. Notifications are delivered on commit, so listeners never see
+// rolled back events.
+const outboxChannel = "outbox_events"
+
+// outboxEventColumns is the column list scanOutboxEvent expects.
+const outboxEventColumns = "id, aggregate_type, aggregate_id, user_id, event_type, payload, created_at, attempts"
+
+// qualifiedOutboxEventColumns is outboxEventColumns of the table aliased o.
+const qualifiedOutboxEventColumns = "o.id, o.aggregate_type, o.aggregate_id, o.user_id, o.event_type, o.payload, o.created_at, o.attempts"
+
+func scanOutboxEvent(row pgx.Row) (entity.OutboxEvent, error) {
+	var e entity.OutboxEvent
+	err := row.Scan(&e.ID, &e.AggregateType, &e.AggregateID, &e.UserID, &e.Type, &e.Payload, &e.CreatedAt, &e.Attempts)
+	return e, err
+}
+
+// writeSubscriptionEvent stores an event about sub in the outbox. It must run
+// in the transaction that changes sub, so the event exists if and only if the
+// change was committed.
+func writeSubscriptionEvent(ctx context.Context, q querier, eventType entity.EventType, sub entity.Subscription) error {
+	queries, err := subscriptionEventQueries(eventType, sub)
+	if err != nil {
+		return err
+	}
+	for _, query := range queries {
+		if _, err := q.Exec(ctx, query.sql, query.args...); err != nil {
+			return fmt.Errorf("write outbox event: %v", err)
+		}
+	}
+	return nil
+}
+
+// batchQuery is a statement to run on its own or queue into a pgx.Batch.
+type batchQuery struct {
+	sql  string
+	args []any
+}
+
+// subscriptionEventQueries returns the statements storing an event about sub
+// in the outbox and notifying outboxChannel of it.
+func subscriptionEventQueries(eventType entity.EventType, sub entity.Subscription) ([]batchQuery, error) {
+	event := entity.SubscriptionEvent{
+		ID:           uuid.New(),
+		Type:         eventType,
+		OccurredAt:   time.Now().UTC(),
+		Subscription: sub,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event: %v", err)
+	}
+	notification, err := json.Marshal(entity.OutboxNotification{EventID: event.ID, UserID: sub.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("marshal notification: %v", err)
+	}
+
+	return []batchQuery{
+		{
+			sql: `
+		INSERT INTO outbox_events (id, aggregate_type, aggregate_id, user_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7)`,
+			args: []any{event.ID, entity.AggregateSubscription, sub.ID, sub.UserID, string(eventType), string(payload), event.OccurredAt},
+		},
+		{
+			sql:  "SELECT pg_notify($1, $2)",
+			args: []any{outboxChannel, string(notification)},
+		},
+	}, nil
+}
+
+type OutboxRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepo(pg *pgxpool.Pool) *OutboxRepo {
+	return &OutboxRepo{pool: pg}
+}
+
+// ClaimDueEvents picks up to limit of the oldest unpublished events that are
+// due and pushes their next attempt lease into the future, so other relays
+// skip them and an event whose relay dies is retried after the lease. The
+// claim commits before the events are handed out, so no locks are held while
+// they are published. An event is only claimed once the earlier events of its
+// aggregate are published, which keeps events of a subscription in order
+// across relays; a dead event holds them back until it is requeued. Events are
+// returned oldest first.
+func (r *OutboxRepo) ClaimDueEvents(ctx context.Context, limit int, lease time.Duration) ([]entity.OutboxEvent, error) {
+	rows, err := r.pool.Query(ctx, `
+		WITH due AS (
+			SELECT o.id FROM outbox_events o
+			WHERE o.published_at IS NULL AND o.dead_at IS NULL AND o.next_attempt_at <= NOW()
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox_events e
+					WHERE e.aggregate_id = o.aggregate_id
+						AND e.published_at IS NULL
+						AND (e.created_at, e.id) < (o.created_at, o.id)
+				)
+			ORDER BY o.created_at, o.id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox_events o
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due
+		WHERE o.id = due.id
+		RETURNING `+qualifiedOutboxEventColumns, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("OutboxRepo.ClaimDueEvents - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var events []entity.OutboxEvent
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("OutboxRepo.ClaimDueEvents - row scan: %v", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("OutboxRepo.ClaimDueEvents - rows error: %v", err)
+	}
+
+	slices.SortFunc(events, func(a, b entity.OutboxEvent) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+	return events, nil
+}
+
+func (r *OutboxRepo) MarkPublished(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.pool.Exec(ctx, "UPDATE outbox_events SET published_at = NOW() WHERE id = $1", id); err != nil {
+		return fmt.Errorf("OutboxRepo.MarkPublished - query exec: %v", err)
+	}
+	return nil
+}
+
+// RecordFailure stores a failed attempt to publish an event. Without a next
+// attempt the event moves to the dead-letter state.
+func (r *OutboxRepo) RecordFailure(ctx context.Context, id uuid.UUID, publishErr string, nextAttemptAt *time.Time) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE outbox_events
+		SET attempts = attempts + 1,
+			last_error = $2,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			dead_at = CASE WHEN $3::timestamptz IS NULL THEN NOW() END
+		WHERE id = $1`, id, publishErr, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("OutboxRepo.RecordFailure - query exec: %v", err)
+	}
+	return nil
+}
+
+// PostponeEvents moves the next attempt of events to nextAttemptAt without
+// counting a failed attempt.
+func (r *OutboxRepo) PostponeEvents(ctx context.Context, ids []uuid.UUID, nextAttemptAt time.Time) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE outbox_events SET next_attempt_at = $2
+		WHERE id = ANY($1) AND published_at IS NULL AND dead_at IS NULL`, ids, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("OutboxRepo.PostponeEvents - query exec: %v", err)
+	}
+	return nil
+}
+
+// ListDeadEvents returns dead events, the most recently dead first.
+func (r *OutboxRepo) ListDeadEvents(ctx context.Context, limit, offset int) ([]entity.DeadOutboxEvent, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+outboxEventColumns+`, COALESCE(last_error, ''), dead_at
+		FROM outbox_events
+		WHERE dead_at IS NOT NULL AND published_at IS NULL
+		ORDER BY dead_at DESC, id
+		LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("OutboxRepo.ListDeadEvents - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var events []entity.DeadOutboxEvent
+	for rows.Next() {
+		var e entity.DeadOutboxEvent
+		err := rows.Scan(&e.ID, &e.AggregateType, &e.AggregateID, &e.UserID, &e.Type, &e.Payload, &e.CreatedAt, &e.Attempts,
+			&e.LastError, &e.DeadAt)
+		if err != nil {
+			return nil, fmt.Errorf("OutboxRepo.ListDeadEvents - row scan: %v", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("OutboxRepo.ListDeadEvents - rows error: %v", err)
+	}
+
+	return events, nil
+}
+
+// RequeueDeadEvents gives dead events, all of them when ids is empty, a fresh
+// set of attempts starting now.
+func (r *OutboxRepo) RequeueDeadEvents(ctx context.Context, ids []uuid.UUID) (int, error) {
+	sql := `
+		UPDATE outbox_events
+		SET dead_at = NULL, attempts = 0, next_attempt_at = NOW()
+		WHERE dead_at IS NOT NULL AND published_at IS NULL`
+	var args []any
+	if len(ids) > 0 {
+		sql += " AND id = ANY($1)"
+		args = append(args, ids)
+	}
+
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, fmt.Errorf("OutboxRepo.RequeueDeadEvents - query exec: %v", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// DeletePublishedBefore removes events published before the given time.
+func (r *OutboxRepo) DeletePublishedBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.pool.Exec(ctx, "DELETE FROM outbox_events WHERE published_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("OutboxRepo.DeletePublishedBefore - query exec: %v", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func (r *OutboxRepo) GetEvent(ctx context.Context, id uuid.UUID) (entity.OutboxEvent, error) {
+	event, err := scanOutboxEvent(r.pool.QueryRow(ctx,
+		"SELECT "+outboxEventColumns+" FROM outbox_events WHERE id = $1", id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.OutboxEvent{}, repoerrs.ErrNotFound
+		}
+		return entity.OutboxEvent{}, fmt.Errorf("OutboxRepo.GetEvent - query exec: %v", err)
+	}
+	return event, nil
+}
+
+// ListUserEventsAfter returns up to limit events of the user written after
+// the event afterID, oldest first. An unknown afterID, e.g. of an event that
+// was already purged, yields no events.
+func (r *OutboxRepo) ListUserEventsAfter(ctx context.Context, userID, afterID uuid.UUID, limit int) ([]entity.OutboxEvent, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+outboxEventColumns+`
+		FROM outbox_events
+		WHERE user_id = $1
+			AND (created_at, id) > (SELECT created_at, id FROM outbox_events WHERE id = $2)
+		ORDER BY created_at, id
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("OutboxRepo.ListUserEventsAfter - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var events []entity.OutboxEvent
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("OutboxRepo.ListUserEventsAfter - row scan: %v", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("OutboxRepo.ListUserEventsAfter - rows error: %v", err)
+	}
+
+	return events, nil
+}
+
+// ListenEvents holds a dedicated connection listening for new outbox events
+// and calls fn for each notification until ctx is done or the connection
+// fails. The connection is taken out of the pool, so it never returns there
+// still listening.
+func (r *OutboxRepo) ListenEvents(ctx context.Context, fn func(entity.OutboxNotification)) error {
+	pooled, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("OutboxRepo.ListenEvents - acquire: %v", err)
+	}
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+outboxChannel); err != nil {
+		return fmt.Errorf("OutboxRepo.ListenEvents - listen: %v", err)
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("OutboxRepo.ListenEvents - wait: %v", err)
+		}
+
+		var notification entity.OutboxNotification
+		if err := json.Unmarshal([]byte(n.Payload), &notification); err != nil {
+			return fmt.Errorf("OutboxRepo.ListenEvents - decode %q: %v", n.Payload, err)
+		}
+		fn(notification)
+	}
+}
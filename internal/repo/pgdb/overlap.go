@@ -0,0 +1,178 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+)
+
+// exclusionViolation is the SQLSTATE of a row rejected by the exclusion
+// constraint on overlapping subscriptions.
+const exclusionViolation = "23P01"
+
+// overlapSQL finds the stored subscriptions overlapping each of the
+// subscriptions given as parallel arrays, by user, service name and period,
+// the key of the exclusion constraint. The subscriptions being saved are
+// left out.
+const overlapSQL = `
+	SELECT i.idx, s.id
+	FROM unnest($1::uuid[], $2::uuid[], $3::text[], $4::date[], $5::date[])
+		WITH ORDINALITY AS i(id, user_id, service_name, start_date, end_date, idx)
+	JOIN subscriptions s ON s.user_id = i.user_id AND s.service_name = i.service_name AND s.id <> ALL($1)
+	WHERE daterange(s.start_date, s.end_date, '[]') && daterange(i.start_date, i.end_date, '[]')
+	ORDER BY i.idx, s.start_date, s.id`
+
+// findOverlaps returns for each of subs the stored subscriptions of the same
+// user to a service of the same name whose period overlaps it, oldest first.
+// Subscriptions without an end date run indefinitely.
+func findOverlaps(ctx context.Context, q querier, subs []*entity.Subscription) ([][]uuid.UUID, error) {
+	var (
+		ids     = make([]uuid.UUID, len(subs))
+		userIDs = make([]uuid.UUID, len(subs))
+		names   = make([]string, len(subs))
+		starts  = make([]time.Time, len(subs))
+		ends    = make([]*time.Time, len(subs))
+	)
+	for i, sub := range subs {
+		ids[i], userIDs[i], names[i] = sub.ID, sub.UserID, sub.Service.Name
+		starts[i], ends[i] = sub.StartDate, sub.EndDate
+	}
+
+	rows, err := q.Query(ctx, overlapSQL, ids, userIDs, names, starts, ends)
+	if err != nil {
+		return nil, fmt.Errorf("find overlaps: %v", err)
+	}
+	defer rows.Close()
+
+	overlaps := make([][]uuid.UUID, len(subs))
+	for rows.Next() {
+		var (
+			idx int
+			id  uuid.UUID
+		)
+		if err := rows.Scan(&idx, &id); err != nil {
+			return nil, fmt.Errorf("find overlaps scan: %v", err)
+		}
+		overlaps[idx-1] = append(overlaps[idx-1], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find overlaps rows: %v", err)
+	}
+	return overlaps, nil
+}
+
+// renewalFree reports whether extending the subscription with id to newEnd
+// leaves it clear of the other subscriptions of the user to a service of the
+// same name.
+func renewalFree(ctx context.Context, q querier, id uuid.UUID, newEnd time.Time) (bool, error) {
+	var taken bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM subscriptions s
+			JOIN subscriptions o ON o.user_id = s.user_id AND o.service_name = s.service_name AND o.id <> s.id
+			WHERE s.id = $1
+			  AND daterange(o.start_date, o.end_date, '[]') && daterange(s.end_date, $2::date, '(]')
+		)`, id, newEnd).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("check renewal overlap: %v", err)
+	}
+	return !taken, nil
+}
+
+// periodsOverlap reports whether two different subscriptions of the same
+// user and service name share a day, like the exclusion constraint.
+func periodsOverlap(a, b *entity.Subscription) bool {
+	return a.ID != b.ID && a.UserID == b.UserID && a.Service.Name == b.Service.Name &&
+		(a.EndDate == nil || !a.EndDate.Before(b.StartDate)) &&
+		(b.EndDate == nil || !b.EndDate.Before(a.StartDate))
+}
+
+// applyOverlapPolicy checks subs, which are saved in this order, against the
+// stored subscriptions and the ones before them. A subscription rejected by
+// its policy gets an OverlapError naming the oldest overlapped one. The
+// others that overlap are exempt from the exclusion constraint and under
+// OverlapWarn get their Overlaps.
+func applyOverlapPolicy(ctx context.Context, q querier, subs []*entity.Subscription) (exempt []bool, errs []error, err error) {
+	overlaps, err := findOverlaps(ctx, q, subs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exempt, errs = make([]bool, len(subs)), make([]error, len(subs))
+	for i, sub := range subs {
+		for j, earlier := range subs[:i] {
+			if errs[j] == nil && periodsOverlap(sub, earlier) {
+				overlaps[i] = append(overlaps[i], earlier.ID)
+			}
+		}
+		if len(overlaps[i]) == 0 {
+			continue
+		}
+		switch sub.OverlapPolicy {
+		case entity.OverlapWarn:
+			sub.Overlaps = overlaps[i]
+		case entity.OverlapAllow:
+		default:
+			errs[i] = &repoerrs.OverlapError{SubscriptionID: overlaps[i][0]}
+			continue
+		}
+		exempt[i] = true
+	}
+	return exempt, errs, nil
+}
+
+// keepsExemption reports whether sub, an update of stored that is exempt from
+// the exclusion constraint, leaves its user, service name and period alone.
+// Such an update keeps the exemption without a new check, so subscriptions
+// that overlapped before the constraint existed stay editable.
+func keepsExemption(stored, sub *entity.Subscription) bool {
+	return stored.UserID == sub.UserID && stored.Service.Name == sub.Service.Name &&
+		stored.StartDate.Equal(sub.StartDate) &&
+		(stored.EndDate == nil) == (sub.EndDate == nil) &&
+		(stored.EndDate == nil || stored.EndDate.Equal(*sub.EndDate))
+}
+
+// exemptSubscriptions returns which of the subscriptions with ids are exempt
+// from the exclusion constraint.
+func exemptSubscriptions(ctx context.Context, q querier, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	rows, err := q.Query(ctx, "SELECT id FROM subscriptions WHERE id = ANY($1) AND overlap_allowed", ids)
+	if err != nil {
+		return nil, fmt.Errorf("load overlap exemptions: %v", err)
+	}
+	defer rows.Close()
+
+	exempt := make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("load overlap exemptions scan: %v", err)
+		}
+		exempt[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load overlap exemptions rows: %v", err)
+	}
+	return exempt, nil
+}
+
+// overlapFailure returns the OverlapError of a subscription that could not
+// be saved with err. A bare ErrOverlap comes from the exclusion constraint,
+// when an overlapping subscription was saved concurrently; that one is then
+// looked up.
+func overlapFailure(ctx context.Context, q querier, sub *entity.Subscription, err error) error {
+	var overlapErr *repoerrs.OverlapError
+	if errors.As(err, &overlapErr) {
+		return overlapErr
+	}
+	overlaps, err := findOverlaps(ctx, q, []*entity.Subscription{sub})
+	if err != nil || len(overlaps[0]) == 0 {
+		return &repoerrs.OverlapError{}
+	}
+	return &repoerrs.OverlapError{SubscriptionID: overlaps[0][0]}
+}
@@ -0,0 +1,166 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPeriodsOverlap(t *testing.T) {
+	userID := uuid.New()
+	sub := func(name string, start time.Time, end *time.Time) *entity.Subscription {
+		return &entity.Subscription{ID: uuid.New(), UserID: userID, Service: entity.Service{Name: name}, StartDate: start, EndDate: end}
+	}
+	end := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name string
+		a, b *entity.Subscription
+		want bool
+	}{
+		{"share the last day", sub("Netflix", day(2025, 1, 1), end(day(2025, 3, 15))), sub("Netflix", day(2025, 3, 15), nil), true},
+		{"same month, different days", sub("Netflix", day(2025, 1, 1), end(day(2025, 3, 14))), sub("Netflix", day(2025, 3, 15), nil), false},
+		{"open ended", sub("Netflix", day(2025, 1, 1), nil), sub("Netflix", day(2030, 1, 1), end(day(2030, 2, 1))), true},
+		{"other service", sub("Netflix", day(2025, 1, 1), nil), sub("Spotify", day(2025, 1, 1), nil), false},
+	}
+	for _, tt := range tests {
+		if got := periodsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: periodsOverlap = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	same := sub("Netflix", day(2025, 1, 1), nil)
+	if periodsOverlap(same, same) {
+		t.Error("a subscription overlaps itself")
+	}
+}
+
+func TestKeepsExemption(t *testing.T) {
+	end := day(2025, 6, 30)
+	stored := entity.Subscription{UserID: uuid.New(), Service: entity.Service{Name: "Netflix", Price: 599}, StartDate: day(2025, 1, 1), EndDate: &end}
+
+	later := day(2025, 7, 31)
+	tests := []struct {
+		name   string
+		change func(*entity.Subscription)
+		want   bool
+	}{
+		{"notes and price", func(s *entity.Subscription) { s.Notes, s.Service.Price = "family", 799 }, true},
+		{"same end date", func(s *entity.Subscription) { e := end; s.EndDate = &e }, true},
+		{"end date", func(s *entity.Subscription) { s.EndDate = &later }, false},
+		{"open ended", func(s *entity.Subscription) { s.EndDate = nil }, false},
+		{"service name", func(s *entity.Subscription) { s.Service.Name = "Spotify" }, false},
+		{"user", func(s *entity.Subscription) { s.UserID = uuid.New() }, false},
+	}
+	for _, tt := range tests {
+		sub := stored
+		tt.change(&sub)
+		if got := keepsExemption(&stored, &sub); got != tt.want {
+			t.Errorf("%s: keepsExemption = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestOverlapMatchesServiceName runs against PostgreSQL: the application
+// check and the exclusion constraint both match subscriptions to services of
+// the same name, whatever their price.
+func TestOverlapMatchesServiceName(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepo(pool)
+
+	userID := uuid.New()
+	first, err := r.CreateSubscription(ctx, entity.Subscription{
+		Service: entity.Service{Name: "Netflix", Price: 599}, UserID: userID,
+		Status: entity.StatusActive, StartDate: day(2025, 1, 1),
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	_, err = r.CreateSubscription(ctx, entity.Subscription{
+		Service: entity.Service{Name: "Netflix", Price: 799}, UserID: userID,
+		Status: entity.StatusActive, StartDate: day(2025, 6, 1),
+	})
+	var overlapErr *repoerrs.OverlapError
+	if !errors.As(err, &overlapErr) || overlapErr.SubscriptionID != first.ID {
+		t.Fatalf("CreateSubscription at another price = %v, want an overlap with %s", err, first.ID)
+	}
+
+	var otherServiceID uuid.UUID
+	if err := pool.QueryRow(ctx, "INSERT INTO services (name, price) VALUES ('Netflix', 999) RETURNING id").Scan(&otherServiceID); err != nil {
+		t.Fatalf("insert service: %v", err)
+	}
+	_, err = pool.Exec(ctx, `
+		INSERT INTO subscriptions (id, service_id, service_name, user_id, status, start_date)
+		VALUES ($1, $2, 'Netflix', $3, 'active', '2025-06-01')`, uuid.New(), otherServiceID, userID)
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != exclusionViolation {
+		t.Errorf("insert bypassing the check = %v, want an exclusion violation", err)
+	}
+}
+
+// TestUpdateKeepsLegacyExemption runs against PostgreSQL: subscriptions that
+// overlapped before the exclusion constraint and were exempted by the
+// migration stay editable as long as the period is left alone.
+func TestUpdateKeepsLegacyExemption(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepo(pool)
+
+	userID := uuid.New()
+	var serviceID uuid.UUID
+	if err := pool.QueryRow(ctx, "INSERT INTO services (name, price) VALUES ('Netflix', 599) RETURNING id").Scan(&serviceID); err != nil {
+		t.Fatalf("insert service: %v", err)
+	}
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	for i, start := range []string{"2025-01-01", "2025-03-01"} {
+		_, err := pool.Exec(ctx, `
+			INSERT INTO subscriptions (id, service_id, service_name, user_id, status, start_date, overlap_allowed)
+			VALUES ($1, $2, 'Netflix', $3, 'active', $4, TRUE)`, ids[i], serviceID, userID, start)
+		if err != nil {
+			t.Fatalf("insert legacy subscription: %v", err)
+		}
+	}
+
+	sub, err := r.GetSubscriptionByID(ctx, ids[1])
+	if err != nil {
+		t.Fatalf("GetSubscriptionByID: %v", err)
+	}
+	sub.Notes = "shared with family"
+	if err := r.UpdateSubscription(ctx, &sub); err != nil {
+		t.Fatalf("UpdateSubscription of the notes = %v, want the exemption kept", err)
+	}
+
+	sub.Notes = "renamed in a batch"
+	results, err := r.UpdateSubscriptions(ctx, []entity.Subscription{sub}, true)
+	if err != nil || results[0].Err != nil {
+		t.Fatalf("UpdateSubscriptions of the notes = %v, %v; want the exemption kept", err, results[0].Err)
+	}
+
+	var exempt bool
+	if err := pool.QueryRow(ctx, "SELECT overlap_allowed FROM subscriptions WHERE id = $1", ids[1]).Scan(&exempt); err != nil {
+		t.Fatalf("load exemption: %v", err)
+	}
+	if !exempt {
+		t.Error("overlap_allowed was cleared by an update that left the period alone")
+	}
+
+	end := day(2025, 12, 31)
+	sub.EndDate = &end
+	var overlapErr *repoerrs.OverlapError
+	if err := r.UpdateSubscription(ctx, &sub); !errors.As(err, &overlapErr) || overlapErr.SubscriptionID != ids[0] {
+		t.Errorf("UpdateSubscription of the period = %v, want an overlap with %s", err, ids[0])
+	}
+}
@@ -0,0 +1,40 @@
+package pgdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// notPausedIn is a condition that holds when subscription s is not paused in
+// the month given by the SQL expression month.
+func notPausedIn(month string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+		SELECT 1 FROM subscription_pauses p
+		WHERE p.subscription_id = s.id
+			AND p.paused_from <= %[1]s
+			AND (p.resumed_from IS NULL OR p.resumed_from > %[1]s)
+	)`, month)
+}
+
+func openPause(ctx context.Context, q querier, subscriptionID uuid.UUID, pausedFrom time.Time) error {
+	_, err := q.Exec(ctx,
+		"INSERT INTO subscription_pauses (subscription_id, paused_from) VALUES ($1, $2::date)",
+		subscriptionID, pausedFrom)
+	if err != nil {
+		return fmt.Errorf("open pause: %v", err)
+	}
+	return nil
+}
+
+func closePause(ctx context.Context, q querier, subscriptionID uuid.UUID, resumedFrom time.Time) error {
+	_, err := q.Exec(ctx,
+		"UPDATE subscription_pauses SET resumed_from = $2::date WHERE subscription_id = $1 AND resumed_from IS NULL",
+		subscriptionID, resumedFrom)
+	if err != nil {
+		return fmt.Errorf("close pause: %v", err)
+	}
+	return nil
+}
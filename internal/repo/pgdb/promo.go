@@ -0,0 +1,123 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// netPriceIn is the price subscription s with service svc is charged for the
+// month given by the SQL expression month. It mirrors entity.NetPrice.
+func netPriceIn(month string) string {
+	return fmt.Sprintf(`CASE
+		WHEN s.trial_end IS NOT NULL AND %[1]s < date_trunc('month', s.trial_end) THEN 0
+		WHEN s.discount_type IS NULL THEN svc.price
+		WHEN s.discount_months IS NOT NULL
+			AND %[1]s >= GREATEST(date_trunc('month', s.start_date), date_trunc('month', COALESCE(s.trial_end, s.start_date)))
+				+ make_interval(months => s.discount_months) THEN svc.price
+		WHEN s.discount_type = 'percent' THEN svc.price * (100 - s.discount_value) / 100
+		ELSE GREATEST(svc.price - s.discount_value, 0)
+	END`, month)
+}
+
+var promoCodeColumns = []string{"code", "discount_type", "discount_value", "discount_months", "valid_until", "created_at"}
+
+func scanPromoCode(row pgx.Row) (entity.PromoCode, error) {
+	var p entity.PromoCode
+	err := row.Scan(&p.Code, &p.Type, &p.Value, &p.Months, &p.ValidUntil, &p.CreatedAt)
+	return p, err
+}
+
+type PromoCodeRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewPromoCodeRepo(pg *pgxpool.Pool) *PromoCodeRepo {
+	return &PromoCodeRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+func (r *PromoCodeRepo) CreatePromoCode(ctx context.Context, promo entity.PromoCode) (*entity.PromoCode, error) {
+	sql, args, err := r.psql.
+		Insert("promo_codes").
+		Columns("code", "discount_type", "discount_value", "discount_months", "valid_until").
+		Values(promo.Code, promo.Type, promo.Value, promo.Months, promo.ValidUntil).
+		Suffix("RETURNING created_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("PromoCodeRepo.CreatePromoCode - sql build: %v", err)
+	}
+
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&promo.CreatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, repoerrs.ErrAlreadyExists
+		}
+		return nil, fmt.Errorf("PromoCodeRepo.CreatePromoCode - query exec: %v", err)
+	}
+
+	return &promo, nil
+}
+
+func (r *PromoCodeRepo) GetPromoCode(ctx context.Context, code string) (entity.PromoCode, error) {
+	sql, args, err := r.psql.
+		Select(promoCodeColumns...).
+		From("promo_codes").
+		Where("code = ?", code).
+		ToSql()
+	if err != nil {
+		return entity.PromoCode{}, fmt.Errorf("PromoCodeRepo.GetPromoCode - sql build: %v", err)
+	}
+
+	promo, err := scanPromoCode(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.PromoCode{}, repoerrs.ErrNotFound
+		}
+		return entity.PromoCode{}, fmt.Errorf("PromoCodeRepo.GetPromoCode - query exec: %v", err)
+	}
+
+	return promo, nil
+}
+
+func (r *PromoCodeRepo) ListPromoCodes(ctx context.Context) ([]entity.PromoCode, error) {
+	sql, args, err := r.psql.
+		Select(promoCodeColumns...).
+		From("promo_codes").
+		OrderBy("created_at DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("PromoCodeRepo.ListPromoCodes - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("PromoCodeRepo.ListPromoCodes - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var promos []entity.PromoCode
+	for rows.Next() {
+		promo, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("PromoCodeRepo.ListPromoCodes - row scan: %v", err)
+		}
+		promos = append(promos, promo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("PromoCodeRepo.ListPromoCodes - rows error: %v", err)
+	}
+
+	return promos, nil
+}
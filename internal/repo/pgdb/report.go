@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
 	"github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -22,22 +23,28 @@ func NewReportRepo(pg *pgxpool.Pool) *ReportRepo {
 	}
 }
 
+// openPauseEnd stands in for the missing resumed_from of an open pause, since
+// NULL array elements cannot be scanned into time.Time.
+var openPauseEnd = time.Date(9999, time.December, 1, 0, 0, 0, 0, time.UTC)
+
 func (r *ReportRepo) GetTotalCost(
 	ctx context.Context,
 	userID *uuid.UUID,
 	serviceName *string,
 	startDate, endDate time.Time,
-) ([]struct {
-	Price     int
-	StartDate time.Time
-	EndDate   *time.Time
-}, error) {
+) ([]entity.SubscriptionCost, error) {
 	qb := r.psql.
-		Select("svc.price", "s.start_date", "s.end_date").
+		Select(
+			"s.user_id", "svc.name", "svc.price", "s.start_date", "s.end_date", "s.trial_end",
+			"s.discount_type", "s.discount_value", "s.discount_months", "s.promo_code",
+			"ARRAY(SELECT p.paused_from FROM subscription_pauses p WHERE p.subscription_id = s.id ORDER BY p.paused_from)",
+			"ARRAY(SELECT COALESCE(p.resumed_from, DATE '9999-12-01') FROM subscription_pauses p WHERE p.subscription_id = s.id ORDER BY p.paused_from)",
+		).
 		From("subscriptions s").
 		Join("services svc ON s.service_id = svc.id").
-		Where("s.start_date <= ?", endDate).
-		Where("(s.end_date IS NULL OR s.end_date >= ?)", startDate)
+		Where("date_trunc('month', s.start_date) <= ?", endDate).
+		Where("(s.end_date IS NULL OR s.end_date >= ?)", startDate).
+		OrderBy("s.start_date", "s.id")
 
 	if userID != nil {
 		qb = qb.Where("s.user_id = ?", *userID)
@@ -58,20 +65,34 @@ func (r *ReportRepo) GetTotalCost(
 	}
 	defer rows.Close()
 
-	var costData []struct {
-		Price     int
-		StartDate time.Time
-		EndDate   *time.Time
-	}
+	var costData []entity.SubscriptionCost
 	for rows.Next() {
-		var data struct {
-			Price     int
-			StartDate time.Time
-			EndDate   *time.Time
-		}
-		if err := rows.Scan(&data.Price, &data.StartDate, &data.EndDate); err != nil {
+		var (
+			data                    entity.SubscriptionCost
+			discountType            *entity.DiscountType
+			discountValue           *int
+			discount                entity.Discount
+			pausedFrom, resumedFrom []time.Time
+		)
+		err := rows.Scan(
+			&data.UserID, &data.ServiceName, &data.Price, &data.StartDate, &data.EndDate, &data.TrialEnd,
+			&discountType, &discountValue, &discount.Months, &discount.PromoCode,
+			&pausedFrom, &resumedFrom,
+		)
+		if err != nil {
 			return nil, fmt.Errorf("ReportRepo.GetTotalCostData - row scan: %w", err)
 		}
+		if discountType != nil && discountValue != nil {
+			discount.Type, discount.Value = *discountType, *discountValue
+			data.Discount = &discount
+		}
+		for i := range pausedFrom {
+			pause := entity.PausePeriod{From: pausedFrom[i]}
+			if !resumedFrom[i].Equal(openPauseEnd) {
+				pause.Until = &resumedFrom[i]
+			}
+			data.Pauses = append(data.Pauses, pause)
+		}
 		costData = append(costData, data)
 	}
 
@@ -81,3 +102,56 @@ func (r *ReportRepo) GetTotalCost(
 
 	return costData, nil
 }
+
+// StreamCostBreakdown calls fn for every month of the period with an active
+// subscription without loading the whole result into memory. Like
+// CalculateTotalCost and monthly_costs snapshots, a month is charged once, by
+// the earliest subscription active and not paused in it, so the rows add up
+// to the total cost of the same filters.
+func (r *ReportRepo) StreamCostBreakdown(
+	ctx context.Context,
+	userID *uuid.UUID,
+	serviceName *string,
+	startDate, endDate time.Time,
+	fn func(entity.CostBreakdownItem) error,
+) error {
+	qb := activeMonths(r.psql, startDate, endDate).
+		Options("DISTINCT ON (m.month)").
+		Columns("m.month", "s.user_id", "svc.name", "svc.price", netPriceIn("m.month")).
+		OrderBy("m.month", "s.start_date", "s.id")
+
+	if userID != nil {
+		qb = qb.Where("s.user_id = ?", *userID)
+	}
+
+	if serviceName != nil {
+		qb = qb.Where("svc.name = ?", *serviceName)
+	}
+
+	sql, args, err := qb.ToSql()
+	if err != nil {
+		return fmt.Errorf("ReportRepo.StreamCostBreakdown - sql build: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("ReportRepo.StreamCostBreakdown - query exec: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item entity.CostBreakdownItem
+		if err := rows.Scan(&item.Month, &item.UserID, &item.ServiceName, &item.Cost, &item.NetCost); err != nil {
+			return fmt.Errorf("ReportRepo.StreamCostBreakdown - row scan: %w", err)
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ReportRepo.StreamCostBreakdown - rows error: %w", err)
+	}
+
+	return nil
+}
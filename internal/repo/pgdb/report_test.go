@@ -0,0 +1,73 @@
+package pgdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/google/uuid"
+)
+
+// TestStreamCostBreakdownChargesMonthOnce runs against PostgreSQL: like
+// CalculateTotalCost, every month is charged once, by the earliest
+// subscription active in it.
+func TestStreamCostBreakdownChargesMonthOnce(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	subs := NewSubscriptionRepo(pool)
+	r := NewReportRepo(pool)
+
+	anna, boris := uuid.New(), uuid.New()
+	borisEnd := day(2025, 2, 15)
+	for _, sub := range []entity.Subscription{
+		{Service: entity.Service{Name: "Netflix", Price: 100}, UserID: anna, Status: entity.StatusActive, StartDate: day(2025, 2, 1)},
+		{Service: entity.Service{Name: "Spotify", Price: 200}, UserID: boris, Status: entity.StatusActive, StartDate: day(2025, 1, 1), EndDate: &borisEnd},
+	} {
+		if _, err := subs.CreateSubscription(ctx, sub); err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+	}
+
+	breakdown := func(userID *uuid.UUID) []entity.CostBreakdownItem {
+		t.Helper()
+		var items []entity.CostBreakdownItem
+		err := r.StreamCostBreakdown(ctx, userID, nil, day(2025, 1, 1), day(2025, 3, 1), func(item entity.CostBreakdownItem) error {
+			items = append(items, item)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StreamCostBreakdown: %v", err)
+		}
+		return items
+	}
+
+	tests := []struct {
+		name   string
+		userID *uuid.UUID
+		want   []entity.CostBreakdownItem
+	}{
+		{"all users", nil, []entity.CostBreakdownItem{
+			{Month: day(2025, 1, 1), UserID: boris, ServiceName: "Spotify", Cost: 200, NetCost: 200},
+			{Month: day(2025, 2, 1), UserID: boris, ServiceName: "Spotify", Cost: 200, NetCost: 200},
+			{Month: day(2025, 3, 1), UserID: anna, ServiceName: "Netflix", Cost: 100, NetCost: 100},
+		}},
+		{"one user", &anna, []entity.CostBreakdownItem{
+			{Month: day(2025, 2, 1), UserID: anna, ServiceName: "Netflix", Cost: 100, NetCost: 100},
+			{Month: day(2025, 3, 1), UserID: anna, ServiceName: "Netflix", Cost: 100, NetCost: 100},
+		}},
+	}
+	for _, tt := range tests {
+		got := breakdown(tt.userID)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d rows %v, want %v", tt.name, len(got), got, tt.want)
+			continue
+		}
+		for i := range got {
+			got[i].Month = got[i].Month.UTC()
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: row %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package pgdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx, so helpers can run
+// inside or outside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type SnapshotRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewSnapshotRepo(pg *pgxpool.Pool) *SnapshotRepo {
+	return &SnapshotRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// GetSnapshotCosts returns the snapshotted cost of every fresh month in the
+// period. Months that were never refreshed or are stale are omitted. Like the
+// live calculation, a month is charged once, by the earliest subscription.
+func (r *SnapshotRepo) GetSnapshotCosts(
+	ctx context.Context,
+	userID *uuid.UUID,
+	serviceName *string,
+	startDate, endDate time.Time,
+) ([]entity.MonthlyCost, error) {
+	charge := squirrel.
+		Select("mc.cost", "mc.net_cost").
+		From("monthly_costs mc").
+		Where("mc.month = r.month").
+		OrderBy("mc.start_date", "mc.subscription_id").
+		Limit(1)
+	if userID != nil {
+		charge = charge.Where(squirrel.Eq{"mc.user_id": *userID})
+	}
+	if serviceName != nil {
+		charge = charge.Where(squirrel.Eq{"mc.service_name": *serviceName})
+	}
+	chargeSQL, chargeArgs, err := charge.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.GetSnapshotCosts - charge sql build: %v", err)
+	}
+
+	sql, args, err := r.psql.
+		Select("r.month", "COALESCE(mc.cost, 0)", "COALESCE(mc.net_cost, 0)").
+		From("monthly_cost_refreshes r").
+		LeftJoin("LATERAL ("+chargeSQL+") mc ON TRUE", chargeArgs...).
+		Where("r.month BETWEEN ? AND ?", startDate, endDate).
+		Where("NOT r.stale").
+		OrderBy("r.month").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.GetSnapshotCosts - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.GetSnapshotCosts - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var costs []entity.MonthlyCost
+	for rows.Next() {
+		var c entity.MonthlyCost
+		if err := rows.Scan(&c.Month, &c.Cost, &c.NetCost); err != nil {
+			return nil, fmt.Errorf("SnapshotRepo.GetSnapshotCosts - row scan: %v", err)
+		}
+		costs = append(costs, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.GetSnapshotCosts - rows error: %v", err)
+	}
+
+	return costs, nil
+}
+
+// ListStaleMonths returns months up to and including until, starting from the
+// earliest subscription, that have no fresh snapshot.
+func (r *SnapshotRepo) ListStaleMonths(ctx context.Context, until time.Time, limit int) ([]time.Time, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT gs.month::date
+		FROM generate_series(
+			(SELECT date_trunc('month', MIN(start_date)) FROM subscriptions),
+			$1::date,
+			interval '1 month'
+		) AS gs(month)
+		LEFT JOIN monthly_cost_refreshes r ON r.month = gs.month::date
+		WHERE r.month IS NULL OR r.stale
+		ORDER BY 1
+		LIMIT $2`, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.ListStaleMonths - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var months []time.Time
+	for rows.Next() {
+		var month time.Time
+		if err := rows.Scan(&month); err != nil {
+			return nil, fmt.Errorf("SnapshotRepo.ListStaleMonths - row scan: %v", err)
+		}
+		months = append(months, month)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.ListStaleMonths - rows error: %v", err)
+	}
+
+	return months, nil
+}
+
+// RefreshMonth rebuilds the snapshot of a single month. The marker row is
+// written first so that a concurrent invalidation waits for this transaction
+// and marks the month stale again afterwards instead of being lost.
+func (r *SnapshotRepo) RefreshMonth(ctx context.Context, month time.Time) error {
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO monthly_cost_refreshes (month, stale, refreshed_at)
+			VALUES ($1::date, FALSE, NOW())
+			ON CONFLICT (month) DO UPDATE SET stale = FALSE, refreshed_at = NOW()`, month)
+		if err != nil {
+			return fmt.Errorf("mark refreshed: %v", err)
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM monthly_costs WHERE month = $1::date", month); err != nil {
+			return fmt.Errorf("delete old snapshot: %v", err)
+		}
+
+		// Every user and service keeps the earliest subscription active in the
+		// month, which is the one charged for it; paused months are not
+		// charged. cost is the list price and net_cost the price after trials
+		// and discounts.
+		_, err = tx.Exec(ctx, `
+			INSERT INTO monthly_costs (user_id, service_name, month, subscription_id, start_date, cost, net_cost, refreshed_at)
+			SELECT DISTINCT ON (s.user_id, svc.name)
+				s.user_id, svc.name, $1::date, s.id, s.start_date, svc.price, `+netPriceIn("$1::date")+`, NOW()
+			FROM subscriptions s
+			JOIN services svc ON svc.id = s.service_id
+			WHERE date_trunc('month', s.start_date) <= $1::date
+				AND (s.end_date IS NULL OR s.end_date >= $1::date)
+				AND `+notPausedIn("$1::date")+`
+			ORDER BY s.user_id, svc.name, s.start_date, s.id`, month)
+		if err != nil {
+			return fmt.Errorf("insert snapshot: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("SnapshotRepo.RefreshMonth - %v", err)
+	}
+	return nil
+}
+
+// GetMonthVersions returns how often each month of the period was
+// invalidated. Months that never were are omitted, their version is 0.
+func (r *SnapshotRepo) GetMonthVersions(ctx context.Context, startDate, endDate time.Time) (map[time.Time]int64, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT month, version FROM monthly_cost_refreshes
+		WHERE month BETWEEN $1::date AND $2::date AND version > 0`, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.GetMonthVersions - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[time.Time]int64)
+	for rows.Next() {
+		var (
+			month   time.Time
+			version int64
+		)
+		if err := rows.Scan(&month, &version); err != nil {
+			return nil, fmt.Errorf("SnapshotRepo.GetMonthVersions - row scan: %v", err)
+		}
+		versions[month] = version
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SnapshotRepo.GetMonthVersions - rows error: %v", err)
+	}
+
+	return versions, nil
+}
+
+// invalidateMonthlyCosts marks the closed months between from and to as stale
+// and bumps their version, which drops cached analytics of them. A nil to
+// means the subscription is open-ended. It is meant to run in the same
+// transaction as the subscription change.
+func invalidateMonthlyCosts(ctx context.Context, q querier, from time.Time, to *time.Time) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO monthly_cost_refreshes (month, stale, version)
+		SELECT gs.month::date, TRUE, 1
+		FROM generate_series(
+			date_trunc('month', $1::date),
+			LEAST(date_trunc('month', COALESCE($2::date, CURRENT_DATE)), date_trunc('month', CURRENT_DATE) - interval '1 month'),
+			interval '1 month'
+		) AS gs(month)
+		ON CONFLICT (month) DO UPDATE SET stale = TRUE, version = monthly_cost_refreshes.version + 1`, from, to)
+	if err != nil {
+		return fmt.Errorf("invalidate monthly costs: %v", err)
+	}
+	return nil
+}
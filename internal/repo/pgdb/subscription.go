@@ -2,8 +2,12 @@ package pgdb
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
@@ -26,55 +30,210 @@ func NewSubscriptionRepo(pg *pgxpool.Pool) *SubscriptionRepo {
 	}
 }
 
-func (r *SubscriptionRepo) CreateSubscription(ctx context.Context, sub entity.Subscription) (*entity.Subscription, error) {
-	var serviceID uuid.UUID
-	err := r.pool.QueryRow(ctx, "SELECT id FROM services WHERE name = $1 AND price = $2", sub.Service.Name, sub.Service.Price).Scan(&serviceID)
+// subscriptionColumns is the column list scanSubscription expects, for
+// queries over "subscriptions s JOIN services svc".
+var subscriptionColumns = []string{
+	"s.id", "s.user_id", "s.status", "s.start_date", "s.end_date", "s.trial_end",
+	"s.discount_type", "s.discount_value", "s.discount_months", "s.promo_code", "s.auto_renew", "COALESCE(s.notes, '')", "s.metadata", "s.created_at",
+	"svc.id", "svc.name", "svc.price", "COALESCE(svc.category, '')",
+}
+
+// scanSubscription reads subscriptionColumns, followed by any extra columns
+// into extra.
+func scanSubscription(row pgx.Row, extra ...any) (entity.Subscription, error) {
+	var (
+		sub           entity.Subscription
+		discountType  *entity.DiscountType
+		discountValue *int
+		discount      entity.Discount
+	)
+	dest := []any{
+		&sub.ID,
+		&sub.UserID,
+		&sub.Status,
+		&sub.StartDate,
+		&sub.EndDate,
+		&sub.TrialEnd,
+		&discountType,
+		&discountValue,
+		&discount.Months,
+		&discount.PromoCode,
+		&sub.AutoRenew,
+		&sub.Notes,
+		&sub.Metadata,
+		&sub.CreatedAt,
+		&sub.Service.ID,
+		&sub.Service.Name,
+		&sub.Service.Price,
+		&sub.Service.Category,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err == nil && discountType != nil && discountValue != nil {
+		discount.Type, discount.Value = *discountType, *discountValue
+		sub.Discount = &discount
+	}
+	return sub, err
+}
+
+// loadSubscription reads a subscription inside a transaction, so the state
+// written to the outbox matches what the transaction commits.
+func loadSubscription(ctx context.Context, q querier, id uuid.UUID) (entity.Subscription, error) {
+	sub, err := scanSubscription(q.QueryRow(ctx, "SELECT "+strings.Join(subscriptionColumns, ", ")+`
+		FROM subscriptions s
+		JOIN services svc ON s.service_id = svc.id
+		WHERE s.id = $1`, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			sql, args, err := r.psql.
-				Insert("services").
-				Columns("name", "price").
-				Values(sub.Service.Name, sub.Service.Price).
-				Suffix("RETURNING id").
-				ToSql()
-			if err != nil {
-				return nil, fmt.Errorf("SubscriptionRepo.CreateSubscription - service sql build: %v", err)
-			}
-			err = r.pool.QueryRow(ctx, sql, args...).Scan(&serviceID)
+			return entity.Subscription{}, repoerrs.ErrNotFound
+		}
+		return entity.Subscription{}, fmt.Errorf("load subscription: %v", err)
+	}
+	return sub, nil
+}
+
+// writeChangedEvent reloads subscription id and writes an event about its new
+// state to the outbox.
+func writeChangedEvent(ctx context.Context, q querier, eventType entity.EventType, id uuid.UUID) error {
+	sub, err := loadSubscription(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	return writeSubscriptionEvent(ctx, q, eventType, sub)
+}
+
+// nullString stores an empty string as NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// metadataValue stores metadata as a jsonb object, nil as an empty one.
+func metadataValue(metadata map[string]string) squirrel.Sqlizer {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	// Encoding a map of strings cannot fail.
+	data, _ := json.Marshal(metadata)
+	return squirrel.Expr("?::jsonb", string(data))
+}
+
+// discountValues returns the discount_* and promo_code column values of d.
+func discountValues(d *entity.Discount) (discountType *entity.DiscountType, value, months *int, promoCode *string) {
+	if d == nil {
+		return nil, nil, nil, nil
+	}
+	return &d.Type, &d.Value, d.Months, d.PromoCode
+}
+
+// getOrCreateService finds a service with the same name and price or creates
+// a new one. A category is only recorded on a service that has none yet.
+func (r *SubscriptionRepo) getOrCreateService(ctx context.Context, q querier, svc entity.Service) (uuid.UUID, error) {
+	var category *string
+	if svc.Category != "" {
+		category = &svc.Category
+	}
+
+	var serviceID uuid.UUID
+	err := q.QueryRow(ctx, "SELECT id FROM services WHERE name = $1 AND price = $2", svc.Name, svc.Price).Scan(&serviceID)
+	if err == nil {
+		if category != nil {
+			_, err := q.Exec(ctx, "UPDATE services SET category = $2 WHERE id = $1 AND category IS NULL", serviceID, category)
 			if err != nil {
-				return nil, fmt.Errorf("SubscriptionRepo.CreateSubscription - service query exec: %v", err)
+				return uuid.Nil, fmt.Errorf("service category update: %v", err)
 			}
-		} else {
-			return nil, fmt.Errorf("SubscriptionRepo.CreateSubscription - service query: %v", err)
 		}
+		return serviceID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("service query: %v", err)
 	}
-
-	sub.Service.ID = serviceID
 
 	sql, args, err := r.psql.
-		Insert("subscriptions").
-		Columns("id", "service_id", "user_id", "start_date", "end_date", "created_at").
-		Values(uuid.New(), serviceID, sub.UserID, sub.StartDate, sub.EndDate, "NOW()").
-		Suffix("RETURNING id, created_at").
+		Insert("services").
+		Columns("name", "price", "category").
+		Values(svc.Name, svc.Price, category).
+		Suffix("RETURNING id").
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("SubscriptionRepo.CreateSubscription - subscription sql build: %v", err)
+		return uuid.Nil, fmt.Errorf("service sql build: %v", err)
+	}
+	if err := q.QueryRow(ctx, sql, args...).Scan(&serviceID); err != nil {
+		return uuid.Nil, fmt.Errorf("service query exec: %v", err)
 	}
+	return serviceID, nil
+}
+
+func (r *SubscriptionRepo) CreateSubscription(ctx context.Context, sub entity.Subscription) (*entity.Subscription, error) {
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		serviceID, err := r.getOrCreateService(ctx, tx, sub.Service)
+		if err != nil {
+			return err
+		}
+		sub.Service.ID = serviceID
+		sub.ID = uuid.New()
+
+		exempt, errs, err := applyOverlapPolicy(ctx, tx, []*entity.Subscription{&sub})
+		if err != nil {
+			return err
+		}
+		if errs[0] != nil {
+			return errs[0]
+		}
+
+		discountType, discountValue, discountMonths, promoCode := discountValues(sub.Discount)
+		sql, args, err := r.psql.
+			Insert("subscriptions").
+			Columns(
+				"id", "service_id", "service_name", "user_id", "status", "start_date", "end_date", "trial_end",
+				"discount_type", "discount_value", "discount_months", "promo_code", "auto_renew", "notes", "metadata",
+				"overlap_allowed", "created_at",
+			).
+			Values(
+				sub.ID, serviceID, sub.Service.Name, sub.UserID, sub.Status, sub.StartDate, sub.EndDate, sub.TrialEnd,
+				discountType, discountValue, discountMonths, promoCode, sub.AutoRenew, nullString(sub.Notes), metadataValue(sub.Metadata),
+				exempt[0], "NOW()",
+			).
+			Suffix("RETURNING id, created_at").
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("subscription sql build: %v", err)
+		}
+
+		err = tx.QueryRow(ctx, sql, args...).Scan(&sub.ID, &sub.CreatedAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return repoerrs.ErrAlreadyExists
+			}
+			if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+				return repoerrs.ErrOverlap
+			}
+			return fmt.Errorf("subscription query exec: %v", err)
+		}
 
-	err = r.pool.QueryRow(ctx, sql, args...).Scan(&sub.ID, &sub.CreatedAt)
+		if err := invalidateMonthlyCosts(ctx, tx, sub.StartDate, sub.EndDate); err != nil {
+			return err
+		}
+		return writeChangedEvent(ctx, tx, entity.EventSubscriptionCreated, sub.ID)
+	})
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return nil, repoerrs.ErrAlreadyExists
+		if errors.Is(err, repoerrs.ErrOverlap) {
+			return nil, overlapFailure(ctx, r.pool, &sub, err)
 		}
-		return nil, fmt.Errorf("SubscriptionRepo.CreateSubscription - subscription query exec: %v", err)
+		if errors.Is(err, repoerrs.ErrAlreadyExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("SubscriptionRepo.CreateSubscription - %v", err)
 	}
 
 	return &sub, nil
 }
+
 func (r *SubscriptionRepo) GetSubscriptionByID(ctx context.Context, id uuid.UUID) (entity.Subscription, error) {
 	sql, args, err := r.psql.
-		Select("s.id", "s.user_id", "s.start_date", "s.end_date", "s.created_at", "svc.id", "svc.name", "svc.price").
+		Select(subscriptionColumns...).
 		From("subscriptions s").
 		Join("services svc ON s.service_id = svc.id").
 		Where("s.id = ?", id).
@@ -83,18 +242,7 @@ func (r *SubscriptionRepo) GetSubscriptionByID(ctx context.Context, id uuid.UUID
 		return entity.Subscription{}, fmt.Errorf("SubscriptionRepo.GetSubscriptionByID - sql build: %v", err)
 	}
 
-	var sub entity.Subscription
-	err = r.pool.QueryRow(ctx, sql, args...).Scan(
-		&sub.ID,
-		&sub.UserID,
-		&sub.StartDate,
-		&sub.EndDate,
-		&sub.CreatedAt,
-		&sub.Service.ID,
-		&sub.Service.Name,
-		&sub.Service.Price,
-	)
-
+	sub, err := scanSubscription(r.pool.QueryRow(ctx, sql, args...))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return entity.Subscription{}, repoerrs.ErrNotFound
@@ -105,127 +253,729 @@ func (r *SubscriptionRepo) GetSubscriptionByID(ctx context.Context, id uuid.UUID
 	return sub, nil
 }
 
-func (r *SubscriptionRepo) UpdateSubscription(ctx context.Context, sub entity.Subscription) error {
-	// First, try to find an existing service with the same name and price.
-	// If not found, create a new service.
-	var serviceID uuid.UUID
-	err := r.pool.QueryRow(ctx, "SELECT id FROM services WHERE name = $1 AND price = $2", sub.Service.Name, sub.Service.Price).Scan(&serviceID)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			// Service not found, create a new one
-			sql, args, err := r.psql.
-				Insert("services").
-				Columns("name", "price").
-				Values(sub.Service.Name, sub.Service.Price).
-				Suffix("RETURNING id").
-				ToSql()
-			if err != nil {
-				return fmt.Errorf("SubscriptionRepo.UpdateSubscription - service sql build: %v", err)
+// UpdateSubscription stores the changes of sub, filling in the overlapped
+// subscriptions when its policy reports them.
+func (r *SubscriptionRepo) UpdateSubscription(ctx context.Context, sub *entity.Subscription) error {
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var (
+			stored       entity.Subscription
+			storedExempt bool
+		)
+		err := tx.QueryRow(ctx, `
+			SELECT user_id, service_name, start_date, end_date, overlap_allowed
+			FROM subscriptions WHERE id = $1 FOR UPDATE`, sub.ID).
+			Scan(&stored.UserID, &stored.Service.Name, &stored.StartDate, &stored.EndDate, &storedExempt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repoerrs.ErrNotFound
 			}
-			err = r.pool.QueryRow(ctx, sql, args...).Scan(&serviceID)
+			return fmt.Errorf("lock subscription: %v", err)
+		}
+		oldStart, oldEnd := stored.StartDate, stored.EndDate
+
+		serviceID, err := r.getOrCreateService(ctx, tx, sub.Service)
+		if err != nil {
+			return err
+		}
+
+		exempt := []bool{true}
+		if !storedExempt || !keepsExemption(&stored, sub) {
+			var errs []error
+			exempt, errs, err = applyOverlapPolicy(ctx, tx, []*entity.Subscription{sub})
 			if err != nil {
-				return fmt.Errorf("SubscriptionRepo.UpdateSubscription - service query exec: %v", err)
+				return err
+			}
+			if errs[0] != nil {
+				return errs[0]
+			}
+		}
+
+		sql, args, err := r.psql.
+			Update("subscriptions").
+			Set("service_id", serviceID).
+			Set("service_name", sub.Service.Name).
+			Set("user_id", sub.UserID).
+			Set("start_date", sub.StartDate).
+			Set("end_date", sub.EndDate).
+			Set("auto_renew", sub.AutoRenew).
+			Set("notes", nullString(sub.Notes)).
+			Set("metadata", metadataValue(sub.Metadata)).
+			Set("overlap_allowed", exempt[0]).
+			Where("id = ?", sub.ID).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("sql build: %v", err)
+		}
+
+		result, err := tx.Exec(ctx, sql, args...)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+				return repoerrs.ErrOverlap
 			}
-		} else {
-			return fmt.Errorf("SubscriptionRepo.UpdateSubscription - service query: %v", err)
+			return fmt.Errorf("query exec: %v", err)
+		}
+		if result.RowsAffected() == 0 {
+			return repoerrs.ErrNotFound
+		}
+
+		// Both the old and the new period may touch closed months.
+		if err := invalidateMonthlyCosts(ctx, tx, oldStart, oldEnd); err != nil {
+			return err
+		}
+		if err := invalidateMonthlyCosts(ctx, tx, sub.StartDate, sub.EndDate); err != nil {
+			return err
+		}
+		return writeChangedEvent(ctx, tx, entity.EventSubscriptionUpdated, sub.ID)
+	})
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrOverlap) {
+			return overlapFailure(ctx, r.pool, sub, err)
+		}
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return err
 		}
+		return fmt.Errorf("SubscriptionRepo.UpdateSubscription - %v", err)
 	}
 
-	sql, args, err := r.psql.
-		Update("subscriptions").
-		Set("service_id", serviceID).
-		Set("user_id", sub.UserID).
-		Set("start_date", sub.StartDate).
-		Set("end_date", sub.EndDate).
-		Where("id = ?", sub.ID).
+	return nil
+}
+
+func (r *SubscriptionRepo) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM subscriptions WHERE id = $1 FOR UPDATE", id); err != nil {
+			return fmt.Errorf("lock subscription: %v", err)
+		}
+		// The event carries the last state of the subscription.
+		sub, err := loadSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM subscriptions WHERE id = $1", id); err != nil {
+			return fmt.Errorf("query exec: %v", err)
+		}
+		if err := invalidateMonthlyCosts(ctx, tx, sub.StartDate, sub.EndDate); err != nil {
+			return err
+		}
+		return writeSubscriptionEvent(ctx, tx, entity.EventSubscriptionDeleted, sub)
+	})
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("SubscriptionRepo.DeleteSubscription - %v", err)
+	}
+
+	return nil
+}
+
+// subscriptionSortColumns whitelists the columns a listing may be sorted by.
+var subscriptionSortColumns = map[entity.SubscriptionSortField]string{
+	entity.SortByStartDate:   "s.start_date",
+	entity.SortByCreatedAt:   "s.created_at",
+	entity.SortByPrice:       "svc.price",
+	entity.SortByServiceName: "svc.name",
+}
+
+// orderSubscriptions returns the ORDER BY terms of sort, ending with the ID
+// so that pages are stable when the sort column ties.
+func orderSubscriptions(sort entity.SubscriptionSort) []string {
+	column, ok := subscriptionSortColumns[sort.Field]
+	if !ok {
+		column = subscriptionSortColumns[entity.SortByStartDate]
+	}
+	direction := " DESC"
+	if sort.Asc {
+		direction = " ASC"
+	}
+	return []string{column + direction, "s.id" + direction}
+}
+
+// likePrefix escapes the LIKE wildcards in prefix and appends one.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+// filterSubscriptions applies filter to a query over "subscriptions s JOIN
+// services svc". The user predicate is left to the caller.
+func filterSubscriptions(qb squirrel.SelectBuilder, filter entity.SubscriptionFilter) squirrel.SelectBuilder {
+	if filter.ActiveOnly {
+		qb = qb.
+			Where(squirrel.Eq{"s.status": []string{string(entity.StatusTrial), string(entity.StatusActive)}}).
+			Where("(s.end_date IS NULL OR s.end_date >= date_trunc('month', CURRENT_DATE))")
+	}
+	if filter.ServiceName != nil {
+		qb = qb.Where("svc.name = ?", *filter.ServiceName)
+	}
+	if filter.ServiceNamePrefix != nil {
+		qb = qb.Where("lower(svc.name) LIKE lower(?)", likePrefix(*filter.ServiceNamePrefix))
+	}
+	if filter.MinPrice != nil {
+		qb = qb.Where("svc.price >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		qb = qb.Where("svc.price <= ?", *filter.MaxPrice)
+	}
+	if filter.ActiveOn != nil {
+		qb = qb.Where(
+			"date_trunc('month', s.start_date) <= date_trunc('month', ?::date) AND (s.end_date IS NULL OR s.end_date >= date_trunc('month', ?::date))",
+			*filter.ActiveOn, *filter.ActiveOn,
+		)
+	}
+	if filter.StartedFrom != nil {
+		qb = qb.Where("s.start_date >= date_trunc('month', ?::date)", *filter.StartedFrom)
+	}
+	if filter.StartedTo != nil {
+		qb = qb.Where("s.start_date < date_trunc('month', ?::date) + interval '1 month'", *filter.StartedTo)
+	}
+	if filter.EndedFrom != nil {
+		qb = qb.Where("s.end_date >= date_trunc('month', ?::date)", *filter.EndedFrom)
+	}
+	if filter.EndedTo != nil {
+		qb = qb.Where("s.end_date < date_trunc('month', ?::date) + interval '1 month'", *filter.EndedTo)
+	}
+	if filter.CreatedFrom != nil {
+		qb = qb.Where("s.created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		qb = qb.Where("s.created_at < ?", filter.CreatedTo.AddDate(0, 0, 1))
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		qb = qb.Where(squirrel.Eq{"s.status": statuses})
+	}
+	if filter.Category != nil {
+		qb = qb.Where("svc.category = ?", *filter.Category)
+	}
+	for _, m := range filter.Metadata {
+		if m.Value == nil {
+			// ?? is the jsonb ? operator escaped from placeholders.
+			qb = qb.Where("s.metadata ?? ?", m.Key)
+			continue
+		}
+		qb = qb.Where("s.metadata @> jsonb_build_object(?::text, ?::text)", m.Key, *m.Value)
+	}
+	return qb
+}
+
+// countSubscriptions counts subscriptions matching filter of userID, or of all
+// users when it is nil.
+func (r *SubscriptionRepo) countSubscriptions(ctx context.Context, filter entity.SubscriptionFilter, userID *uuid.UUID) (int, error) {
+	qb := r.psql.
+		Select("COUNT(*)").
+		From("subscriptions s").
+		Join("services svc ON s.service_id = svc.id")
+	if userID != nil {
+		qb = qb.Where("s.user_id = ?", *userID)
+	}
+	sql, args, err := filterSubscriptions(qb, filter).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("sql build: %v", err)
+	}
+
+	var total int
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("query exec: %v", err)
+	}
+	return total, nil
+}
+
+// ListSubscriptions lists subscriptions of filter.UserID. With withTotal the
+// number of all matching subscriptions is returned as well, otherwise the
+// total is 0.
+func (r *SubscriptionRepo) ListSubscriptions(
+	ctx context.Context,
+	filter entity.SubscriptionFilter,
+	sort entity.SubscriptionSort,
+	offset int,
+	limit int,
+	withTotal bool,
+) ([]entity.Subscription, int, error) {
+	subscriptions, total, err := r.listSubscriptions(ctx, filter, &filter.UserID, sort, offset, limit, withTotal)
+	if err != nil {
+		return nil, 0, fmt.Errorf("SubscriptionRepo.ListSubscriptions - %v", err)
+	}
+	return subscriptions, total, nil
+}
+
+// ListAllSubscriptions is ListSubscriptions over all users. filter.UserID is
+// ignored.
+func (r *SubscriptionRepo) ListAllSubscriptions(
+	ctx context.Context,
+	filter entity.SubscriptionFilter,
+	sort entity.SubscriptionSort,
+	offset int,
+	limit int,
+	withTotal bool,
+) ([]entity.Subscription, int, error) {
+	subscriptions, total, err := r.listSubscriptions(ctx, filter, nil, sort, offset, limit, withTotal)
+	if err != nil {
+		return nil, 0, fmt.Errorf("SubscriptionRepo.ListAllSubscriptions - %v", err)
+	}
+	return subscriptions, total, nil
+}
+
+// listSubscriptions lists subscriptions matching filter of userID, or of all
+// users when it is nil. The total is taken by a window function in the same
+// statement, so it always agrees with the page. Only a page past the end,
+// which has no rows to carry it, needs a separate count.
+func (r *SubscriptionRepo) listSubscriptions(
+	ctx context.Context,
+	filter entity.SubscriptionFilter,
+	userID *uuid.UUID,
+	sort entity.SubscriptionSort,
+	offset int,
+	limit int,
+	withTotal bool,
+) ([]entity.Subscription, int, error) {
+	qb := r.psql.
+		Select(subscriptionColumns...).
+		From("subscriptions s").
+		Join("services svc ON s.service_id = svc.id")
+	if withTotal {
+		qb = qb.Column("COUNT(*) OVER ()")
+	}
+	if userID != nil {
+		qb = qb.Where("s.user_id = ?", *userID)
+	}
+	sql, args, err := filterSubscriptions(qb, filter).
+		OrderBy(orderSubscriptions(sort)...).
+		Offset(uint64(offset)).
+		Limit(uint64(limit)).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("SubscriptionRepo.UpdateSubscription - sql build: %v", err)
+		return nil, 0, fmt.Errorf("sql build: %v", err)
 	}
 
-	result, err := r.pool.Exec(ctx, sql, args...)
+	rows, err := r.pool.Query(ctx, sql, args...)
 	if err != nil {
-		return fmt.Errorf("SubscriptionRepo.UpdateSubscription - query exec: %v", err)
+		return nil, 0, fmt.Errorf("query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var (
+		subscriptions []entity.Subscription
+		total         int
+	)
+	for rows.Next() {
+		var extra []any
+		if withTotal {
+			extra = append(extra, &total)
+		}
+		sub, err := scanSubscription(rows, extra...)
+		if err != nil {
+			return nil, 0, fmt.Errorf("row scan: %v", err)
+		}
+		subscriptions = append(subscriptions, sub)
 	}
 
-	if result.RowsAffected() == 0 {
-		return repoerrs.ErrNotFound
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rows error: %v", err)
 	}
 
-	return nil
+	if withTotal && len(subscriptions) == 0 && offset > 0 {
+		total, err = r.countSubscriptions(ctx, filter, userID)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return subscriptions, total, nil
 }
 
-func (r *SubscriptionRepo) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
-	sql, args, err := r.psql.
-		Delete("subscriptions").
-		Where("id = ?", id).
+// ListSubscriptionsByCursor returns up to limit subscriptions after the
+// cursor, or before it when cursor.Backward is set, newest first. A nil
+// cursor starts at the newest subscription.
+func (r *SubscriptionRepo) ListSubscriptionsByCursor(
+	ctx context.Context,
+	filter entity.SubscriptionFilter,
+	cursor *entity.SubscriptionCursor,
+	limit int,
+) ([]entity.Subscription, error) {
+	qb := filterSubscriptions(r.psql.
+		Select(subscriptionColumns...).
+		From("subscriptions s").
+		Join("services svc ON s.service_id = svc.id").
+		Where("s.user_id = ?", filter.UserID), filter).
+		Limit(uint64(limit))
+
+	backward := cursor != nil && cursor.Backward
+	switch {
+	case backward:
+		qb = qb.Where("(s.start_date, s.id) > (?::date, ?::uuid)", cursor.StartDate, cursor.ID).
+			OrderBy("s.start_date", "s.id")
+	case cursor != nil:
+		qb = qb.Where("(s.start_date, s.id) < (?::date, ?::uuid)", cursor.StartDate, cursor.ID).
+			OrderBy("s.start_date DESC", "s.id DESC")
+	default:
+		qb = qb.OrderBy("s.start_date DESC", "s.id DESC")
+	}
+
+	sql, args, err := qb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptionsByCursor - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptionsByCursor - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []entity.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptionsByCursor - row scan: %v", err)
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptionsByCursor - rows error: %v", err)
+	}
+
+	if backward {
+		slices.Reverse(subscriptions)
+	}
+	return subscriptions, nil
+}
+
+// Documents of full-text search. They must match the expression indexes
+// of migration 000016 to be served by them.
+const (
+	searchNameVector  = "to_tsvector('simple', svc.name)"
+	searchNotesVector = "to_tsvector('simple', COALESCE(s.notes, ''))"
+)
+
+// SearchSubscriptions returns subscriptions whose service name resembles
+// search.Query or whose service name or notes contain its words, closest
+// matches first.
+func (r *SubscriptionRepo) SearchSubscriptions(
+	ctx context.Context,
+	search entity.SubscriptionSearch,
+	offset int,
+	limit int,
+) ([]entity.SubscriptionMatch, error) {
+	qb := r.psql.
+		Select(subscriptionColumns...).
+		Column(
+			"GREATEST(word_similarity(?, svc.name), ts_rank("+searchNameVector+" || "+searchNotesVector+", plainto_tsquery('simple', ?)))::float8 AS score",
+			search.Query, search.Query,
+		).
+		From("subscriptions s").
+		Join("services svc ON s.service_id = svc.id").
+		Where(squirrel.Or{
+			squirrel.Expr("? <% svc.name", search.Query),
+			squirrel.Expr(searchNameVector+" @@ plainto_tsquery('simple', ?)", search.Query),
+			squirrel.Expr(searchNotesVector+" @@ plainto_tsquery('simple', ?)", search.Query),
+		})
+	if search.UserID != nil {
+		qb = qb.Where("s.user_id = ?", *search.UserID)
+	}
+	sql, args, err := qb.
+		OrderBy("score DESC", "s.id").
+		Offset(uint64(offset)).
+		Limit(uint64(limit)).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("SubscriptionRepo.DeleteSubscription - sql build: %v", err)
+		return nil, fmt.Errorf("SubscriptionRepo.SearchSubscriptions - sql build: %v", err)
 	}
 
-	result, err := r.pool.Exec(ctx, sql, args...)
+	rows, err := r.pool.Query(ctx, sql, args...)
 	if err != nil {
-		return fmt.Errorf("SubscriptionRepo.DeleteSubscription - query exec: %v", err)
+		return nil, fmt.Errorf("SubscriptionRepo.SearchSubscriptions - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var matches []entity.SubscriptionMatch
+	for rows.Next() {
+		var match entity.SubscriptionMatch
+		match.Subscription, err = scanSubscription(rows, &match.Score)
+		if err != nil {
+			return nil, fmt.Errorf("SubscriptionRepo.SearchSubscriptions - row scan: %v", err)
+		}
+		matches = append(matches, match)
 	}
 
-	if result.RowsAffected() == 0 {
-		return repoerrs.ErrNotFound
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SubscriptionRepo.SearchSubscriptions - rows error: %v", err)
 	}
 
-	return nil
+	return matches, nil
 }
 
-func (r *SubscriptionRepo) GetTotalByUser(ctx context.Context, userID uuid.UUID) (int, error) {
-	var total int
-	err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM subscriptions WHERE user_id = $1", userID).Scan(&total)
+// StreamSubscriptions calls fn for every subscription of the user, or of all
+// users when userID is nil, reading rows one by one instead of into a slice.
+func (r *SubscriptionRepo) StreamSubscriptions(ctx context.Context, userID *uuid.UUID, fn func(entity.Subscription) error) error {
+	qb := r.psql.
+		Select(subscriptionColumns...).
+		From("subscriptions s").
+		Join("services svc ON s.service_id = svc.id").
+		OrderBy("s.created_at", "s.id")
+
+	if userID != nil {
+		qb = qb.Where("s.user_id = ?", *userID)
+	}
+
+	sql, args, err := qb.ToSql()
 	if err != nil {
-		return 0, fmt.Errorf("SubscriptionRepo.GetTotalByUser - query exec: %v", err)
+		return fmt.Errorf("SubscriptionRepo.StreamSubscriptions - sql build: %v", err)
 	}
-	return total, nil
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("SubscriptionRepo.StreamSubscriptions - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return fmt.Errorf("SubscriptionRepo.StreamSubscriptions - row scan: %v", err)
+		}
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("SubscriptionRepo.StreamSubscriptions - rows error: %v", err)
+	}
+
+	return nil
 }
 
-func (r *SubscriptionRepo) ListSubscriptions(ctx context.Context, userID uuid.UUID, offset int, limit int) ([]entity.Subscription, error) {
+// ListActiveSubscriptions returns subscriptions of the user that have not
+// ended before the month of since. Paused and expired subscriptions are not
+// charged and are left out.
+func (r *SubscriptionRepo) ListActiveSubscriptions(ctx context.Context, userID uuid.UUID, since time.Time) ([]entity.Subscription, error) {
 	sql, args, err := r.psql.
-		Select("s.id", "s.user_id", "s.start_date", "s.end_date", "s.created_at", "svc.id", "svc.name", "svc.price").
+		Select(subscriptionColumns...).
 		From("subscriptions s").
 		Join("services svc ON s.service_id = svc.id").
 		Where("s.user_id = ?", userID).
-		OrderBy("s.start_date DESC").
-		Offset(uint64(offset)).
-		Limit(uint64(limit)).
+		Where(squirrel.NotEq{"s.status": []string{string(entity.StatusPaused), string(entity.StatusExpired)}}).
+		Where("(s.end_date IS NULL OR s.end_date >= date_trunc('month', ?::date))", since).
+		OrderBy("s.start_date", "s.id").
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptions - sql build: %v", err)
+		return nil, fmt.Errorf("SubscriptionRepo.ListActiveSubscriptions - sql build: %v", err)
 	}
 
 	rows, err := r.pool.Query(ctx, sql, args...)
 	if err != nil {
-		return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptions - query exec: %v", err)
+		return nil, fmt.Errorf("SubscriptionRepo.ListActiveSubscriptions - query exec: %v", err)
 	}
 	defer rows.Close()
 
 	var subscriptions []entity.Subscription
 	for rows.Next() {
-		var sub entity.Subscription
-		if err := rows.Scan(
-			&sub.ID,
-			&sub.UserID,
-			&sub.StartDate,
-			&sub.EndDate,
-			&sub.CreatedAt,
-			&sub.Service.ID,
-			&sub.Service.Name,
-			&sub.Service.Price,
-		); err != nil {
-			return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptions - row scan: %v", err)
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("SubscriptionRepo.ListActiveSubscriptions - row scan: %v", err)
 		}
 		subscriptions = append(subscriptions, sub)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("SubscriptionRepo.ListSubscriptions - rows error: %v", err)
+		return nil, fmt.Errorf("SubscriptionRepo.ListActiveSubscriptions - rows error: %v", err)
 	}
 
 	return subscriptions, nil
 }
+
+// ChangeStatus applies a lifecycle transition if the subscription is still in
+// change.From, returning repoerrs.ErrConflict when it was changed meanwhile.
+func (r *SubscriptionRepo) ChangeStatus(ctx context.Context, id uuid.UUID, change entity.StatusChange) error {
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var (
+			status    entity.SubscriptionStatus
+			startDate time.Time
+			endDate   *time.Time
+		)
+		err := tx.QueryRow(ctx, "SELECT status, start_date, end_date FROM subscriptions WHERE id = $1 FOR UPDATE", id).
+			Scan(&status, &startDate, &endDate)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repoerrs.ErrNotFound
+			}
+			return fmt.Errorf("lock subscription: %v", err)
+		}
+		if status != change.From {
+			return repoerrs.ErrConflict
+		}
+
+		qb := r.psql.
+			Update("subscriptions").
+			Set("status", change.To).
+			Where("id = ?", id)
+		if change.EndDate != nil {
+			qb = qb.Set("end_date", squirrel.Expr("LEAST(COALESCE(end_date, ?::date), ?::date)", *change.EndDate, *change.EndDate))
+		}
+		sql, args, err := qb.ToSql()
+		if err != nil {
+			return fmt.Errorf("sql build: %v", err)
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return fmt.Errorf("update status: %v", err)
+		}
+
+		if change.PausedFrom != nil {
+			if err := openPause(ctx, tx, id, *change.PausedFrom); err != nil {
+				return err
+			}
+		}
+		if change.ResumedFrom != nil {
+			if err := closePause(ctx, tx, id, *change.ResumedFrom); err != nil {
+				return err
+			}
+		}
+
+		if err := invalidateMonthlyCosts(ctx, tx, startDate, endDate); err != nil {
+			return err
+		}
+		return writeChangedEvent(ctx, tx, entity.EventSubscriptionUpdated, id)
+	})
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) || errors.Is(err, repoerrs.ErrConflict) {
+			return err
+		}
+		return fmt.Errorf("SubscriptionRepo.ChangeStatus - %v", err)
+	}
+
+	return nil
+}
+
+// ActivateEndedTrials moves up to limit trial subscriptions whose trial_end is
+// not after today to active. Their net price already follows trial_end, so
+// no cost snapshot changes. Rows locked by another instance are skipped.
+func (r *SubscriptionRepo) ActivateEndedTrials(ctx context.Context, today time.Time, limit int) (int, error) {
+	activated := 0
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id FROM subscriptions
+			WHERE status = $1 AND trial_end IS NOT NULL AND trial_end <= $2::date
+			ORDER BY trial_end, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED`,
+			entity.StatusTrial, today, limit)
+		if err != nil {
+			return fmt.Errorf("select ended trials: %v", err)
+		}
+		var ids []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("row scan: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("rows error: %v", err)
+		}
+
+		for _, id := range ids {
+			if _, err := tx.Exec(ctx, "UPDATE subscriptions SET status = $2 WHERE id = $1", id, entity.StatusActive); err != nil {
+				return fmt.Errorf("activate subscription: %v", err)
+			}
+			if err := writeChangedEvent(ctx, tx, entity.EventSubscriptionUpdated, id); err != nil {
+				return err
+			}
+			activated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("SubscriptionRepo.ActivateEndedTrials - %v", err)
+	}
+
+	return activated, nil
+}
+
+// ExpireEnded handles up to limit trial, active and paused subscriptions whose
+// last month is before month. Subscriptions with auto_renew that are not
+// paused are extended month by month until they cover month, the others
+// expire, as do those whose extension would overlap another subscription of
+// the user to the service. Rows locked by another instance are skipped.
+func (r *SubscriptionRepo) ExpireEnded(ctx context.Context, month time.Time, limit int) (expired, renewed int, err error) {
+	err = r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id, status, end_date, auto_renew
+			FROM subscriptions
+			WHERE status IN ($1, $2, $3) AND end_date IS NOT NULL AND end_date < $4::date
+			ORDER BY end_date, id
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED`,
+			entity.StatusTrial, entity.StatusActive, entity.StatusPaused, month, limit)
+		if err != nil {
+			return fmt.Errorf("select ended: %v", err)
+		}
+
+		type ended struct {
+			id        uuid.UUID
+			status    entity.SubscriptionStatus
+			endDate   time.Time
+			autoRenew bool
+		}
+		var subs []ended
+		for rows.Next() {
+			var e ended
+			if err := rows.Scan(&e.id, &e.status, &e.endDate, &e.autoRenew); err != nil {
+				rows.Close()
+				return fmt.Errorf("row scan: %v", err)
+			}
+			subs = append(subs, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("rows error: %v", err)
+		}
+
+		for _, e := range subs {
+			if e.autoRenew && e.status != entity.StatusPaused {
+				newEnd := e.endDate
+				for newEnd.Before(month) {
+					newEnd = newEnd.AddDate(0, 1, 0)
+				}
+				renew, err := renewalFree(ctx, tx, e.id, newEnd)
+				if err != nil {
+					return err
+				}
+				if renew {
+					if _, err := tx.Exec(ctx, "UPDATE subscriptions SET end_date = $2 WHERE id = $1", e.id, newEnd); err != nil {
+						return fmt.Errorf("renew subscription: %v", err)
+					}
+					// Closed months between the old and the new end become charged.
+					if err := invalidateMonthlyCosts(ctx, tx, e.endDate, &newEnd); err != nil {
+						return err
+					}
+					if err := writeChangedEvent(ctx, tx, entity.EventSubscriptionRenewed, e.id); err != nil {
+						return err
+					}
+					renewed++
+					continue
+				}
+			}
+
+			if _, err := tx.Exec(ctx, "UPDATE subscriptions SET status = $2 WHERE id = $1", e.id, entity.StatusExpired); err != nil {
+				return fmt.Errorf("expire subscription: %v", err)
+			}
+			if err := writeChangedEvent(ctx, tx, entity.EventSubscriptionExpired, e.id); err != nil {
+				return err
+			}
+			expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("SubscriptionRepo.ExpireEnded - %v", err)
+	}
+
+	return expired, renewed, nil
+}
@@ -0,0 +1,56 @@
+package pgdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/google/uuid"
+)
+
+// TestActivateEndedTrials runs against PostgreSQL: a trial becomes active on
+// its trial_end with an update event, a running trial stays.
+func TestActivateEndedTrials(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepo(pool)
+
+	userID := uuid.New()
+	ended, running := day(2025, 3, 1), day(2025, 3, 2)
+	var ids []uuid.UUID
+	for _, sub := range []entity.Subscription{
+		{Service: entity.Service{Name: "Netflix", Price: 599}, UserID: userID, Status: entity.StatusTrial, StartDate: day(2025, 2, 1), TrialEnd: &ended},
+		{Service: entity.Service{Name: "Spotify", Price: 299}, UserID: userID, Status: entity.StatusTrial, StartDate: day(2025, 2, 1), TrialEnd: &running},
+	} {
+		created, err := r.CreateSubscription(ctx, sub)
+		if err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	n, err := r.ActivateEndedTrials(ctx, day(2025, 3, 1), 10)
+	if err != nil || n != 1 {
+		t.Fatalf("ActivateEndedTrials = %d, %v; want 1, nil", n, err)
+	}
+
+	for i, want := range []entity.SubscriptionStatus{entity.StatusActive, entity.StatusTrial} {
+		got, err := r.GetSubscriptionByID(ctx, ids[i])
+		if err != nil {
+			t.Fatalf("GetSubscriptionByID: %v", err)
+		}
+		if got.Status != want {
+			t.Errorf("subscription %d is %s, want %s", i, got.Status, want)
+		}
+	}
+
+	var events int
+	if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM outbox_events WHERE event_type = $1 AND aggregate_id = $2",
+		string(entity.EventSubscriptionUpdated), ids[0]).Scan(&events); err != nil {
+		t.Fatalf("count events: %v", err)
+	}
+	if events != 1 {
+		t.Errorf("%d update events for the activated trial, want 1", events)
+	}
+}
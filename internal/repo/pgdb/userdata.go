@@ -0,0 +1,253 @@
+package pgdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// UserDataRepo reads and erases everything stored about a user across the
+// tables of the other repositories.
+type UserDataRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewUserDataRepo(pg *pgxpool.Pool) *UserDataRepo {
+	return &UserDataRepo{pool: pg}
+}
+
+// queryList runs the query and reads every row with scan.
+func queryList[T any](ctx context.Context, q querier, scan func(pgx.Row) (T, error), sql string, args ...any) ([]T, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func scanPause(row pgx.Row) (entity.SubscriptionPause, error) {
+	var p entity.SubscriptionPause
+	err := row.Scan(&p.SubscriptionID, &p.PausedFrom, &p.ResumedFrom, &p.CreatedAt)
+	return p, err
+}
+
+func scanMonthlyCost(row pgx.Row) (entity.CostBreakdownItem, error) {
+	var c entity.CostBreakdownItem
+	err := row.Scan(&c.Month, &c.UserID, &c.ServiceName, &c.Cost, &c.NetCost)
+	return c, err
+}
+
+func scanSentReminder(row pgx.Row) (entity.SentReminder, error) {
+	var r entity.SentReminder
+	err := row.Scan(&r.SubscriptionID, &r.UserID, &r.Kind, &r.ChargeDate, &r.Email, &r.SentAt)
+	return r, err
+}
+
+func scanWebhookDelivery(row pgx.Row) (entity.WebhookDelivery, error) {
+	var d entity.WebhookDelivery
+	err := row.Scan(webhookDeliveryDest(&d)...)
+	return d, err
+}
+
+func scanUserErasure(row pgx.Row) (entity.UserErasure, error) {
+	var (
+		e       entity.UserErasure
+		deleted []byte
+	)
+	if err := row.Scan(&e.ID, &e.UserIDHash, &e.Reference, &deleted, &e.ErasedAt); err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(deleted, &e.Deleted); err != nil {
+		return e, fmt.Errorf("decode deleted: %v", err)
+	}
+	return e, nil
+}
+
+// ExportUserData reads the data of the user. All sections are read from one
+// snapshot, so they agree with each other.
+func (r *UserDataRepo) ExportUserData(ctx context.Context, userID uuid.UUID) (entity.UserData, error) {
+	data := entity.UserData{UserID: userID}
+	opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	err := r.pool.BeginTxFunc(ctx, opts, func(tx pgx.Tx) error {
+		sections := []struct {
+			name string
+			read func() error
+		}{
+			{"subscriptions", func() (err error) {
+				data.Subscriptions, err = queryList(ctx, tx, func(row pgx.Row) (entity.Subscription, error) {
+					return scanSubscription(row)
+				}, "SELECT "+strings.Join(subscriptionColumns, ", ")+`
+					FROM subscriptions s
+					JOIN services svc ON s.service_id = svc.id
+					WHERE s.user_id = $1
+					ORDER BY s.created_at, s.id`, userID)
+				return err
+			}},
+			{"subscription_pauses", func() (err error) {
+				data.Pauses, err = queryList(ctx, tx, scanPause, `
+					SELECT p.subscription_id, p.paused_from, p.resumed_from, p.created_at
+					FROM subscription_pauses p
+					JOIN subscriptions s ON p.subscription_id = s.id
+					WHERE s.user_id = $1
+					ORDER BY p.created_at, p.id`, userID)
+				return err
+			}},
+			{"outbox_events", func() (err error) {
+				data.Events, err = queryList(ctx, tx, scanOutboxEvent,
+					"SELECT "+outboxEventColumns+" FROM outbox_events WHERE user_id = $1 ORDER BY created_at, id", userID)
+				return err
+			}},
+			{"monthly_costs", func() (err error) {
+				data.MonthlyCosts, err = queryList(ctx, tx, scanMonthlyCost, `
+					SELECT month, user_id, service_name, cost, net_cost
+					FROM monthly_costs
+					WHERE user_id = $1
+					ORDER BY month, service_name`, userID)
+				return err
+			}},
+			{"budgets", func() (err error) {
+				data.Budgets, err = queryList(ctx, tx, scanBudget,
+					"SELECT "+strings.Join(budgetColumns, ", ")+" FROM budgets WHERE user_id = $1 ORDER BY created_at, id", userID)
+				return err
+			}},
+			{"budget_alerts", func() (err error) {
+				data.BudgetAlerts, err = queryList(ctx, tx, scanBudgetAlert,
+					"SELECT "+strings.Join(budgetAlertColumns, ", ")+" FROM budget_alerts WHERE user_id = $1 ORDER BY created_at, id", userID)
+				return err
+			}},
+			{"notification_preferences", func() error {
+				prefs, err := queryList(ctx, tx, scanNotificationPreferences,
+					"SELECT "+strings.Join(notificationPreferencesColumns, ", ")+" FROM notification_preferences WHERE user_id = $1", userID)
+				if len(prefs) > 0 {
+					data.NotificationPreferences = &prefs[0]
+				}
+				return err
+			}},
+			{"email_reminders", func() (err error) {
+				data.Reminders, err = queryList(ctx, tx, scanSentReminder, `
+					SELECT subscription_id, user_id, kind, charge_date, email, sent_at
+					FROM email_reminders
+					WHERE user_id = $1
+					ORDER BY sent_at, id`, userID)
+				return err
+			}},
+			{"webhook_endpoints", func() (err error) {
+				data.Webhooks, err = queryList(ctx, tx, scanWebhookEndpoint,
+					"SELECT "+strings.Join(webhookEndpointColumns, ", ")+" FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at, id", userID)
+				for i := range data.Webhooks {
+					data.Webhooks[i].Secret = ""
+				}
+				return err
+			}},
+			{"webhook_deliveries", func() (err error) {
+				data.WebhookDeliveries, err = queryList(ctx, tx, scanWebhookDelivery, "SELECT "+strings.Join(webhookDeliveryColumns, ", ")+`
+					FROM webhook_deliveries d
+					JOIN webhook_endpoints e ON d.endpoint_id = e.id
+					WHERE e.user_id = $1
+					ORDER BY d.created_at, d.id`, userID)
+				return err
+			}},
+			{"calendar_feeds", func() error {
+				err := tx.QueryRow(ctx, "SELECT created_at FROM calendar_feeds WHERE user_id = $1", userID).
+					Scan(&data.CalendarFeedCreatedAt)
+				if errors.Is(err, pgx.ErrNoRows) {
+					return nil
+				}
+				return err
+			}},
+			{"user_erasures", func() (err error) {
+				data.Erasures, err = queryList(ctx, tx, scanUserErasure, `
+					SELECT id, user_id_hash, COALESCE(reference, ''), deleted, erased_at
+					FROM user_erasures
+					WHERE user_id_hash = $1
+					ORDER BY erased_at`, entity.UserIDHash(userID))
+				return err
+			}},
+		}
+		for _, section := range sections {
+			if err := section.read(); err != nil {
+				return fmt.Errorf("read %s: %v", section.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.UserData{}, fmt.Errorf("UserDataRepo.ExportUserData - %v", err)
+	}
+	return data, nil
+}
+
+// userDataDeletes remove the rows of the user bound to $1 from every table
+// that holds them. Children go before their parents, so rows removed by
+// cascades are counted too.
+var userDataDeletes = []struct {
+	table string
+	sql   string
+}{
+	{"webhook_deliveries", "DELETE FROM webhook_deliveries d USING webhook_endpoints e WHERE d.endpoint_id = e.id AND e.user_id = $1"},
+	{"webhook_endpoints", "DELETE FROM webhook_endpoints WHERE user_id = $1"},
+	{"email_reminders", "DELETE FROM email_reminders WHERE user_id = $1"},
+	{"subscription_pauses", "DELETE FROM subscription_pauses p USING subscriptions s WHERE p.subscription_id = s.id AND s.user_id = $1"},
+	{"subscriptions", "DELETE FROM subscriptions WHERE user_id = $1"},
+	{"outbox_events", "DELETE FROM outbox_events WHERE user_id = $1"},
+	{"monthly_costs", "DELETE FROM monthly_costs WHERE user_id = $1"},
+	{"budget_alerts", "DELETE FROM budget_alerts WHERE user_id = $1"},
+	{"budgets", "DELETE FROM budgets WHERE user_id = $1"},
+	{"notification_preferences", "DELETE FROM notification_preferences WHERE user_id = $1"},
+	{"calendar_feeds", "DELETE FROM calendar_feeds WHERE user_id = $1"},
+}
+
+// EraseUserData deletes the data of the user and records the erasure in one
+// transaction, filling in the ID, deleted counts and time of erasure.
+// Removing the user's snapshot rows along with the subscriptions keeps closed
+// months consistent without invalidating them. Unlike single deletes, no
+// events are written: they would carry the erased data.
+func (r *UserDataRepo) EraseUserData(ctx context.Context, userID uuid.UUID, erasure *entity.UserErasure) error {
+	err := r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		deleted := make(map[string]int, len(userDataDeletes))
+		for _, del := range userDataDeletes {
+			tag, err := tx.Exec(ctx, del.sql, userID)
+			if err != nil {
+				return fmt.Errorf("delete %s: %v", del.table, err)
+			}
+			deleted[del.table] = int(tag.RowsAffected())
+		}
+
+		counts, err := json.Marshal(deleted)
+		if err != nil {
+			return fmt.Errorf("encode deleted: %v", err)
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO user_erasures (user_id_hash, reference, deleted)
+			VALUES ($1, $2, $3::jsonb)
+			RETURNING id, erased_at`,
+			erasure.UserIDHash, nullString(erasure.Reference), string(counts),
+		).Scan(&erasure.ID, &erasure.ErasedAt)
+		if err != nil {
+			return fmt.Errorf("insert tombstone: %v", err)
+		}
+		erasure.Deleted = deleted
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("UserDataRepo.EraseUserData - %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type WebhookRepo struct {
+	pool *pgxpool.Pool
+	psql squirrel.StatementBuilderType
+}
+
+func NewWebhookRepo(pg *pgxpool.Pool) *WebhookRepo {
+	return &WebhookRepo{
+		pool: pg,
+		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+var webhookEndpointColumns = []string{"id", "user_id", "url", "secret", "event_types", "created_at"}
+
+func scanWebhookEndpoint(row pgx.Row) (entity.WebhookEndpoint, error) {
+	var (
+		e          entity.WebhookEndpoint
+		eventTypes []string
+	)
+	if err := row.Scan(&e.ID, &e.UserID, &e.URL, &e.Secret, &eventTypes, &e.CreatedAt); err != nil {
+		return e, err
+	}
+	e.EventTypes = make([]entity.EventType, len(eventTypes))
+	for i, t := range eventTypes {
+		e.EventTypes[i] = entity.EventType(t)
+	}
+	return e, nil
+}
+
+var webhookDeliveryColumns = []string{
+	"d.id", "d.endpoint_id", "d.event_id", "d.event_type", "d.payload", "d.status", "d.attempts",
+	"d.next_attempt_at", "d.last_attempt_at", "d.last_status_code", "d.last_error", "d.created_at", "d.delivered_at",
+}
+
+func webhookDeliveryDest(d *entity.WebhookDelivery) []any {
+	return []any{
+		&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt,
+	}
+}
+
+// acceptsEvent matches endpoints subscribed to the event type bound to the placeholder.
+const acceptsEvent = "(cardinality(event_types) = 0 OR ? = ANY(event_types))"
+
+func (r *WebhookRepo) CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (*entity.WebhookEndpoint, error) {
+	eventTypes := make([]string, len(endpoint.EventTypes))
+	for i, t := range endpoint.EventTypes {
+		eventTypes[i] = string(t)
+	}
+
+	sql, args, err := r.psql.
+		Insert("webhook_endpoints").
+		Columns("id", "user_id", "url", "secret", "event_types").
+		Values(uuid.New(), endpoint.UserID, endpoint.URL, endpoint.Secret, eventTypes).
+		Suffix("RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("WebhookRepo.CreateEndpoint - sql build: %v", err)
+	}
+
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&endpoint.ID, &endpoint.CreatedAt); err != nil {
+		return nil, fmt.Errorf("WebhookRepo.CreateEndpoint - query exec: %v", err)
+	}
+	return &endpoint, nil
+}
+
+func (r *WebhookRepo) GetEndpoint(ctx context.Context, id uuid.UUID) (entity.WebhookEndpoint, error) {
+	sql, args, err := r.psql.
+		Select(webhookEndpointColumns...).
+		From("webhook_endpoints").
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return entity.WebhookEndpoint{}, fmt.Errorf("WebhookRepo.GetEndpoint - sql build: %v", err)
+	}
+
+	endpoint, err := scanWebhookEndpoint(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.WebhookEndpoint{}, repoerrs.ErrNotFound
+		}
+		return entity.WebhookEndpoint{}, fmt.Errorf("WebhookRepo.GetEndpoint - query exec: %v", err)
+	}
+	return endpoint, nil
+}
+
+func (r *WebhookRepo) ListEndpoints(ctx context.Context, userID uuid.UUID) ([]entity.WebhookEndpoint, error) {
+	sql, args, err := r.psql.
+		Select(webhookEndpointColumns...).
+		From("webhook_endpoints").
+		Where("user_id = ?", userID).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ListEndpoints - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ListEndpoints - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var endpoints []entity.WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("WebhookRepo.ListEndpoints - row scan: %v", err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ListEndpoints - rows error: %v", err)
+	}
+
+	return endpoints, nil
+}
+
+func (r *WebhookRepo) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, "DELETE FROM webhook_endpoints WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("WebhookRepo.DeleteEndpoint - query exec: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return repoerrs.ErrNotFound
+	}
+	return nil
+}
+
+// ListUserIDsForEvent returns users with at least one endpoint subscribed to eventType.
+func (r *WebhookRepo) ListUserIDsForEvent(ctx context.Context, eventType entity.EventType) ([]uuid.UUID, error) {
+	sql, args, err := r.psql.
+		Select("DISTINCT user_id").
+		From("webhook_endpoints").
+		Where(acceptsEvent, string(eventType)).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ListUserIDsForEvent - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ListUserIDsForEvent - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("WebhookRepo.ListUserIDsForEvent - row scan: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ListUserIDsForEvent - rows error: %v", err)
+	}
+
+	return userIDs, nil
+}
+
+// EnqueueEvent queues a delivery of the event to every endpoint of the user
+// subscribed to its type. An event already queued for an endpoint is skipped,
+// so enqueueing is idempotent per event ID. It returns the number of new deliveries.
+func (r *WebhookRepo) EnqueueEvent(
+	ctx context.Context,
+	userID uuid.UUID,
+	eventType entity.EventType,
+	eventID uuid.UUID,
+	payload []byte,
+) (int, error) {
+	result, err := r.pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $4::jsonb
+		FROM webhook_endpoints
+		WHERE user_id = $1 AND (cardinality(event_types) = 0 OR $3 = ANY(event_types))
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING`,
+		userID, eventID, string(eventType), string(payload))
+	if err != nil {
+		return 0, fmt.Errorf("WebhookRepo.EnqueueEvent - query exec: %v", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// ClaimDueDeliveries picks up to limit pending deliveries that are due and
+// pushes their next attempt lease into the future, so other dispatchers skip
+// them and a delivery whose dispatcher dies is retried after the lease.
+func (r *WebhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entity.DeliveryTarget, error) {
+	rows, err := r.pool.Query(ctx, `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, webhook_endpoints e
+		WHERE d.id = due.id AND e.id = d.endpoint_id
+		RETURNING `+strings.Join(webhookDeliveryColumns, ", ")+`, e.url, e.secret`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ClaimDueDeliveries - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var targets []entity.DeliveryTarget
+	for rows.Next() {
+		var t entity.DeliveryTarget
+		if err := rows.Scan(append(webhookDeliveryDest(&t.Delivery), &t.URL, &t.Secret)...); err != nil {
+			return nil, fmt.Errorf("WebhookRepo.ClaimDueDeliveries - row scan: %v", err)
+		}
+		targets = append(targets, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("WebhookRepo.ClaimDueDeliveries - rows error: %v", err)
+	}
+
+	return targets, nil
+}
+
+// RecordAttempt stores the outcome of an attempt. A failed delivery without a
+// next attempt moves to the dead-letter state.
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, id uuid.UUID, result entity.DeliveryResult) error {
+	status := entity.DeliveryPending
+	switch {
+	case result.Delivered:
+		status = entity.DeliveryDelivered
+	case result.NextAttemptAt == nil:
+		status = entity.DeliveryDead
+	}
+
+	qb := r.psql.
+		Update("webhook_deliveries").
+		Set("status", status).
+		Set("attempts", squirrel.Expr("attempts + 1")).
+		Set("last_attempt_at", squirrel.Expr("NOW()")).
+		Set("last_status_code", result.StatusCode).
+		Set("last_error", result.Error).
+		Where("id = ?", id)
+	if result.Delivered {
+		qb = qb.Set("delivered_at", squirrel.Expr("NOW()"))
+	}
+	if result.NextAttemptAt != nil {
+		qb = qb.Set("next_attempt_at", *result.NextAttemptAt)
+	}
+
+	sql, args, err := qb.ToSql()
+	if err != nil {
+		return fmt.Errorf("WebhookRepo.RecordAttempt - sql build: %v", err)
+	}
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("WebhookRepo.RecordAttempt - query exec: %v", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the delivery log of an endpoint, newest first, and
+// the number of deliveries matching the filter.
+func (r *WebhookRepo) ListDeliveries(
+	ctx context.Context,
+	endpointID uuid.UUID,
+	status *entity.DeliveryStatus,
+	offset, limit int,
+) ([]entity.WebhookDelivery, int, error) {
+	qb := r.psql.
+		Select(append(webhookDeliveryColumns, "COUNT(*) OVER ()")...).
+		From("webhook_deliveries d").
+		Where("d.endpoint_id = ?", endpointID).
+		OrderBy("d.created_at DESC", "d.id").
+		Offset(uint64(offset)).
+		Limit(uint64(limit))
+	if status != nil {
+		qb = qb.Where("d.status = ?", *status)
+	}
+
+	sql, args, err := qb.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("WebhookRepo.ListDeliveries - sql build: %v", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("WebhookRepo.ListDeliveries - query exec: %v", err)
+	}
+	defer rows.Close()
+
+	var (
+		deliveries []entity.WebhookDelivery
+		total      int
+	)
+	for rows.Next() {
+		var d entity.WebhookDelivery
+		if err := rows.Scan(append(webhookDeliveryDest(&d), &total)...); err != nil {
+			return nil, 0, fmt.Errorf("WebhookRepo.ListDeliveries - row scan: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("WebhookRepo.ListDeliveries - rows error: %v", err)
+	}
+
+	return deliveries, total, nil
+}
+
+// RetryDelivery moves a dead delivery of the endpoint back to the queue with
+// a fresh attempt budget.
+func (r *WebhookRepo) RetryDelivery(ctx context.Context, endpointID, deliveryID uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND endpoint_id = $2 AND status = 'dead'`, deliveryID, endpointID)
+	if err != nil {
+		return fmt.Errorf("WebhookRepo.RetryDelivery - query exec: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return repoerrs.ErrNotFound
+	}
+	return nil
+}
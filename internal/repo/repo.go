@@ -14,28 +14,149 @@ import (
 type Subscription interface {
 	CreateSubscription(ctx context.Context, sub entity.Subscription) (*entity.Subscription, error)
 	GetSubscriptionByID(ctx context.Context, id uuid.UUID) (entity.Subscription, error)
-	UpdateSubscription(ctx context.Context, sub entity.Subscription) error
+	UpdateSubscription(ctx context.Context, sub *entity.Subscription) error
 	DeleteSubscription(ctx context.Context, id uuid.UUID) error
-	ListSubscriptions(ctx context.Context, userID uuid.UUID, offset int, limit int) ([]entity.Subscription, error)
-	GetTotalByUser(ctx context.Context, userID uuid.UUID) (int, error)
+	ListSubscriptions(ctx context.Context, filter entity.SubscriptionFilter, sort entity.SubscriptionSort, offset int, limit int, withTotal bool) ([]entity.Subscription, int, error)
+	ListAllSubscriptions(ctx context.Context, filter entity.SubscriptionFilter, sort entity.SubscriptionSort, offset int, limit int, withTotal bool) ([]entity.Subscription, int, error)
+	ListSubscriptionsByCursor(ctx context.Context, filter entity.SubscriptionFilter, cursor *entity.SubscriptionCursor, limit int) ([]entity.Subscription, error)
+	GetSubscriptionsByIDs(ctx context.Context, ids []uuid.UUID) ([]entity.Subscription, error)
+	CreateSubscriptions(ctx context.Context, subs []entity.Subscription, atomic bool) ([]entity.BatchItemResult, error)
+	UpdateSubscriptions(ctx context.Context, subs []entity.Subscription, atomic bool) ([]entity.BatchItemResult, error)
+	DeleteSubscriptions(ctx context.Context, ids []uuid.UUID, atomic bool) ([]entity.BatchItemResult, error)
+	SearchSubscriptions(ctx context.Context, search entity.SubscriptionSearch, offset int, limit int) ([]entity.SubscriptionMatch, error)
+	StreamSubscriptions(ctx context.Context, userID *uuid.UUID, fn func(entity.Subscription) error) error
+	ListActiveSubscriptions(ctx context.Context, userID uuid.UUID, since time.Time) ([]entity.Subscription, error)
+	ChangeStatus(ctx context.Context, id uuid.UUID, change entity.StatusChange) error
+	ActivateEndedTrials(ctx context.Context, today time.Time, limit int) (int, error)
+	ExpireEnded(ctx context.Context, month time.Time, limit int) (expired, renewed int, err error)
 }
 
 type Report interface {
-	GetTotalCost(ctx context.Context, userID *uuid.UUID, serviceName *string, startDate, endDate time.Time) ([]struct {
-		Price     int
-		StartDate time.Time
-		EndDate   *time.Time
-	}, error)
+	GetTotalCost(ctx context.Context, userID *uuid.UUID, serviceName *string, startDate, endDate time.Time) ([]entity.SubscriptionCost, error)
+	StreamCostBreakdown(ctx context.Context, userID *uuid.UUID, serviceName *string, startDate, endDate time.Time, fn func(entity.CostBreakdownItem) error) error
+}
+
+type Snapshot interface {
+	GetSnapshotCosts(ctx context.Context, userID *uuid.UUID, serviceName *string, startDate, endDate time.Time) ([]entity.MonthlyCost, error)
+	ListStaleMonths(ctx context.Context, until time.Time, limit int) ([]time.Time, error)
+	RefreshMonth(ctx context.Context, month time.Time) error
+	GetMonthVersions(ctx context.Context, startDate, endDate time.Time) (map[time.Time]int64, error)
+}
+
+type Analytics interface {
+	GetMonthlyMRR(ctx context.Context, startDate, endDate time.Time) ([]entity.MonthlyMRR, error)
+	GetRetentionCohorts(ctx context.Context, serviceName *string, startDate, endDate time.Time) ([]entity.RetentionCohort, error)
+	GetTopServices(ctx context.Context, orderBy entity.ServiceRankingMetric, startDate, endDate time.Time, offset, limit int) ([]entity.ServiceRanking, int, error)
+	GetTopUsers(ctx context.Context, startDate, endDate time.Time, offset, limit int) ([]entity.UserSpend, int, error)
+}
+
+type PromoCode interface {
+	CreatePromoCode(ctx context.Context, promo entity.PromoCode) (*entity.PromoCode, error)
+	GetPromoCode(ctx context.Context, code string) (entity.PromoCode, error)
+	ListPromoCodes(ctx context.Context) ([]entity.PromoCode, error)
+}
+
+type Budget interface {
+	CreateBudget(ctx context.Context, budget entity.Budget) (*entity.Budget, error)
+	GetBudget(ctx context.Context, id uuid.UUID) (entity.Budget, error)
+	ListBudgets(ctx context.Context, userID uuid.UUID) ([]entity.Budget, error)
+	UpdateBudget(ctx context.Context, id uuid.UUID, amount int) (*entity.Budget, error)
+	DeleteBudget(ctx context.Context, id uuid.UUID) error
+	ListBudgetUserIDs(ctx context.Context) ([]uuid.UUID, error)
+	SaveAlert(ctx context.Context, alert *entity.BudgetAlert) (bool, error)
+	ListAlerts(ctx context.Context, userID uuid.UUID, offset, limit int) ([]entity.BudgetAlert, error)
+}
+
+type Webhook interface {
+	CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (*entity.WebhookEndpoint, error)
+	GetEndpoint(ctx context.Context, id uuid.UUID) (entity.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, userID uuid.UUID) ([]entity.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	ListUserIDsForEvent(ctx context.Context, eventType entity.EventType) ([]uuid.UUID, error)
+	EnqueueEvent(ctx context.Context, userID uuid.UUID, eventType entity.EventType, eventID uuid.UUID, payload []byte) (int, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entity.DeliveryTarget, error)
+	RecordAttempt(ctx context.Context, id uuid.UUID, result entity.DeliveryResult) error
+	ListDeliveries(ctx context.Context, endpointID uuid.UUID, status *entity.DeliveryStatus, offset, limit int) ([]entity.WebhookDelivery, int, error)
+	RetryDelivery(ctx context.Context, endpointID, deliveryID uuid.UUID) error
+}
+
+type Outbox interface {
+	ClaimDueEvents(ctx context.Context, limit int, lease time.Duration) ([]entity.OutboxEvent, error)
+	MarkPublished(ctx context.Context, id uuid.UUID) error
+	RecordFailure(ctx context.Context, id uuid.UUID, publishErr string, nextAttemptAt *time.Time) error
+	PostponeEvents(ctx context.Context, ids []uuid.UUID, nextAttemptAt time.Time) error
+	ListDeadEvents(ctx context.Context, limit, offset int) ([]entity.DeadOutboxEvent, error)
+	RequeueDeadEvents(ctx context.Context, ids []uuid.UUID) (int, error)
+	DeletePublishedBefore(ctx context.Context, before time.Time) (int, error)
+	GetEvent(ctx context.Context, id uuid.UUID) (entity.OutboxEvent, error)
+	ListUserEventsAfter(ctx context.Context, userID, afterID uuid.UUID, limit int) ([]entity.OutboxEvent, error)
+	ListenEvents(ctx context.Context, fn func(entity.OutboxNotification)) error
+}
+
+type Notification interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (entity.NotificationPreferences, error)
+	SavePreferences(ctx context.Context, prefs entity.NotificationPreferences) (*entity.NotificationPreferences, error)
+	ListReminderRecipients(ctx context.Context) ([]entity.NotificationPreferences, error)
+	ClaimReminder(ctx context.Context, reminder entity.Reminder) (bool, error)
+	ReleaseReminder(ctx context.Context, reminder entity.Reminder) error
+}
+
+type Job interface {
+	WithJobLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+	StartRun(ctx context.Context, run *entity.JobRun) (bool, error)
+	FinishRun(ctx context.Context, run *entity.JobRun) error
+	ListRuns(ctx context.Context, name string, offset, limit int) ([]entity.JobRun, error)
+	ListLastRuns(ctx context.Context) ([]entity.JobRun, error)
+}
+
+type Import interface {
+	CreateImport(ctx context.Context, imp *entity.Import) error
+	GetImport(ctx context.Context, id uuid.UUID) (entity.Import, error)
+	UpdateImport(ctx context.Context, imp *entity.Import) error
+	TouchImport(ctx context.Context, id uuid.UUID) error
+	FailStaleImports(ctx context.Context, timeout time.Duration, reason string) (int, error)
+}
+
+type UserData interface {
+	ExportUserData(ctx context.Context, userID uuid.UUID) (entity.UserData, error)
+	EraseUserData(ctx context.Context, userID uuid.UUID, erasure *entity.UserErasure) error
+}
+
+type CalendarFeed interface {
+	SaveToken(ctx context.Context, userID uuid.UUID, token string) error
+	GetUserIDByToken(ctx context.Context, token string) (uuid.UUID, error)
 }
 
 type Repositories struct {
 	Subscription
 	Report
+	Analytics
+	Snapshot
+	CalendarFeed
+	PromoCode
+	Budget
+	Webhook
+	Outbox
+	Notification
+	Job
+	Import
+	UserData
 }
 
 func NewRepositories(pg *pgxpool.Pool) *Repositories {
 	return &Repositories{
 		Subscription: pgdb.NewSubscriptionRepo(pg),
 		Report:       pgdb.NewReportRepo(pg),
+		Analytics:    pgdb.NewAnalyticsRepo(pg),
+		Snapshot:     pgdb.NewSnapshotRepo(pg),
+		CalendarFeed: pgdb.NewCalendarFeedRepo(pg),
+		PromoCode:    pgdb.NewPromoCodeRepo(pg),
+		Budget:       pgdb.NewBudgetRepo(pg),
+		Webhook:      pgdb.NewWebhookRepo(pg),
+		Outbox:       pgdb.NewOutboxRepo(pg),
+		Notification: pgdb.NewNotificationRepo(pg),
+		Job:          pgdb.NewJobRepo(pg),
+		Import:       pgdb.NewImportRepo(pg),
+		UserData:     pgdb.NewUserDataRepo(pg),
 	}
 }
@@ -1,8 +1,34 @@
 package repoerrs
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
 
 var (
 	ErrNotFound      = errors.New("not found")
 	ErrAlreadyExists = errors.New("already exists")
+	ErrConflict      = errors.New("conflict")
+	ErrOverlap       = errors.New("overlaps another subscription")
 )
+
+// OverlapError rejects a subscription whose period overlaps another
+// subscription of the same user and service. It matches ErrOverlap.
+type OverlapError struct {
+	// SubscriptionID is the overlapped subscription, uuid.Nil when it is
+	// not known.
+	SubscriptionID uuid.UUID
+}
+
+func (e *OverlapError) Error() string {
+	if e.SubscriptionID == uuid.Nil {
+		return ErrOverlap.Error()
+	}
+	return fmt.Sprintf("overlaps subscription %s", e.SubscriptionID)
+}
+
+func (e *OverlapError) Unwrap() error {
+	return ErrOverlap
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+)
+
+const (
+	analyticsCacheTTL  = time.Hour
+	analyticsCacheSize = 1024
+)
+
+type analyticsService struct {
+	repos     *repo.Repositories
+	mrr       *monthCache[entity.MonthlyMRR]
+	retention *monthCache[[]entity.RetentionCohort]
+}
+
+func NewAnalyticsService(repos *repo.Repositories) AnalyticsService {
+	return &analyticsService{
+		repos:     repos,
+		mrr:       newMonthCache[entity.MonthlyMRR](analyticsCacheTTL, analyticsCacheSize),
+		retention: newMonthCache[[]entity.RetentionCohort](analyticsCacheTTL, analyticsCacheSize),
+	}
+}
+
+func (s *analyticsService) GetMonthlyMRR(
+	ctx context.Context,
+	startDate, endDate time.Time,
+) ([]entity.MonthlyMRR, error) {
+	startDate, endDate = monthStart(startDate), monthStart(endDate)
+	if endDate.Before(startDate) {
+		return nil, fmt.Errorf("AnalyticsService.GetMonthlyMRR - end date before start date")
+	}
+
+	// Versions are read before the months are computed, so an edit committed
+	// in between only costs a cache miss later.
+	var versions map[time.Time]int64
+	if isClosedMonth(startDate) {
+		var err error
+		versions, err = s.repos.Snapshot.GetMonthVersions(ctx, startDate, endDate)
+		if err != nil {
+			return nil, fmt.Errorf("AnalyticsService.GetMonthlyMRR - repo error: %v", err)
+		}
+		if cached, ok := s.cachedMRR(startDate, endDate, versions); ok {
+			return cached, nil
+		}
+	}
+
+	months, err := s.repos.Analytics.GetMonthlyMRR(ctx, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("AnalyticsService.GetMonthlyMRR - repo error: %v", err)
+	}
+
+	for _, m := range months {
+		if isClosedMonth(m.Month) {
+			s.mrr.Set(monthKey(m.Month), versions[monthStart(m.Month)], m)
+		}
+	}
+
+	return months, nil
+}
+
+// cachedMRR succeeds only when every month of the range is closed and cached
+// at its current version.
+func (s *analyticsService) cachedMRR(startDate, endDate time.Time, versions map[time.Time]int64) ([]entity.MonthlyMRR, bool) {
+	if !isClosedMonth(endDate) {
+		return nil, false
+	}
+
+	var months []entity.MonthlyMRR
+	for current := startDate; !current.After(endDate); current = current.AddDate(0, 1, 0) {
+		m, ok := s.mrr.Get(monthKey(current), versions[current])
+		if !ok {
+			return nil, false
+		}
+		months = append(months, m)
+	}
+	return months, true
+}
+
+func (s *analyticsService) GetRetentionCohorts(
+	ctx context.Context,
+	serviceName *string,
+	startDate, endDate time.Time,
+) ([]entity.RetentionCohort, error) {
+	startDate, endDate = monthStart(startDate), monthStart(endDate)
+	if endDate.Before(startDate) {
+		return nil, fmt.Errorf("AnalyticsService.GetRetentionCohorts - end date before start date")
+	}
+
+	key := fmt.Sprintf("%s:%s", monthKey(startDate), monthKey(endDate))
+	if serviceName != nil {
+		key += ":" + *serviceName
+	}
+	closed := isClosedMonth(endDate)
+
+	// Versions only grow, so their sum changes with any month of the range.
+	var version int64
+	if closed {
+		versions, err := s.repos.Snapshot.GetMonthVersions(ctx, startDate, endDate)
+		if err != nil {
+			return nil, fmt.Errorf("AnalyticsService.GetRetentionCohorts - repo error: %v", err)
+		}
+		for _, v := range versions {
+			version += v
+		}
+		if cached, ok := s.retention.Get(key, version); ok {
+			return cached, nil
+		}
+	}
+
+	cohorts, err := s.repos.Analytics.GetRetentionCohorts(ctx, serviceName, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("AnalyticsService.GetRetentionCohorts - repo error: %v", err)
+	}
+
+	if closed {
+		s.retention.Set(key, version, cohorts)
+	}
+
+	return cohorts, nil
+}
+
+func (s *analyticsService) GetTopServices(
+	ctx context.Context,
+	orderBy entity.ServiceRankingMetric,
+	startDate, endDate time.Time,
+	offset, limit int,
+) ([]entity.ServiceRanking, int, error) {
+	if endDate.Before(startDate) {
+		return nil, 0, fmt.Errorf("AnalyticsService.GetTopServices - end date before start date")
+	}
+	if orderBy == "" {
+		orderBy = entity.RankBySubscribers
+	}
+
+	ranking, total, err := s.repos.Analytics.GetTopServices(ctx, orderBy, monthStart(startDate), monthStart(endDate), offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsService.GetTopServices - repo error: %v", err)
+	}
+	return ranking, total, nil
+}
+
+func (s *analyticsService) GetTopUsers(
+	ctx context.Context,
+	startDate, endDate time.Time,
+	offset, limit int,
+) ([]entity.UserSpend, int, error) {
+	if endDate.Before(startDate) {
+		return nil, 0, fmt.Errorf("AnalyticsService.GetTopUsers - end date before start date")
+	}
+
+	ranking, total, err := s.repos.Analytics.GetTopUsers(ctx, monthStart(startDate), monthStart(endDate), offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("AnalyticsService.GetTopUsers - repo error: %v", err)
+	}
+	return ranking, total, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+)
+
+// countingAnalytics computes one MRR row per month and counts the queries.
+type countingAnalytics struct {
+	repo.Analytics
+	queries int
+}
+
+func (a *countingAnalytics) GetMonthlyMRR(_ context.Context, startDate, endDate time.Time) ([]entity.MonthlyMRR, error) {
+	a.queries++
+	var months []entity.MonthlyMRR
+	for current := startDate; !current.After(endDate); current = current.AddDate(0, 1, 0) {
+		months = append(months, entity.MonthlyMRR{Month: current, MRR: 100 * a.queries})
+	}
+	return months, nil
+}
+
+// versionedSnapshot serves month versions that a test bumps like an edit does.
+type versionedSnapshot struct {
+	repo.Snapshot
+	versions map[time.Time]int64
+}
+
+func (s *versionedSnapshot) GetMonthVersions(context.Context, time.Time, time.Time) (map[time.Time]int64, error) {
+	return s.versions, nil
+}
+
+func TestGetMonthlyMRRDropsInvalidatedMonths(t *testing.T) {
+	ctx := context.Background()
+	analytics := &countingAnalytics{}
+	snapshot := &versionedSnapshot{versions: map[time.Time]int64{}}
+	svc := NewAnalyticsService(&repo.Repositories{Analytics: analytics, Snapshot: snapshot})
+
+	start := monthStart(time.Now().UTC()).AddDate(0, -3, 0)
+	end := start.AddDate(0, 1, 0)
+	for range 2 {
+		if _, err := svc.GetMonthlyMRR(ctx, start, end); err != nil {
+			t.Fatalf("GetMonthlyMRR: %v", err)
+		}
+	}
+	if analytics.queries != 1 {
+		t.Fatalf("%d queries for the same closed months, want 1", analytics.queries)
+	}
+
+	// An edit of a subscription in the second month bumps its version.
+	snapshot.versions[end] = 1
+	months, err := svc.GetMonthlyMRR(ctx, start, end)
+	if err != nil {
+		t.Fatalf("GetMonthlyMRR: %v", err)
+	}
+	if analytics.queries != 2 || months[1].MRR != 200 {
+		t.Errorf("after the edit: %d queries and MRR %d, want the months computed again", analytics.queries, months[1].MRR)
+	}
+}
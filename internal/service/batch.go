@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+)
+
+func (s *subscriptionService) CreateSubscriptions(
+	ctx context.Context,
+	subs []entity.Subscription,
+	mode entity.BatchMode,
+) ([]entity.BatchItemResult, error) {
+	results := make([]entity.BatchItemResult, len(subs))
+	var (
+		valid    []int
+		prepared []entity.Subscription
+	)
+	for i, sub := range subs {
+		sub, err := s.prepareSubscription(ctx, sub)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		sub.OverlapPolicy = s.overlapPolicy
+		valid, prepared = append(valid, i), append(prepared, sub)
+	}
+
+	results, err := runBatch(mode, results, valid, func() ([]entity.BatchItemResult, error) {
+		return s.repos.Subscription.CreateSubscriptions(ctx, prepared, mode == entity.BatchAtomic)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionService.CreateSubscriptions - repo error: %v", err)
+	}
+	warnBatchOverlaps("CreateSubscriptions", results)
+	return results, nil
+}
+
+func (s *subscriptionService) UpdateSubscriptions(
+	ctx context.Context,
+	subs []entity.Subscription,
+	mode entity.BatchMode,
+) ([]entity.BatchItemResult, error) {
+	ids := make([]uuid.UUID, len(subs))
+	for i, sub := range subs {
+		ids[i] = sub.ID
+	}
+	existing, err := s.repos.Subscription.GetSubscriptionsByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionService.UpdateSubscriptions - get subs error: %v", err)
+	}
+	current := make(map[uuid.UUID]entity.Subscription, len(existing))
+	for _, sub := range existing {
+		current[sub.ID] = sub
+	}
+
+	results := make([]entity.BatchItemResult, len(subs))
+	var (
+		valid   []int
+		updated []entity.Subscription
+	)
+	for i, sub := range subs {
+		results[i].ID = sub.ID
+		cur, ok := current[sub.ID]
+		if !ok {
+			results[i].Err = repoerrs.ErrNotFound
+			continue
+		}
+		cur, err := applyUpdate(cur, sub)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		cur.OverlapPolicy = s.overlapPolicy
+		valid, updated = append(valid, i), append(updated, cur)
+	}
+
+	results, err = runBatch(mode, results, valid, func() ([]entity.BatchItemResult, error) {
+		return s.repos.Subscription.UpdateSubscriptions(ctx, updated, mode == entity.BatchAtomic)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionService.UpdateSubscriptions - repo error: %v", err)
+	}
+	warnBatchOverlaps("UpdateSubscriptions", results)
+	return results, nil
+}
+
+func (s *subscriptionService) DeleteSubscriptions(
+	ctx context.Context,
+	ids []uuid.UUID,
+	mode entity.BatchMode,
+) ([]entity.BatchItemResult, error) {
+	results, err := s.repos.Subscription.DeleteSubscriptions(ctx, ids, mode == entity.BatchAtomic)
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionService.DeleteSubscriptions - repo error: %v", err)
+	}
+	if mode == entity.BatchAtomic {
+		abortBatch(results)
+	}
+	return results, nil
+}
+
+// runBatch hands the items at valid to apply and merges the outcomes, which
+// apply returns in the same order, into results. An atomic batch with an
+// item that already failed validation is not applied at all.
+func runBatch(
+	mode entity.BatchMode,
+	results []entity.BatchItemResult,
+	valid []int,
+	apply func() ([]entity.BatchItemResult, error),
+) ([]entity.BatchItemResult, error) {
+	if len(valid) > 0 && (mode != entity.BatchAtomic || len(valid) == len(results)) {
+		applied, err := apply()
+		if err != nil {
+			return nil, err
+		}
+		for k, i := range valid {
+			results[i] = applied[k]
+		}
+	}
+	if mode == entity.BatchAtomic {
+		abortBatch(results)
+	}
+	return results, nil
+}
+
+// warnBatchOverlaps logs the items of a batch that were saved overlapping
+// other subscriptions.
+func warnBatchOverlaps(op string, results []entity.BatchItemResult) {
+	for _, result := range results {
+		if result.Err == nil {
+			warnOverlaps(op, entity.Subscription{ID: result.ID, Overlaps: result.Overlaps})
+		}
+	}
+}
+
+// abortBatch marks the items of an atomic batch that did not fail as aborted
+// when any item failed, since none of them was committed.
+func abortBatch(results []entity.BatchItemResult) {
+	failed := false
+	for _, result := range results {
+		failed = failed || result.Err != nil
+	}
+	if !failed {
+		return
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type budgetService struct {
+	repos *repo.Repositories
+	costs SubscriptionService
+}
+
+// NewBudgetService creates a budget service that measures spend with costs,
+// the same calculation the total cost endpoint uses.
+func NewBudgetService(repos *repo.Repositories, costs SubscriptionService) BudgetService {
+	return &budgetService{repos: repos, costs: costs}
+}
+
+func (s *budgetService) CreateBudget(ctx context.Context, budget entity.Budget) (*entity.Budget, error) {
+	if budget.Amount <= 0 {
+		return nil, fmt.Errorf("BudgetService.CreateBudget - amount must be positive")
+	}
+
+	created, err := s.repos.Budget.CreateBudget(ctx, budget)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrAlreadyExists) {
+			return nil, fmt.Errorf("BudgetService.CreateBudget - %w", err)
+		}
+		return nil, fmt.Errorf("BudgetService.CreateBudget - repo error: %v", err)
+	}
+
+	s.evaluateQuietly(ctx, created.UserID)
+	return created, nil
+}
+
+func (s *budgetService) ListBudgets(ctx context.Context, userID uuid.UUID) ([]entity.Budget, error) {
+	budgets, err := s.repos.Budget.ListBudgets(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("BudgetService.ListBudgets - repo error: %v", err)
+	}
+	return budgets, nil
+}
+
+func (s *budgetService) UpdateBudget(ctx context.Context, id uuid.UUID, amount int) (*entity.Budget, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("BudgetService.UpdateBudget - amount must be positive")
+	}
+
+	updated, err := s.repos.Budget.UpdateBudget(ctx, id, amount)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, fmt.Errorf("BudgetService.UpdateBudget - %w", err)
+		}
+		return nil, fmt.Errorf("BudgetService.UpdateBudget - repo error: %v", err)
+	}
+
+	s.evaluateQuietly(ctx, updated.UserID)
+	return updated, nil
+}
+
+func (s *budgetService) DeleteBudget(ctx context.Context, id uuid.UUID) error {
+	if err := s.repos.Budget.DeleteBudget(ctx, id); err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return fmt.Errorf("BudgetService.DeleteBudget - %w", err)
+		}
+		return fmt.Errorf("BudgetService.DeleteBudget - repo error: %v", err)
+	}
+	return nil
+}
+
+func (s *budgetService) ListAlerts(ctx context.Context, userID uuid.UUID, offset, limit int) ([]entity.BudgetAlert, error) {
+	alerts, err := s.repos.Budget.ListAlerts(ctx, userID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("BudgetService.ListAlerts - repo error: %v", err)
+	}
+	return alerts, nil
+}
+
+// EvaluateUser compares the net spend of the current month and the projected
+// spend of the next month with every budget of the user and records an alert
+// for each budget that is exceeded. Only alerts not raised before are returned.
+func (s *budgetService) EvaluateUser(ctx context.Context, userID uuid.UUID) ([]entity.BudgetAlert, error) {
+	budgets, err := s.repos.Budget.ListBudgets(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("BudgetService.EvaluateUser - list budgets: %v", err)
+	}
+
+	current := monthStart(time.Now().UTC())
+	checks := []struct {
+		kind  entity.BudgetAlertKind
+		month time.Time
+	}{
+		{entity.AlertActual, current},
+		{entity.AlertProjected, current.AddDate(0, 1, 0)},
+	}
+
+	var raised []entity.BudgetAlert
+	for _, budget := range budgets {
+		for _, check := range checks {
+			spend, err := s.costs.CalculateTotalCost(ctx, &userID, budget.ServiceName, check.month, check.month)
+			if err != nil {
+				return raised, fmt.Errorf("BudgetService.EvaluateUser - calculate cost: %v", err)
+			}
+			if spend.Net <= budget.Amount {
+				continue
+			}
+
+			alert := entity.BudgetAlert{
+				BudgetID:    budget.ID,
+				UserID:      userID,
+				ServiceName: budget.ServiceName,
+				Kind:        check.kind,
+				Month:       check.month,
+				Spend:       spend.Net,
+				Amount:      budget.Amount,
+			}
+			created, err := s.repos.Budget.SaveAlert(ctx, &alert)
+			if err != nil {
+				return raised, fmt.Errorf("BudgetService.EvaluateUser - save alert: %v", err)
+			}
+			if created {
+				log.Warnf("BudgetService - budget %s of user %s exceeded: %s spend %d > %d for %s",
+					budget.ID, userID, alert.Kind, alert.Spend, alert.Amount, monthKey(alert.Month))
+				raised = append(raised, alert)
+			}
+		}
+	}
+
+	return raised, nil
+}
+
+// EvaluateAll runs EvaluateUser for every user with a budget and returns how
+// many new alerts were raised.
+func (s *budgetService) EvaluateAll(ctx context.Context) (int, error) {
+	userIDs, err := s.repos.Budget.ListBudgetUserIDs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("BudgetService.EvaluateAll - repo error: %v", err)
+	}
+
+	raised := 0
+	for _, userID := range userIDs {
+		alerts, err := s.EvaluateUser(ctx, userID)
+		raised += len(alerts)
+		if err != nil {
+			return raised, fmt.Errorf("BudgetService.EvaluateAll - %v", err)
+		}
+	}
+	return raised, nil
+}
+
+// OnSubscriptionEvent re-evaluates the budgets of the user whose subscription
+// changed. A failure does not hold up the outbox, the periodic evaluation
+// catches up.
+func (s *budgetService) OnSubscriptionEvent(ctx context.Context, event entity.SubscriptionEvent) error {
+	s.evaluateQuietly(ctx, event.Subscription.UserID)
+	return nil
+}
+
+// evaluateQuietly evaluates budgets after a change that is already committed,
+// so a failure is logged instead of failing the request.
+func (s *budgetService) evaluateQuietly(ctx context.Context, userID uuid.UUID) {
+	if _, err := s.EvaluateUser(context.WithoutCancel(ctx), userID); err != nil {
+		log.Errorf("BudgetService - evaluate budgets of user %s: %v", userID, err)
+	}
+}
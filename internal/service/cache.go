@@ -0,0 +1,91 @@
+package service
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// monthCache keeps results that belong to closed months, which only change
+// when historical subscriptions are edited. Every entry carries the version
+// of its months it was computed at and is dropped when asked for with another
+// one, so edits are picked up right away by every replica. Entries also
+// expire after ttl, and past size entries the least recently used one is
+// evicted, since keys carry client input.
+type monthCache[T any] struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry[T any] struct {
+	key       string
+	version   int64
+	value     T
+	expiresAt time.Time
+}
+
+func newMonthCache[T any](ttl time.Duration, size int) *monthCache[T] {
+	return &monthCache[T]{
+		ttl:   ttl,
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *monthCache[T]) Get(key string, version int64) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*cacheEntry[T])
+	if entry.version != version || time.Now().After(entry.expiresAt) {
+		c.remove(elem)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *monthCache[T]) Set(key string, version int64, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry[T])
+		entry.version, entry.value, entry.expiresAt = version, value, expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry[T]{key: key, version: version, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *monthCache[T]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry[T]).key)
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// isClosedMonth reports whether the month of t is entirely in the past.
+func isClosedMonth(t time.Time) bool {
+	return monthStart(t).Before(monthStart(time.Now().UTC()))
+}
+
+func monthKey(t time.Time) string {
+	return t.Format("2006-01")
+}
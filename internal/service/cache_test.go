@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newMonthCache[int](time.Hour, 2)
+	c.Set("a", 0, 1)
+	c.Set("b", 0, 2)
+	if _, ok := c.Get("a", 0); !ok {
+		t.Fatal("a missing before eviction")
+	}
+	c.Set("c", 0, 3)
+
+	if _, ok := c.Get("b", 0); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := c.Get(key, 0); !ok || got != want {
+			t.Errorf("Get(%q) = %d, %v; want %d, true", key, got, ok, want)
+		}
+	}
+	if len(c.items) != 2 || c.order.Len() != 2 {
+		t.Errorf("cache holds %d items, %d in order; want 2", len(c.items), c.order.Len())
+	}
+}
+
+func TestMonthCacheExpiresEntries(t *testing.T) {
+	c := newMonthCache[int](time.Millisecond, 2)
+	c.Set("a", 0, 1)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("a", 0); ok {
+		t.Error("expired entry returned")
+	}
+	if len(c.items) != 0 {
+		t.Errorf("expired entry kept, cache holds %d items", len(c.items))
+	}
+}
+
+func TestMonthCacheSetRefreshesEntry(t *testing.T) {
+	c := newMonthCache[int](time.Hour, 2)
+	c.Set("a", 0, 1)
+	c.Set("b", 0, 2)
+	c.Set("a", 0, 10)
+	c.Set("c", 0, 3)
+
+	if got, ok := c.Get("a", 0); !ok || got != 10 {
+		t.Errorf("Get(a) = %d, %v; want 10, true", got, ok)
+	}
+	if _, ok := c.Get("b", 0); ok {
+		t.Error("b should have been evicted")
+	}
+}
+
+func TestMonthCacheDropsOtherVersion(t *testing.T) {
+	c := newMonthCache[int](time.Hour, 2)
+	c.Set("a", 1, 10)
+
+	if got, ok := c.Get("a", 1); !ok || got != 10 {
+		t.Errorf("Get(a, 1) = %d, %v; want 10, true", got, ok)
+	}
+	if _, ok := c.Get("a", 2); ok {
+		t.Error("entry of version 1 returned for version 2")
+	}
+	if len(c.items) != 0 {
+		t.Errorf("outdated entry kept, cache holds %d items", len(c.items))
+	}
+}
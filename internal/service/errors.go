@@ -0,0 +1,22 @@
+package service
+
+import "errors"
+
+var (
+	ErrInvalidTransition  = errors.New("invalid status transition")
+	ErrInvalidStatus      = errors.New("invalid status")
+	ErrInvalidDiscount    = errors.New("invalid discount")
+	ErrInvalidPromoCode   = errors.New("invalid promo code")
+	ErrInvalidTrial       = errors.New("invalid trial period")
+	ErrInvalidWebhook     = errors.New("invalid webhook endpoint")
+	ErrInvalidPreferences = errors.New("invalid notification preferences")
+	ErrJobNotFound        = errors.New("job not found")
+	ErrJobRunning         = errors.New("job is already running")
+	ErrInvalidPeriod      = errors.New("invalid subscription period")
+	// ErrBatchAborted marks items of an atomic batch that were not applied
+	// because another item failed.
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrPublisherUnavailable marks publish failures caused by the broker
+	// being unreachable rather than by the event.
+	ErrPublisherUnavailable = errors.New("publisher unavailable")
+)
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/google/uuid"
+)
+
+type exportService struct {
+	repos *repo.Repositories
+}
+
+func NewExportService(repos *repo.Repositories) ExportService {
+	return &exportService{repos: repos}
+}
+
+func (s *exportService) ExportSubscriptions(
+	ctx context.Context,
+	userID *uuid.UUID,
+	fn func(entity.Subscription) error,
+) error {
+	if err := s.repos.Subscription.StreamSubscriptions(ctx, userID, fn); err != nil {
+		return fmt.Errorf("ExportService.ExportSubscriptions - %w", err)
+	}
+	return nil
+}
+
+func (s *exportService) ExportCostBreakdown(
+	ctx context.Context,
+	userID *uuid.UUID,
+	serviceName *string,
+	startDate, endDate time.Time,
+	fn func(entity.CostBreakdownItem) error,
+) error {
+	startDate, endDate = monthStart(startDate), monthStart(endDate)
+	if endDate.Before(startDate) {
+		return fmt.Errorf("ExportService.ExportCostBreakdown - end date before start date")
+	}
+
+	if err := s.repos.Report.StreamCostBreakdown(ctx, userID, serviceName, startDate, endDate, fn); err != nil {
+		return fmt.Errorf("ExportService.ExportCostBreakdown - %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// importChunkSize is how many rows of an import are created in one batch,
+// the progress is saved after each batch.
+const importChunkSize = 500
+
+const (
+	// importHeartbeat is how often a running import records it is alive.
+	importHeartbeat = 30 * time.Second
+	// importStaleAfter is how long after its last heartbeat an import is
+	// taken for lost with its instance and failed.
+	importStaleAfter = 5 * time.Minute
+	// importInterrupted is the error of an import that stopped before it
+	// finished.
+	importInterrupted = "interrupted"
+)
+
+type importService struct {
+	repos         *repo.Repositories
+	subscriptions SubscriptionService
+	heartbeat     time.Duration
+
+	// ctx bounds running imports, which outlive their request.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewImportService creates the import service. Rows are validated and
+// created by the subscription service, as in a best-effort batch.
+func NewImportService(repos *repo.Repositories, subscriptions SubscriptionService) ImportService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &importService{
+		repos:         repos,
+		subscriptions: subscriptions,
+		heartbeat:     importHeartbeat,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+func (s *importService) CheckImport(ctx context.Context, rows []entity.ImportRow) entity.Import {
+	imp, _ := s.checkRows(ctx, rows)
+	return imp
+}
+
+// checkRows returns the report of the rows that failed validation and the
+// rows that passed.
+func (s *importService) checkRows(ctx context.Context, rows []entity.ImportRow) (entity.Import, []entity.ImportRow) {
+	imp := entity.Import{TotalRows: len(rows), Errors: []entity.ImportRowError{}}
+	var valid []entity.ImportRow
+	for _, row := range rows {
+		if row.Error == "" {
+			if err := s.subscriptions.ValidateSubscription(ctx, row.Subscription); err != nil {
+				row.Error = err.Error()
+			}
+		}
+		if row.Error != "" {
+			imp.Errors = append(imp.Errors, entity.ImportRowError{Line: row.Line, Error: row.Error})
+			continue
+		}
+		valid = append(valid, row)
+	}
+	imp.ValidRows = len(valid)
+	imp.FailedRows = len(imp.Errors)
+	return imp, valid
+}
+
+func (s *importService) StartImport(ctx context.Context, rows []entity.ImportRow) (*entity.Import, error) {
+	imp, valid := s.checkRows(ctx, rows)
+	imp.Status = entity.ImportRunning
+	if len(valid) == 0 {
+		imp.Status = entity.ImportCompleted
+	}
+	if err := s.repos.Import.CreateImport(ctx, &imp); err != nil {
+		return nil, fmt.Errorf("ImportService.StartImport - repo error: %v", err)
+	}
+
+	if imp.Status == entity.ImportRunning {
+		run := imp
+		run.Errors = slices.Clone(imp.Errors)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(s.ctx, run, valid)
+		}()
+	}
+	return &imp, nil
+}
+
+// run creates the subscriptions of the rows in chunks and saves the progress
+// of the import after each chunk. The import fails at the first chunk that
+// could not be applied; rows rejected by the database are skipped.
+func (s *importService) run(ctx context.Context, imp entity.Import, rows []entity.ImportRow) {
+	stop := s.keepAlive(ctx, imp.ID)
+	defer stop()
+
+	for start := 0; start < len(rows); start += importChunkSize {
+		chunk := rows[start:min(start+importChunkSize, len(rows))]
+		subs := make([]entity.Subscription, len(chunk))
+		for i, row := range chunk {
+			subs[i] = row.Subscription
+		}
+
+		results, err := s.subscriptions.CreateSubscriptions(ctx, subs, entity.BatchBestEffort)
+		if err != nil {
+			msg := err.Error()
+			if ctx.Err() != nil {
+				msg = importInterrupted
+			}
+			imp.Status, imp.Error = entity.ImportFailed, &msg
+		} else {
+			for i, result := range results {
+				if result.Err != nil {
+					imp.FailedRows++
+					imp.Errors = append(imp.Errors, entity.ImportRowError{Line: chunk[i].Line, Error: result.Err.Error()})
+					continue
+				}
+				imp.ImportedRows++
+			}
+			imp.ProcessedRows += len(chunk)
+			if imp.ProcessedRows == len(rows) {
+				imp.Status = entity.ImportCompleted
+			}
+		}
+
+		// An import cancelled by shutdown is still recorded as failed.
+		if err := s.repos.Import.UpdateImport(context.WithoutCancel(ctx), &imp); err != nil {
+			log.Errorf("ImportService - import %s: %v", imp.ID, err)
+			return
+		}
+		if imp.Status != entity.ImportRunning {
+			break
+		}
+	}
+	log.Infof("ImportService - import %s %s: %d imported, %d failed", imp.ID, imp.Status, imp.ImportedRows, imp.FailedRows)
+}
+
+// keepAlive touches the heartbeat of the import until the returned function
+// is called.
+func (s *importService) keepAlive(ctx context.Context, id uuid.UUID) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.repos.Import.TouchImport(ctx, id); err != nil && ctx.Err() == nil {
+					log.Warnf("ImportService - heartbeat of import %s: %v", id, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// FailStaleImports fails imports whose instance stopped without finishing
+// them, e.g. after a crash.
+func (s *importService) FailStaleImports(ctx context.Context) (int, error) {
+	n, err := s.repos.Import.FailStaleImports(ctx, importStaleAfter, importInterrupted)
+	if err != nil {
+		return 0, fmt.Errorf("ImportService.FailStaleImports - repo error: %v", err)
+	}
+	if n > 0 {
+		log.Warnf("ImportService - failed %d imports without a heartbeat", n)
+	}
+	return n, nil
+}
+
+func (s *importService) GetImport(ctx context.Context, id uuid.UUID) (*entity.Import, error) {
+	imp, err := s.repos.Import.GetImport(ctx, id)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, fmt.Errorf("ImportService.GetImport - %w", err)
+		}
+		return nil, fmt.Errorf("ImportService.GetImport - repo error: %v", err)
+	}
+	return &imp, nil
+}
+
+// Shutdown cancels running imports and waits for them to stop.
+func (s *importService) Shutdown() {
+	s.cancel()
+	s.wg.Wait()
+}
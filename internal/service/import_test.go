@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/google/uuid"
+)
+
+// memoryImports keeps the last saved state of one import.
+type memoryImports struct {
+	repo.Import
+	mu      sync.Mutex
+	imp     entity.Import
+	touched atomic.Int32
+}
+
+func (m *memoryImports) CreateImport(_ context.Context, imp *entity.Import) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	imp.ID = uuid.New()
+	m.imp = *imp
+	return nil
+}
+
+func (m *memoryImports) UpdateImport(_ context.Context, imp *entity.Import) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.imp = *imp
+	return nil
+}
+
+func (m *memoryImports) TouchImport(context.Context, uuid.UUID) error {
+	m.touched.Add(1)
+	return nil
+}
+
+func (m *memoryImports) status() entity.ImportStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.imp.Status
+}
+
+// slowSubscriptions accepts every row and creates them once release is
+// closed.
+type slowSubscriptions struct {
+	SubscriptionService
+	release chan struct{}
+}
+
+func (s slowSubscriptions) ValidateSubscription(context.Context, entity.Subscription) error {
+	return nil
+}
+
+func (s slowSubscriptions) CreateSubscriptions(_ context.Context, subs []entity.Subscription, _ entity.BatchMode) ([]entity.BatchItemResult, error) {
+	<-s.release
+	results := make([]entity.BatchItemResult, len(subs))
+	for i := range results {
+		results[i].ID = uuid.New()
+	}
+	return results, nil
+}
+
+func TestImportHeartbeatWhileRunning(t *testing.T) {
+	imports := &memoryImports{}
+	subs := slowSubscriptions{release: make(chan struct{})}
+	svc := NewImportService(&repo.Repositories{Import: imports}, subs).(*importService)
+	svc.heartbeat = 5 * time.Millisecond
+	defer svc.Shutdown()
+
+	if _, err := svc.StartImport(context.Background(), []entity.ImportRow{{Line: 2}, {Line: 3}}); err != nil {
+		t.Fatalf("StartImport: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for imports.touched.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("import touched %d times while its chunk ran, want heartbeats", imports.touched.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(subs.release)
+	svc.Shutdown()
+	if status := imports.status(); status != entity.ImportCompleted {
+		t.Fatalf("import is %s, want completed", status)
+	}
+	touched := imports.touched.Load()
+	time.Sleep(4 * svc.heartbeat)
+	if imports.touched.Load() != touched {
+		t.Error("heartbeat continued after the import finished")
+	}
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// JobDefinition describes a background job. Run returns how many items it
+// processed.
+type JobDefinition struct {
+	Name        string
+	Description string
+	// Schedule is the default cron expression, evaluated in UTC.
+	Schedule string
+	Run      func(ctx context.Context) (int, error)
+}
+
+type scheduledJob struct {
+	JobDefinition
+	schedule cron.Schedule
+}
+
+type jobService struct {
+	repos    *repo.Repositories
+	jobs     map[string]*scheduledJob
+	names    []string
+	instance string
+
+	// ctx bounds manually triggered runs, which outlive their request.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobService registers the jobs. schedules overrides their default cron
+// expressions by job name.
+func NewJobService(repos *repo.Repositories, schedules map[string]string, definitions ...JobDefinition) (JobService, error) {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &jobService{
+		repos:    repos,
+		jobs:     make(map[string]*scheduledJob, len(definitions)),
+		instance: instance,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	for _, def := range definitions {
+		if spec, ok := schedules[def.Name]; ok {
+			def.Schedule = spec
+		}
+		schedule, err := cron.ParseStandard(def.Schedule)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("JobService - job %s: invalid schedule %q: %v", def.Name, def.Schedule, err)
+		}
+		s.jobs[def.Name] = &scheduledJob{JobDefinition: def, schedule: schedule}
+		s.names = append(s.names, def.Name)
+	}
+
+	for name := range schedules {
+		if _, ok := s.jobs[name]; !ok {
+			cancel()
+			return nil, fmt.Errorf("JobService - schedule for unknown job %s", name)
+		}
+	}
+	sort.Strings(s.names)
+
+	return s, nil
+}
+
+func (s *jobService) JobNames() []string {
+	return s.names
+}
+
+func (s *jobService) NextRun(name string, after time.Time) (time.Time, error) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return time.Time{}, fmt.Errorf("JobService.NextRun - %w", ErrJobNotFound)
+	}
+	return job.schedule.Next(after.UTC()), nil
+}
+
+func (s *jobService) ListJobs(ctx context.Context) ([]entity.Job, error) {
+	lastRuns, err := s.repos.Job.ListLastRuns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("JobService.ListJobs - repo error: %v", err)
+	}
+	byName := make(map[string]entity.JobRun, len(lastRuns))
+	for _, run := range lastRuns {
+		byName[run.Job] = run
+	}
+
+	now := time.Now().UTC()
+	jobs := make([]entity.Job, 0, len(s.names))
+	for _, name := range s.names {
+		job := s.jobs[name]
+		j := entity.Job{
+			Name:        name,
+			Description: job.Description,
+			Schedule:    job.Schedule,
+			NextRunAt:   job.schedule.Next(now),
+		}
+		if run, ok := byName[name]; ok {
+			j.LastRun = &run
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func (s *jobService) ListRuns(ctx context.Context, name string, offset, limit int) ([]entity.JobRun, error) {
+	if _, ok := s.jobs[name]; !ok {
+		return nil, fmt.Errorf("JobService.ListRuns - %w", ErrJobNotFound)
+	}
+
+	runs, err := s.repos.Job.ListRuns(ctx, name, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("JobService.ListRuns - repo error: %v", err)
+	}
+	return runs, nil
+}
+
+// RunScheduled runs the job for the cron slot and reports whether it ran
+// here. The slot is skipped when another instance holds the job lock or
+// already ran it.
+func (s *jobService) RunScheduled(ctx context.Context, name string, slot time.Time) (bool, error) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return false, fmt.Errorf("JobService.RunScheduled - %w", ErrJobNotFound)
+	}
+
+	slot = slot.UTC()
+	run := entity.JobRun{
+		Job:         name,
+		Trigger:     entity.JobTriggerSchedule,
+		Instance:    s.instance,
+		ScheduledAt: &slot,
+	}
+
+	ran := false
+	_, err := s.repos.Job.WithJobLock(ctx, name, func(ctx context.Context) error {
+		var err error
+		ran, err = s.runLocked(ctx, job, run, func(entity.JobRun) {})
+		return err
+	})
+	if err != nil {
+		return ran, fmt.Errorf("JobService.RunScheduled - %s: %v", name, err)
+	}
+	return ran, nil
+}
+
+type jobStart struct {
+	run entity.JobRun
+	err error
+}
+
+// TriggerJob starts the job in the background and returns its run once it
+// is recorded. ErrJobRunning is returned when the job is already running on
+// any instance.
+func (s *jobService) TriggerJob(ctx context.Context, name string) (*entity.JobRun, error) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("JobService.TriggerJob - %w", ErrJobNotFound)
+	}
+
+	run := entity.JobRun{
+		Job:      name,
+		Trigger:  entity.JobTriggerManual,
+		Instance: s.instance,
+	}
+
+	started := make(chan jobStart, 1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		notified := false
+		locked, err := s.repos.Job.WithJobLock(s.ctx, name, func(ctx context.Context) error {
+			_, err := s.runLocked(ctx, job, run, func(run entity.JobRun) {
+				notified = true
+				started <- jobStart{run: run}
+			})
+			return err
+		})
+		switch {
+		case !notified && err != nil:
+			started <- jobStart{err: err}
+		case !notified && !locked:
+			started <- jobStart{err: ErrJobRunning}
+		case err != nil:
+			log.Errorf("JobService - %s: %v", name, err)
+		}
+	}()
+
+	select {
+	case res := <-started:
+		if res.err != nil {
+			if errors.Is(res.err, ErrJobRunning) {
+				return nil, fmt.Errorf("JobService.TriggerJob - %w", ErrJobRunning)
+			}
+			return nil, fmt.Errorf("JobService.TriggerJob - repo error: %v", res.err)
+		}
+		return &res.run, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runLocked records the run, calls started and runs the job. The caller
+// holds the job lock. It reports false when the run was not recorded because
+// its slot already ran.
+func (s *jobService) runLocked(ctx context.Context, job *scheduledJob, run entity.JobRun, started func(entity.JobRun)) (bool, error) {
+	ok, err := s.repos.Job.StartRun(ctx, &run)
+	if err != nil || !ok {
+		return false, err
+	}
+	started(run)
+
+	processed, jobErr := job.Run(ctx)
+	run.Status = entity.JobSucceeded
+	if jobErr != nil {
+		run.Status = entity.JobFailed
+		msg := jobErr.Error()
+		run.Error = &msg
+	} else {
+		run.Processed = &processed
+	}
+
+	// A run cancelled by shutdown is still recorded as failed.
+	if err := s.repos.Job.FinishRun(context.WithoutCancel(ctx), &run); err != nil {
+		return true, err
+	}
+	if jobErr != nil {
+		return true, fmt.Errorf("run %s failed: %v", run.ID, jobErr)
+	}
+	if processed > 0 {
+		log.Infof("JobService - %s processed %d item(s)", job.Name, processed)
+	}
+	return true, nil
+}
+
+// Shutdown cancels manually triggered runs and waits for them to finish.
+func (s *jobService) Shutdown() {
+	s.cancel()
+	s.wg.Wait()
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// expiryBatchSize bounds how many subscriptions one expiry transaction handles.
+const expiryBatchSize = 100
+
+// transitions lists the statuses each status may move to. Cancelled and
+// expired are final.
+var transitions = map[entity.SubscriptionStatus][]entity.SubscriptionStatus{
+	entity.StatusTrial:  {entity.StatusActive, entity.StatusCancelled, entity.StatusExpired},
+	entity.StatusActive: {entity.StatusPaused, entity.StatusCancelled, entity.StatusExpired},
+	entity.StatusPaused: {entity.StatusActive, entity.StatusCancelled, entity.StatusExpired},
+}
+
+func canTransition(from, to entity.SubscriptionStatus) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// PauseSubscription stops charging from the next month on; the current month
+// has already been charged.
+func (s *subscriptionService) PauseSubscription(ctx context.Context, id uuid.UUID) error {
+	pausedFrom := monthStart(time.Now().UTC()).AddDate(0, 1, 0)
+	return s.changeStatus(ctx, "PauseSubscription", id, entity.StatusPaused, func(c *entity.StatusChange) {
+		c.PausedFrom = &pausedFrom
+	})
+}
+
+// ResumeSubscription charges the subscription again starting with the current month.
+func (s *subscriptionService) ResumeSubscription(ctx context.Context, id uuid.UUID) error {
+	resumedFrom := monthStart(time.Now().UTC())
+	return s.changeStatus(ctx, "ResumeSubscription", id, entity.StatusActive, func(c *entity.StatusChange) {
+		c.ResumedFrom = &resumedFrom
+	})
+}
+
+// CancelSubscription ends the subscription with the current month unless it
+// already ends earlier.
+func (s *subscriptionService) CancelSubscription(ctx context.Context, id uuid.UUID) error {
+	endDate := monthStart(time.Now().UTC())
+	return s.changeStatus(ctx, "CancelSubscription", id, entity.StatusCancelled, func(c *entity.StatusChange) {
+		c.EndDate = &endDate
+	})
+}
+
+// ExpireEnded activates trials that have ended, then expires subscriptions
+// whose last month has passed and extends those with auto_renew. It returns
+// how many subscriptions were changed.
+func (s *subscriptionService) ExpireEnded(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	changed := 0
+	for {
+		activated, err := s.repos.Subscription.ActivateEndedTrials(ctx, now, expiryBatchSize)
+		if err != nil {
+			return changed, fmt.Errorf("SubscriptionService.ExpireEnded - repo error: %v", err)
+		}
+		if activated > 0 {
+			log.Infof("SubscriptionService - activated %d subscription(s) after their trial", activated)
+		}
+		changed += activated
+		if activated < expiryBatchSize {
+			break
+		}
+	}
+
+	month := monthStart(now)
+	for {
+		expired, renewed, err := s.repos.Subscription.ExpireEnded(ctx, month, expiryBatchSize)
+		if err != nil {
+			return changed, fmt.Errorf("SubscriptionService.ExpireEnded - repo error: %v", err)
+		}
+		if expired+renewed > 0 {
+			log.Infof("SubscriptionService - expired %d, renewed %d subscription(s)", expired, renewed)
+		}
+		changed += expired + renewed
+		if expired+renewed < expiryBatchSize {
+			return changed, nil
+		}
+	}
+}
+
+func (s *subscriptionService) changeStatus(
+	ctx context.Context,
+	op string,
+	id uuid.UUID,
+	to entity.SubscriptionStatus,
+	apply func(*entity.StatusChange),
+) error {
+	current, err := s.repos.Subscription.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return fmt.Errorf("SubscriptionService.%s - %w", op, err)
+		}
+		return fmt.Errorf("SubscriptionService.%s - get sub error: %v", op, err)
+	}
+
+	if !canTransition(current.Status, to) {
+		return fmt.Errorf("SubscriptionService.%s - %w: %s -> %s", op, ErrInvalidTransition, current.Status, to)
+	}
+
+	change := entity.StatusChange{From: current.Status, To: to}
+	apply(&change)
+
+	if err := s.repos.Subscription.ChangeStatus(ctx, id, change); err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) || errors.Is(err, repoerrs.ErrConflict) {
+			return fmt.Errorf("SubscriptionService.%s - %w", op, err)
+		}
+		return fmt.Errorf("SubscriptionService.%s - repo error: %v", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+)
+
+// endingSubscriptions has trials to activate and nothing to expire, and
+// records the dates it was asked about.
+type endingSubscriptions struct {
+	repo.Subscription
+	trials    int
+	trialDays []time.Time
+	expired   bool
+}
+
+func (e *endingSubscriptions) ActivateEndedTrials(_ context.Context, today time.Time, limit int) (int, error) {
+	e.trialDays = append(e.trialDays, today)
+	n := min(e.trials, limit)
+	e.trials -= n
+	return n, nil
+}
+
+func (e *endingSubscriptions) ExpireEnded(context.Context, time.Time, int) (int, int, error) {
+	e.expired = true
+	return 0, 0, nil
+}
+
+func TestExpireEndedActivatesEndedTrials(t *testing.T) {
+	subs := &endingSubscriptions{trials: expiryBatchSize + 1}
+	svc := NewSubscriptionService(&repo.Repositories{Subscription: subs}, entity.OverlapReject)
+
+	changed, err := svc.ExpireEnded(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireEnded: %v", err)
+	}
+	if changed != expiryBatchSize+1 || subs.trials != 0 {
+		t.Errorf("changed %d with %d trials left, want all %d trials activated", changed, subs.trials, expiryBatchSize+1)
+	}
+	if len(subs.trialDays) != 2 {
+		t.Errorf("ActivateEndedTrials called %d times, want a second batch after a full one", len(subs.trialDays))
+	}
+	if today := time.Now().UTC(); subs.trialDays[0].Format(time.DateOnly) != today.Format(time.DateOnly) {
+		t.Errorf("trials ended by %v, want today %v", subs.trialDays[0], today)
+	}
+	if !subs.expired {
+		t.Error("ended subscriptions were not expired")
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/mailer"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReminderDays = 3
+	maxReminderDays     = 30
+)
+
+//go:embed templates/reminder.*
+var reminderTemplates embed.FS
+
+var reminderDateLayouts = map[entity.Locale]string{
+	entity.LocaleRU: "02.01.2006",
+	entity.LocaleEN: "January 2, 2006",
+}
+
+// MailSender delivers a rendered email, e.g. mailer.SMTPSender.
+type MailSender interface {
+	Send(ctx context.Context, msg mailer.Message) error
+}
+
+type reminderData struct {
+	ServiceName string
+	Price       int
+	ChargeDate  string
+	TrialEnding bool
+}
+
+type reminderTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type notificationService struct {
+	repos     *repo.Repositories
+	renewals  RenewalService
+	sender    MailSender
+	templates map[entity.Locale]reminderTemplate
+}
+
+// NewNotificationService creates the reminder service. A nil sender disables
+// sending, preferences can still be managed.
+func NewNotificationService(repos *repo.Repositories, renewals RenewalService, sender MailSender) NotificationService {
+	templates := make(map[entity.Locale]reminderTemplate, len(reminderDateLayouts))
+	for locale := range reminderDateLayouts {
+		// The templates are embedded, a parse error is a build defect.
+		templates[locale] = reminderTemplate{
+			text: texttemplate.Must(texttemplate.ParseFS(reminderTemplates, "templates/reminder."+string(locale)+".txt")),
+			html: htmltemplate.Must(htmltemplate.ParseFS(reminderTemplates, "templates/reminder."+string(locale)+".html")),
+		}
+	}
+	return &notificationService{repos: repos, renewals: renewals, sender: sender, templates: templates}
+}
+
+func (s *notificationService) GetPreferences(ctx context.Context, userID uuid.UUID) (*entity.NotificationPreferences, error) {
+	prefs, err := s.repos.Notification.GetPreferences(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, fmt.Errorf("NotificationService.GetPreferences - %w", err)
+		}
+		return nil, fmt.Errorf("NotificationService.GetPreferences - repo error: %v", err)
+	}
+	return &prefs, nil
+}
+
+func (s *notificationService) SavePreferences(ctx context.Context, prefs entity.NotificationPreferences) (*entity.NotificationPreferences, error) {
+	if prefs.Locale == "" {
+		prefs.Locale = entity.LocaleRU
+	}
+	if _, ok := reminderDateLayouts[prefs.Locale]; !ok {
+		return nil, fmt.Errorf("NotificationService.SavePreferences - %w: unsupported locale %s", ErrInvalidPreferences, prefs.Locale)
+	}
+	if prefs.DaysBefore == 0 {
+		prefs.DaysBefore = defaultReminderDays
+	}
+	if prefs.DaysBefore < 1 || prefs.DaysBefore > maxReminderDays {
+		return nil, fmt.Errorf("NotificationService.SavePreferences - %w: days_before must be between 1 and %d", ErrInvalidPreferences, maxReminderDays)
+	}
+
+	saved, err := s.repos.Notification.SavePreferences(ctx, prefs)
+	if err != nil {
+		return nil, fmt.Errorf("NotificationService.SavePreferences - repo error: %v", err)
+	}
+	return saved, nil
+}
+
+// SendDueReminders emails every user about charges within their reminder
+// period that they were not reminded of yet. A reminder that fails to send is
+// retried on the next run; other reminders are sent regardless. It returns
+// the number of emails sent.
+func (s *notificationService) SendDueReminders(ctx context.Context) (int, error) {
+	if s.sender == nil {
+		return 0, nil
+	}
+
+	recipients, err := s.repos.Notification.ListReminderRecipients(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("NotificationService.SendDueReminders - repo error: %v", err)
+	}
+
+	sent := 0
+	for _, prefs := range recipients {
+		renewals, err := s.renewals.ListUpcoming(ctx, prefs.UserID, prefs.DaysBefore)
+		if err != nil {
+			return sent, fmt.Errorf("NotificationService.SendDueReminders - %v", err)
+		}
+
+		for _, r := range renewals {
+			kind := entity.ReminderRenewal
+			if r.TrialEnding {
+				kind = entity.ReminderTrialEnd
+			}
+			if (kind == entity.ReminderRenewal && !prefs.RenewalReminders) ||
+				(kind == entity.ReminderTrialEnd && !prefs.TrialReminders) {
+				continue
+			}
+
+			ok, err := s.remind(ctx, prefs, r, kind)
+			if err != nil {
+				if ctx.Err() != nil {
+					return sent, fmt.Errorf("NotificationService.SendDueReminders - %v", err)
+				}
+				log.Warnf("NotificationService - %s reminder for subscription %s: %v", kind, r.SubscriptionID, err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// remind claims and sends a single reminder, reporting whether it was sent
+// now. The claim is released when sending fails.
+func (s *notificationService) remind(
+	ctx context.Context,
+	prefs entity.NotificationPreferences,
+	r entity.Renewal,
+	kind entity.ReminderKind,
+) (bool, error) {
+	msg, err := s.render(prefs, r)
+	if err != nil {
+		return false, fmt.Errorf("render: %v", err)
+	}
+
+	reminder := entity.Reminder{
+		SubscriptionID: r.SubscriptionID,
+		UserID:         prefs.UserID,
+		Kind:           kind,
+		ChargeDate:     r.ChargeDate,
+		Email:          prefs.Email,
+	}
+	claimed, err := s.repos.Notification.ClaimReminder(ctx, reminder)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	if err := s.sender.Send(ctx, msg); err != nil {
+		if releaseErr := s.repos.Notification.ReleaseReminder(context.WithoutCancel(ctx), reminder); releaseErr != nil {
+			log.Errorf("NotificationService - release reminder for subscription %s: %v", r.SubscriptionID, releaseErr)
+		}
+		return false, fmt.Errorf("send: %v", err)
+	}
+	return true, nil
+}
+
+func (s *notificationService) render(prefs entity.NotificationPreferences, r entity.Renewal) (mailer.Message, error) {
+	locale := prefs.Locale
+	if _, ok := s.templates[locale]; !ok {
+		locale = entity.LocaleRU
+	}
+	tmpl := s.templates[locale]
+	data := reminderData{
+		ServiceName: r.ServiceName,
+		Price:       r.Price,
+		ChargeDate:  r.ChargeDate.Format(reminderDateLayouts[locale]),
+		TrialEnding: r.TrialEnding,
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      prefs.Email,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
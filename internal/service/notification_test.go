@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/mailer"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/mailer/mailtest"
+	"github.com/google/uuid"
+)
+
+// memoryNotifications keeps claimed reminders in memory like the
+// notification_reminders table does.
+type memoryNotifications struct {
+	repo.Notification
+	recipients []entity.NotificationPreferences
+	claimed    map[entity.Reminder]bool
+}
+
+func (m *memoryNotifications) ListReminderRecipients(context.Context) ([]entity.NotificationPreferences, error) {
+	return m.recipients, nil
+}
+
+func (m *memoryNotifications) ClaimReminder(_ context.Context, r entity.Reminder) (bool, error) {
+	if m.claimed[r] {
+		return false, nil
+	}
+	m.claimed[r] = true
+	return true, nil
+}
+
+func (m *memoryNotifications) ReleaseReminder(_ context.Context, r entity.Reminder) error {
+	delete(m.claimed, r)
+	return nil
+}
+
+// fixedRenewals returns the same upcoming charges for every user.
+type fixedRenewals struct {
+	RenewalService
+	renewals []entity.Renewal
+}
+
+func (f fixedRenewals) ListUpcoming(context.Context, uuid.UUID, int) ([]entity.Renewal, error) {
+	return f.renewals, nil
+}
+
+func TestSendDueRemindersThroughSMTP(t *testing.T) {
+	ctx := context.Background()
+	sink := mailtest.NewSink(t)
+
+	userID := uuid.New()
+	notifications := &memoryNotifications{
+		recipients: []entity.NotificationPreferences{{
+			UserID: userID, Email: "anna@example.com", Locale: entity.LocaleEN,
+			RenewalReminders: true, TrialReminders: true, DaysBefore: 3,
+		}},
+		claimed: map[entity.Reminder]bool{},
+	}
+	chargeDate := time.Date(2025, 9, 12, 0, 0, 0, 0, time.UTC)
+	renewals := fixedRenewals{renewals: []entity.Renewal{
+		{SubscriptionID: uuid.New(), UserID: userID, ServiceName: "Netflix", Price: 799, ChargeDate: chargeDate},
+		{SubscriptionID: uuid.New(), UserID: userID, ServiceName: "Kinopoisk", Price: 299, ChargeDate: chargeDate, TrialEnding: true},
+	}}
+	sender := mailer.NewSMTPSender(mailer.Settings{
+		Host: sink.Host, Port: sink.Port, From: "noreply@example.com", Timeout: time.Second,
+	})
+	svc := NewNotificationService(&repo.Repositories{Notification: notifications}, renewals, sender)
+
+	sink.Reject.Store(true)
+	if sent, err := svc.SendDueReminders(ctx); err != nil || sent != 0 {
+		t.Fatalf("SendDueReminders with the server rejecting = %d, %v; want 0, nil", sent, err)
+	}
+	if len(notifications.claimed) != 0 {
+		t.Fatalf("failed reminders stay claimed: %v", notifications.claimed)
+	}
+
+	sink.Reject.Store(false)
+	if sent, err := svc.SendDueReminders(ctx); err != nil || sent != 2 {
+		t.Fatalf("SendDueReminders = %d, %v; want 2, nil", sent, err)
+	}
+	if sent, err := svc.SendDueReminders(ctx); err != nil || sent != 0 {
+		t.Fatalf("second SendDueReminders = %d, %v; want 0, nil", sent, err)
+	}
+
+	mails := sink.Mails()
+	if len(mails) != 2 {
+		t.Fatalf("sink received %d messages, want 2", len(mails))
+	}
+	tests := []struct {
+		subject string
+		text    string
+		html    string
+	}{
+		{"Upcoming Netflix charge", "Your Netflix subscription will be charged 799 RUB on September 12, 2025.", "<b>799&nbsp;RUB</b>"},
+		{"Your Kinopoisk trial is ending", "The first charge of 299 RUB is due on September 12, 2025.", "Your free trial of <b>Kinopoisk</b>"},
+	}
+	for i, tt := range tests {
+		m := mails[i]
+		if len(m.To) != 1 || m.To[0] != "anna@example.com" {
+			t.Errorf("mail %d: RCPT TO %v, want [anna@example.com]", i, m.To)
+		}
+		if m.Subject != tt.subject {
+			t.Errorf("mail %d: subject %q, want %q", i, m.Subject, tt.subject)
+		}
+		if !strings.Contains(m.Text, tt.text) {
+			t.Errorf("mail %d: text body %q does not contain %q", i, m.Text, tt.text)
+		}
+		if !strings.Contains(m.HTML, tt.html) {
+			t.Errorf("mail %d: html body %q does not contain %q", i, m.HTML, tt.html)
+		}
+	}
+}
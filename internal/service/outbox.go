@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outboxBatchSize = 100
+	outboxRetention = 7 * 24 * time.Hour
+	// outboxLease is how long a claimed event is hidden from other relays;
+	// it must exceed the time observers and the publisher take for a batch.
+	outboxLease = 5 * time.Minute
+
+	outboxBaseBackoff = 5 * time.Second
+	outboxMaxBackoff  = 30 * time.Minute
+	// outboxUnavailableDelay is how long events wait while the publisher
+	// cannot reach the broker.
+	outboxUnavailableDelay = 30 * time.Second
+)
+
+type OutboxSettings struct {
+	// MaxAttempts is how often an event is tried before it is dead.
+	MaxAttempts int
+}
+
+type outboxService struct {
+	repos     *repo.Repositories
+	publisher Publisher
+	settings  OutboxSettings
+	observers []SubscriptionObserver
+}
+
+// NewOutboxService creates the relay of outbox events. Every event is handed
+// to the in-process observers and then to publisher, which defaults to a
+// LogPublisher.
+func NewOutboxService(repos *repo.Repositories, publisher Publisher, settings OutboxSettings, observers ...SubscriptionObserver) OutboxService {
+	if publisher == nil {
+		publisher = NewLogPublisher()
+	}
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = 10
+	}
+	return &outboxService{repos: repos, publisher: publisher, settings: settings, observers: observers}
+}
+
+// RelayPending publishes a batch of due events. An event that fails is
+// retried with a backoff and, after MaxAttempts, left in the outbox as dead
+// until RequeueDead. Meanwhile it holds back later events of its subscription
+// only. While the
+// broker is unavailable the rest of the batch is put back without using up
+// attempts, so an outage does not kill events.
+func (s *outboxService) RelayPending(ctx context.Context) (int, error) {
+	events, err := s.repos.Outbox.ClaimDueEvents(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, fmt.Errorf("OutboxService.RelayPending - claim: %v", err)
+	}
+
+	published := 0
+	for i, event := range events {
+		if relayErr := s.relay(ctx, event); relayErr != nil {
+			if errors.Is(relayErr, ErrPublisherUnavailable) {
+				return published, s.postpone(ctx, events[i:], relayErr)
+			}
+			if err := s.recordFailure(ctx, event, relayErr); err != nil {
+				return published, fmt.Errorf("OutboxService.RelayPending - %v", err)
+			}
+			continue
+		}
+		if err := s.repos.Outbox.MarkPublished(ctx, event.ID); err != nil {
+			return published, fmt.Errorf("OutboxService.RelayPending - %v", err)
+		}
+		published++
+	}
+	return published, nil
+}
+
+func (s *outboxService) recordFailure(ctx context.Context, event entity.OutboxEvent, relayErr error) error {
+	attempt := event.Attempts + 1
+	var next *time.Time
+	if attempt < s.settings.MaxAttempts {
+		at := time.Now().UTC().Add(outboxBackoff(attempt))
+		next = &at
+		log.Warnf("OutboxService - relay %s event %s (attempt %d): %v", event.Type, event.ID, attempt, relayErr)
+	} else {
+		log.Errorf("OutboxService - %s event %s is dead after %d attempts: %v", event.Type, event.ID, attempt, relayErr)
+	}
+	return s.repos.Outbox.RecordFailure(ctx, event.ID, relayErr.Error(), next)
+}
+
+// postpone puts events back without counting an attempt.
+func (s *outboxService) postpone(ctx context.Context, events []entity.OutboxEvent, relayErr error) error {
+	ids := make([]uuid.UUID, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	log.Warnf("OutboxService - postponing %d events: %v", len(ids), relayErr)
+	if err := s.repos.Outbox.PostponeEvents(ctx, ids, time.Now().UTC().Add(outboxUnavailableDelay)); err != nil {
+		return fmt.Errorf("OutboxService.RelayPending - %v", err)
+	}
+	return nil
+}
+
+// outboxBackoff doubles the delay with every failed attempt up to
+// outboxMaxBackoff.
+func outboxBackoff(attempt int) time.Duration {
+	delay := float64(outboxBaseBackoff) * math.Pow(2, float64(attempt-1))
+	if delay > float64(outboxMaxBackoff) {
+		delay = float64(outboxMaxBackoff)
+	}
+	return time.Duration(delay)
+}
+
+func (s *outboxService) relay(ctx context.Context, event entity.OutboxEvent) error {
+	if event.AggregateType == entity.AggregateSubscription && len(s.observers) > 0 {
+		var subEvent entity.SubscriptionEvent
+		if err := json.Unmarshal(event.Payload, &subEvent); err != nil {
+			return fmt.Errorf("decode payload: %v", err)
+		}
+		for _, o := range s.observers {
+			if err := o.OnSubscriptionEvent(ctx, subEvent); err != nil {
+				return err
+			}
+		}
+	}
+	return s.publisher.Publish(ctx, event)
+}
+
+func (s *outboxService) PurgePublished(ctx context.Context) (int, error) {
+	deleted, err := s.repos.Outbox.DeletePublishedBefore(ctx, time.Now().Add(-outboxRetention))
+	if err != nil {
+		return 0, fmt.Errorf("OutboxService.PurgePublished - repo error: %v", err)
+	}
+	return deleted, nil
+}
+
+func (s *outboxService) ListDead(ctx context.Context, limit, offset int) ([]entity.DeadOutboxEvent, error) {
+	events, err := s.repos.Outbox.ListDeadEvents(ctx, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("OutboxService.ListDead - repo error: %v", err)
+	}
+	return events, nil
+}
+
+func (s *outboxService) RequeueDead(ctx context.Context, ids []uuid.UUID) (int, error) {
+	requeued, err := s.repos.Outbox.RequeueDeadEvents(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("OutboxService.RequeueDead - repo error: %v", err)
+	}
+	log.Infof("OutboxService - requeued %d dead events", requeued)
+	return requeued, nil
+}
+
+// LogPublisher only logs events. It is used when no message broker is
+// configured.
+type LogPublisher struct{}
+
+func NewLogPublisher() *LogPublisher {
+	return &LogPublisher{}
+}
+
+func (p *LogPublisher) Publish(_ context.Context, event entity.OutboxEvent) error {
+	log.WithFields(log.Fields{
+		"event_id":     event.ID,
+		"event_type":   event.Type,
+		"aggregate_id": event.AggregateID,
+	}).Info("OutboxService - event published")
+	return nil
+}
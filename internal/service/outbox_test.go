@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/google/uuid"
+)
+
+// memoryOutbox hands out its events as due and records what the relay did
+// with them.
+type memoryOutbox struct {
+	repo.Outbox
+	events    []entity.OutboxEvent
+	published []uuid.UUID
+	failures  map[uuid.UUID]*time.Time
+	postponed []uuid.UUID
+}
+
+func (m *memoryOutbox) ClaimDueEvents(context.Context, int, time.Duration) ([]entity.OutboxEvent, error) {
+	return m.events, nil
+}
+
+func (m *memoryOutbox) MarkPublished(_ context.Context, id uuid.UUID) error {
+	m.published = append(m.published, id)
+	return nil
+}
+
+func (m *memoryOutbox) RecordFailure(_ context.Context, id uuid.UUID, _ string, next *time.Time) error {
+	m.failures[id] = next
+	return nil
+}
+
+func (m *memoryOutbox) PostponeEvents(_ context.Context, ids []uuid.UUID, _ time.Time) error {
+	m.postponed = append(m.postponed, ids...)
+	return nil
+}
+
+// failingPublisher fails events listed in fail.
+type failingPublisher struct {
+	fail map[uuid.UUID]bool
+}
+
+func (p failingPublisher) Publish(_ context.Context, event entity.OutboxEvent) error {
+	if p.fail[event.ID] {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func TestRelayPendingRetriesAndDeadLetters(t *testing.T) {
+	retried := entity.OutboxEvent{ID: uuid.New(), Attempts: 0}
+	dying := entity.OutboxEvent{ID: uuid.New(), Attempts: 2}
+	ok := entity.OutboxEvent{ID: uuid.New()}
+	outbox := &memoryOutbox{events: []entity.OutboxEvent{retried, dying, ok}, failures: map[uuid.UUID]*time.Time{}}
+
+	svc := NewOutboxService(&repo.Repositories{Outbox: outbox},
+		failingPublisher{fail: map[uuid.UUID]bool{retried.ID: true, dying.ID: true}},
+		OutboxSettings{MaxAttempts: 3})
+
+	published, err := svc.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if published != 1 || len(outbox.published) != 1 || outbox.published[0] != ok.ID {
+		t.Errorf("published %d %v, want only %s despite the failures before it", published, outbox.published, ok.ID)
+	}
+
+	next, failed := outbox.failures[retried.ID]
+	if !failed || next == nil {
+		t.Fatalf("first failure recorded with next attempt %v, want a retry", next)
+	}
+	if wait := time.Until(*next); wait < outboxBaseBackoff-time.Second || wait > outboxBaseBackoff {
+		t.Errorf("first retry in %v, want %v", wait, outboxBaseBackoff)
+	}
+	if next, failed := outbox.failures[dying.ID]; !failed || next != nil {
+		t.Errorf("last failure recorded with next attempt %v, want the event dead", next)
+	}
+}
+
+// downPublisher cannot reach its broker.
+type downPublisher struct{}
+
+func (downPublisher) Publish(context.Context, entity.OutboxEvent) error {
+	return fmt.Errorf("connect: %w", ErrPublisherUnavailable)
+}
+
+func TestRelayPendingPostponesWhileUnavailable(t *testing.T) {
+	first, second := entity.OutboxEvent{ID: uuid.New(), Attempts: 9}, entity.OutboxEvent{ID: uuid.New()}
+	outbox := &memoryOutbox{events: []entity.OutboxEvent{first, second}, failures: map[uuid.UUID]*time.Time{}}
+	svc := NewOutboxService(&repo.Repositories{Outbox: outbox}, downPublisher{}, OutboxSettings{MaxAttempts: 10})
+
+	published, err := svc.RelayPending(context.Background())
+	if err != nil || published != 0 {
+		t.Fatalf("RelayPending = %d, %v; want 0, nil", published, err)
+	}
+	if len(outbox.failures) != 0 {
+		t.Errorf("outage recorded as failed attempts: %v", outbox.failures)
+	}
+	if len(outbox.postponed) != 2 || outbox.postponed[0] != first.ID || outbox.postponed[1] != second.ID {
+		t.Errorf("postponed %v, want the whole batch", outbox.postponed)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	if got := outboxBackoff(1); got != outboxBaseBackoff {
+		t.Errorf("outboxBackoff(1) = %v, want %v", got, outboxBaseBackoff)
+	}
+	if got := outboxBackoff(3); got != 4*outboxBaseBackoff {
+		t.Errorf("outboxBackoff(3) = %v, want %v", got, 4*outboxBaseBackoff)
+	}
+	if got := outboxBackoff(100); got != outboxMaxBackoff {
+		t.Errorf("outboxBackoff(100) = %v, want %v", got, outboxMaxBackoff)
+	}
+}
+
+// TestClaimDueEventsKeepsSubscriptionOrder runs against PostgreSQL: a failing
+// or dead event holds back later events of its subscription but not of
+// others until it is requeued and published, and claimed events are leased
+// away from a second relay.
+func TestClaimDueEventsKeepsSubscriptionOrder(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+	outbox := repo.NewRepositories(pool).Outbox
+
+	first, second, other := uuid.New(), uuid.New(), uuid.New()
+	subID, otherSubID, userID := uuid.New(), uuid.New(), uuid.New()
+	created := time.Now().Add(-time.Minute)
+	for i, e := range []struct{ id, aggregate uuid.UUID }{{first, subID}, {second, subID}, {other, otherSubID}} {
+		_, err := pool.Exec(ctx, `
+			INSERT INTO outbox_events (id, aggregate_type, aggregate_id, user_id, event_type, payload, created_at)
+			VALUES ($1, 'subscription', $2, $3, 'subscription.updated', '{}', $4)`,
+			e.id, e.aggregate, userID, created.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("insert event: %v", err)
+		}
+	}
+
+	claimed, err := outbox.ClaimDueEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDueEvents: %v", err)
+	}
+	if len(claimed) != 2 || claimed[0].ID != first || claimed[1].ID != other {
+		t.Fatalf("claimed %v, want the first event of each subscription", eventIDs(claimed))
+	}
+	if again, _ := outbox.ClaimDueEvents(ctx, 10, time.Minute); len(again) != 0 {
+		t.Fatalf("leased events claimed again: %v", eventIDs(again))
+	}
+
+	if err := outbox.RecordFailure(ctx, first, "broker unavailable", nil); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if claimed, _ = outbox.ClaimDueEvents(ctx, 10, time.Minute); len(claimed) != 0 {
+		t.Fatalf("claimed %v after the first event died, want its subscription held back", eventIDs(claimed))
+	}
+
+	dead, err := outbox.ListDeadEvents(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("ListDeadEvents: %v", err)
+	}
+	if len(dead) != 1 || dead[0].ID != first || dead[0].Attempts != 1 || dead[0].LastError != "broker unavailable" {
+		t.Fatalf("dead events %+v, want the first one with its attempt and error", dead)
+	}
+
+	if n, err := outbox.RequeueDeadEvents(ctx, nil); err != nil || n != 1 {
+		t.Fatalf("RequeueDeadEvents = %d, %v; want 1, nil", n, err)
+	}
+	claimed, err = outbox.ClaimDueEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDueEvents: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != first || claimed[0].Attempts != 0 {
+		t.Fatalf("claimed %v after the requeue, want %s with fresh attempts", eventIDs(claimed), first)
+	}
+
+	// An outage postpones the event without using up an attempt.
+	if err := outbox.PostponeEvents(ctx, []uuid.UUID{first}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("PostponeEvents: %v", err)
+	}
+	claimed, _ = outbox.ClaimDueEvents(ctx, 10, time.Minute)
+	if len(claimed) != 1 || claimed[0].ID != first || claimed[0].Attempts != 0 {
+		t.Fatalf("claimed %v after the postpone, want %s without an attempt", eventIDs(claimed), first)
+	}
+
+	if err := outbox.MarkPublished(ctx, first); err != nil {
+		t.Fatalf("MarkPublished: %v", err)
+	}
+	claimed, _ = outbox.ClaimDueEvents(ctx, 10, time.Minute)
+	if len(claimed) != 1 || claimed[0].ID != second {
+		t.Fatalf("claimed %v once the first event was published, want %s", eventIDs(claimed), second)
+	}
+}
+
+func eventIDs(events []entity.OutboxEvent) []uuid.UUID {
+	ids := make([]uuid.UUID, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
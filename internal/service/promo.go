@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+)
+
+type promoCodeService struct {
+	repos *repo.Repositories
+}
+
+func NewPromoCodeService(repos *repo.Repositories) PromoCodeService {
+	return &promoCodeService{repos: repos}
+}
+
+func (s *promoCodeService) CreatePromoCode(ctx context.Context, promo entity.PromoCode) (*entity.PromoCode, error) {
+	promo.Code = strings.TrimSpace(promo.Code)
+	if promo.Code == "" {
+		return nil, fmt.Errorf("PromoCodeService.CreatePromoCode - %w: empty code", ErrInvalidDiscount)
+	}
+	if err := validateDiscount(entity.Discount{Type: promo.Type, Value: promo.Value, Months: promo.Months}); err != nil {
+		return nil, fmt.Errorf("PromoCodeService.CreatePromoCode - %w", err)
+	}
+
+	created, err := s.repos.PromoCode.CreatePromoCode(ctx, promo)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrAlreadyExists) {
+			return nil, fmt.Errorf("PromoCodeService.CreatePromoCode - %w", err)
+		}
+		return nil, fmt.Errorf("PromoCodeService.CreatePromoCode - repo error: %v", err)
+	}
+	return created, nil
+}
+
+func (s *promoCodeService) ListPromoCodes(ctx context.Context) ([]entity.PromoCode, error) {
+	promos, err := s.repos.PromoCode.ListPromoCodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("PromoCodeService.ListPromoCodes - repo error: %v", err)
+	}
+	return promos, nil
+}
+
+func validateDiscount(d entity.Discount) error {
+	switch d.Type {
+	case entity.DiscountPercent:
+		if d.Value <= 0 || d.Value > 100 {
+			return fmt.Errorf("%w: percent must be between 1 and 100", ErrInvalidDiscount)
+		}
+	case entity.DiscountFixed:
+		if d.Value <= 0 {
+			return fmt.Errorf("%w: amount must be positive", ErrInvalidDiscount)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidDiscount, d.Type)
+	}
+	if d.Months != nil && *d.Months <= 0 {
+		return fmt.Errorf("%w: months must be positive", ErrInvalidDiscount)
+	}
+	return nil
+}
+
+// redeemPromoCode returns the discount of a promo code that is valid on day.
+func redeemPromoCode(ctx context.Context, repos *repo.Repositories, code string, day time.Time) (*entity.Discount, error) {
+	promo, err := repos.PromoCode.GetPromoCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPromoCode, code)
+		}
+		return nil, fmt.Errorf("get promo code: %v", err)
+	}
+	if promo.ValidUntil != nil && promo.ValidUntil.Before(dayStart(day)) {
+		return nil, fmt.Errorf("%w: %s expired", ErrInvalidPromoCode, code)
+	}
+
+	discount := promo.Discount()
+	return &discount, nil
+}
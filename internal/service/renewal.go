@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/google/uuid"
+)
+
+const (
+	// billingPeriodMonths is the billing cadence of every subscription: service
+	// prices are monthly and CalculateTotalCost charges them once a month.
+	billingPeriodMonths = 1
+
+	// calendarHorizonDays is how far ahead the iCalendar feed lists charges.
+	calendarHorizonDays = 365
+
+	calendarTokenBytes = 32
+)
+
+type renewalService struct {
+	repos *repo.Repositories
+}
+
+func NewRenewalService(repos *repo.Repositories) RenewalService {
+	return &renewalService{repos: repos}
+}
+
+func (s *renewalService) ListUpcoming(ctx context.Context, userID uuid.UUID, days int) ([]entity.Renewal, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("RenewalService.ListUpcoming - days must be positive")
+	}
+
+	renewals, err := s.upcoming(ctx, userID, days)
+	if err != nil {
+		return nil, fmt.Errorf("RenewalService.ListUpcoming - %v", err)
+	}
+	return renewals, nil
+}
+
+func (s *renewalService) IssueCalendarToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	buf := make([]byte, calendarTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("RenewalService.IssueCalendarToken - generate token: %v", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := s.repos.CalendarFeed.SaveToken(ctx, userID, token); err != nil {
+		return "", fmt.Errorf("RenewalService.IssueCalendarToken - repo error: %v", err)
+	}
+	return token, nil
+}
+
+func (s *renewalService) CalendarRenewals(ctx context.Context, token string) ([]entity.Renewal, error) {
+	userID, err := s.repos.CalendarFeed.GetUserIDByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, fmt.Errorf("RenewalService.CalendarRenewals - %w", err)
+		}
+		return nil, fmt.Errorf("RenewalService.CalendarRenewals - repo error: %v", err)
+	}
+
+	renewals, err := s.upcoming(ctx, userID, calendarHorizonDays)
+	if err != nil {
+		return nil, fmt.Errorf("RenewalService.CalendarRenewals - %v", err)
+	}
+	return renewals, nil
+}
+
+// upcoming lists charges of the user from today through today+days, ordered by date.
+func (s *renewalService) upcoming(ctx context.Context, userID uuid.UUID, days int) ([]entity.Renewal, error) {
+	from := dayStart(time.Now().UTC())
+	to := from.AddDate(0, 0, days)
+
+	subs, err := s.repos.Subscription.ListActiveSubscriptions(ctx, userID, from)
+	if err != nil {
+		return nil, fmt.Errorf("repo error: %v", err)
+	}
+
+	var renewals []entity.Renewal
+	for _, sub := range subs {
+		for _, date := range chargeDates(sub, from, to) {
+			// Free trial months are not charged at all.
+			price := sub.NetPriceIn(monthStart(date))
+			if price == 0 {
+				continue
+			}
+			renewals = append(renewals, entity.Renewal{
+				SubscriptionID: sub.ID,
+				UserID:         sub.UserID,
+				ServiceName:    sub.Service.Name,
+				Price:          price,
+				ChargeDate:     date,
+				TrialEnding:    sub.TrialEnd != nil && monthStart(date).Equal(monthStart(*sub.TrialEnd)),
+			})
+		}
+	}
+
+	sort.SliceStable(renewals, func(i, j int) bool {
+		return renewals[i].ChargeDate.Before(renewals[j].ChargeDate)
+	})
+	return renewals, nil
+}
+
+// chargeDates returns the charge dates of sub that fall within [from, to].
+// Charges recur every billing period on the day of month of the start date,
+// clamped to the last day of shorter months, and stop after the end month.
+func chargeDates(sub entity.Subscription, from, to time.Time) []time.Time {
+	start := dayStart(sub.StartDate)
+
+	periods := 0
+	if start.Before(from) {
+		months := (from.Year()-start.Year())*12 + int(from.Month()-start.Month())
+		periods = (months/billingPeriodMonths - 1) * billingPeriodMonths
+		if periods < 0 {
+			periods = 0
+		}
+	}
+
+	var dates []time.Time
+	for ; ; periods += billingPeriodMonths {
+		date := addMonthsClamped(start, periods)
+		if date.After(to) {
+			break
+		}
+		if sub.EndDate != nil && monthStart(date).After(monthStart(*sub.EndDate)) {
+			break
+		}
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// addMonthsClamped adds months to t, keeping its day of month unless the
+// target month is shorter (January 31 + 1 month is the last day of February).
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -5,15 +5,34 @@ import (
 	"time"
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
 	"github.com/google/uuid"
 )
 
+// SubscriptionObserver is notified by the outbox relay after a subscription
+// change is committed. An error makes the relay retry the event later, so
+// observers must tolerate receiving an event more than once.
+type SubscriptionObserver interface {
+	OnSubscriptionEvent(ctx context.Context, event entity.SubscriptionEvent) error
+}
+
+// Publisher hands outbox events to a message broker or another external
+// consumer. Events may be published more than once, consumers deduplicate by
+// event ID. Publish wraps ErrPublisherUnavailable when the broker cannot be
+// reached, which does not count as a failed attempt of the event.
+type Publisher interface {
+	Publish(ctx context.Context, event entity.OutboxEvent) error
+}
+
 //go:generate mockgen -source=service.go -destination=mocks/service.go -package=mocks
 type SubscriptionService interface {
 	CreateSubscription(
 		ctx context.Context,
 		sub entity.Subscription,
 	) (*entity.Subscription, error)
+	// ValidateSubscription checks a new subscription against the rules
+	// CreateSubscription applies without creating it.
+	ValidateSubscription(ctx context.Context, sub entity.Subscription) error
 
 	GetSubscriptionByID(ctx context.Context, id uuid.UUID) (*entity.Subscription, error)
 	UpdateSubscription(
@@ -22,11 +41,318 @@ type SubscriptionService interface {
 		sub entity.Subscription,
 	) error
 	DeleteSubscription(ctx context.Context, id uuid.UUID) error
-	ListSubscriptionsByUser(ctx context.Context, userID uuid.UUID, page int, limit int) ([]entity.Subscription, int, error)
+	PauseSubscription(ctx context.Context, id uuid.UUID) error
+	ResumeSubscription(ctx context.Context, id uuid.UUID) error
+	CancelSubscription(ctx context.Context, id uuid.UUID) error
+	// ExpireEnded activates subscriptions whose trial has ended and expires
+	// those whose end date has passed, extending those with auto_renew
+	// instead, and returns how many were changed.
+	ExpireEnded(ctx context.Context) (int, error)
+	// ListSubscriptionsByUser returns a page of the user's subscriptions. The
+	// total is counted in the same statement as the page unless withTotal is
+	// false.
+	ListSubscriptionsByUser(
+		ctx context.Context,
+		filter entity.SubscriptionFilter,
+		sort entity.SubscriptionSort,
+		page int,
+		limit int,
+		withTotal bool,
+	) (entity.SubscriptionList, error)
+	// ListAllSubscriptions lists subscriptions of all users for support staff.
+	// filter.UserID is ignored.
+	ListAllSubscriptions(
+		ctx context.Context,
+		filter entity.SubscriptionFilter,
+		sort entity.SubscriptionSort,
+		page int,
+		limit int,
+		withTotal bool,
+	) (entity.SubscriptionList, error)
+	ListSubscriptionsByCursor(
+		ctx context.Context,
+		filter entity.SubscriptionFilter,
+		cursor *entity.SubscriptionCursor,
+		limit int,
+	) (entity.SubscriptionPage, error)
+	// CreateSubscriptions, UpdateSubscriptions and DeleteSubscriptions apply
+	// a batch of changes and return the outcome of every item in order. In
+	// atomic mode items that were not applied because another one failed
+	// report ErrBatchAborted.
+	CreateSubscriptions(ctx context.Context, subs []entity.Subscription, mode entity.BatchMode) ([]entity.BatchItemResult, error)
+	UpdateSubscriptions(ctx context.Context, subs []entity.Subscription, mode entity.BatchMode) ([]entity.BatchItemResult, error)
+	DeleteSubscriptions(ctx context.Context, ids []uuid.UUID, mode entity.BatchMode) ([]entity.BatchItemResult, error)
+	// SearchSubscriptions finds subscriptions by a misspelled service name or
+	// words of their notes, closest matches first.
+	SearchSubscriptions(
+		ctx context.Context,
+		search entity.SubscriptionSearch,
+		offset int,
+		limit int,
+	) ([]entity.SubscriptionMatch, error)
 	CalculateTotalCost(
 		ctx context.Context,
 		userID *uuid.UUID,
 		serviceName *string,
 		startDate, endDate time.Time,
-	) (int, error)
+	) (entity.CostSummary, error)
+}
+
+type AnalyticsService interface {
+	GetMonthlyMRR(ctx context.Context, startDate, endDate time.Time) ([]entity.MonthlyMRR, error)
+	GetRetentionCohorts(
+		ctx context.Context,
+		serviceName *string,
+		startDate, endDate time.Time,
+	) ([]entity.RetentionCohort, error)
+	GetTopServices(
+		ctx context.Context,
+		orderBy entity.ServiceRankingMetric,
+		startDate, endDate time.Time,
+		offset, limit int,
+	) ([]entity.ServiceRanking, int, error)
+	GetTopUsers(
+		ctx context.Context,
+		startDate, endDate time.Time,
+		offset, limit int,
+	) ([]entity.UserSpend, int, error)
+}
+
+type SnapshotService interface {
+	// RefreshStaleMonths rebuilds snapshots of closed months that are missing
+	// or were invalidated and returns how many months were refreshed.
+	RefreshStaleMonths(ctx context.Context) (int, error)
+}
+
+type ExportService interface {
+	// ExportSubscriptions streams subscriptions of the user, or of all users
+	// when userID is nil, to fn in creation order.
+	ExportSubscriptions(ctx context.Context, userID *uuid.UUID, fn func(entity.Subscription) error) error
+	ExportCostBreakdown(
+		ctx context.Context,
+		userID *uuid.UUID,
+		serviceName *string,
+		startDate, endDate time.Time,
+		fn func(entity.CostBreakdownItem) error,
+	) error
+}
+
+type RenewalService interface {
+	// ListUpcoming returns charges of active subscriptions of the user due
+	// within the next days days, ordered by charge date.
+	ListUpcoming(ctx context.Context, userID uuid.UUID, days int) ([]entity.Renewal, error)
+	// IssueCalendarToken creates a new secret token for the user's iCalendar
+	// feed, invalidating the previous one.
+	IssueCalendarToken(ctx context.Context, userID uuid.UUID) (string, error)
+	CalendarRenewals(ctx context.Context, token string) ([]entity.Renewal, error)
+}
+
+type PromoCodeService interface {
+	CreatePromoCode(ctx context.Context, promo entity.PromoCode) (*entity.PromoCode, error)
+	ListPromoCodes(ctx context.Context) ([]entity.PromoCode, error)
+}
+
+type BudgetService interface {
+	SubscriptionObserver
+	CreateBudget(ctx context.Context, budget entity.Budget) (*entity.Budget, error)
+	ListBudgets(ctx context.Context, userID uuid.UUID) ([]entity.Budget, error)
+	UpdateBudget(ctx context.Context, id uuid.UUID, amount int) (*entity.Budget, error)
+	DeleteBudget(ctx context.Context, id uuid.UUID) error
+	ListAlerts(ctx context.Context, userID uuid.UUID, offset, limit int) ([]entity.BudgetAlert, error)
+	EvaluateUser(ctx context.Context, userID uuid.UUID) ([]entity.BudgetAlert, error)
+	EvaluateAll(ctx context.Context) (int, error)
+}
+
+type WebhookService interface {
+	SubscriptionObserver
+	CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (*entity.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, userID uuid.UUID) ([]entity.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	ListDeliveries(
+		ctx context.Context,
+		endpointID uuid.UUID,
+		status *entity.DeliveryStatus,
+		offset, limit int,
+	) ([]entity.WebhookDelivery, int, error)
+	RetryDelivery(ctx context.Context, endpointID, deliveryID uuid.UUID) error
+	EnqueueRenewalsDue(ctx context.Context) (int, error)
+	DeliverDue(ctx context.Context) (int, error)
+}
+
+type OutboxService interface {
+	// RelayPending publishes a batch of due events and returns how many
+	// were published.
+	RelayPending(ctx context.Context) (int, error)
+	// PurgePublished deletes events published longer ago than the retention.
+	PurgePublished(ctx context.Context) (int, error)
+	ListDead(ctx context.Context, limit, offset int) ([]entity.DeadOutboxEvent, error)
+	// RequeueDead retries dead events, all of them when ids is empty, and
+	// returns how many were requeued.
+	RequeueDead(ctx context.Context, ids []uuid.UUID) (int, error)
+}
+
+type EventStreamService interface {
+	// Subscribe streams events of the user: those written after lastEventID
+	// when it is given, then new ones. The channel is closed when ctx is done
+	// or the stream falls behind, the client then resumes from its last event.
+	Subscribe(ctx context.Context, userID uuid.UUID, lastEventID *uuid.UUID) (<-chan entity.OutboxEvent, error)
+	// Listen receives notifications about new events until ctx is done or
+	// the connection fails.
+	Listen(ctx context.Context) error
+}
+
+type NotificationService interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*entity.NotificationPreferences, error)
+	SavePreferences(ctx context.Context, prefs entity.NotificationPreferences) (*entity.NotificationPreferences, error)
+	// SendDueReminders emails reminders about upcoming charges and trial
+	// ends and returns how many were sent.
+	SendDueReminders(ctx context.Context) (int, error)
+}
+
+type JobService interface {
+	// ListJobs returns the registered jobs with their next and last runs.
+	ListJobs(ctx context.Context) ([]entity.Job, error)
+	ListRuns(ctx context.Context, name string, offset, limit int) ([]entity.JobRun, error)
+	// TriggerJob starts the job in the background and returns its run.
+	TriggerJob(ctx context.Context, name string) (*entity.JobRun, error)
+	// RunScheduled runs the job for a cron slot unless another instance
+	// runs or already ran it, and reports whether it ran.
+	RunScheduled(ctx context.Context, name string, slot time.Time) (bool, error)
+	// NextRun returns the first cron slot of the job after the given time.
+	NextRun(name string, after time.Time) (time.Time, error)
+	JobNames() []string
+	// Shutdown cancels manually triggered runs and waits for them to finish.
+	Shutdown()
+}
+
+type ImportService interface {
+	// CheckImport validates the rows like StartImport does, without creating
+	// anything, and returns the report.
+	CheckImport(ctx context.Context, rows []entity.ImportRow) entity.Import
+	// StartImport records an import of the rows, skipping the invalid ones,
+	// and creates the valid subscriptions in the background.
+	StartImport(ctx context.Context, rows []entity.ImportRow) (*entity.Import, error)
+	GetImport(ctx context.Context, id uuid.UUID) (*entity.Import, error)
+	// FailStaleImports fails running imports that stopped sending heartbeats
+	// and returns how many there were.
+	FailStaleImports(ctx context.Context) (int, error)
+	// Shutdown cancels running imports and waits for them to stop.
+	Shutdown()
+}
+
+type UserDataService interface {
+	// ExportUserData returns everything stored about the user.
+	ExportUserData(ctx context.Context, userID uuid.UUID) (*entity.UserData, error)
+	// EraseUserData deletes everything stored about the user in one
+	// transaction and returns the tombstone recorded for the erasure.
+	EraseUserData(ctx context.Context, userID uuid.UUID, reference string) (*entity.UserErasure, error)
+}
+
+type Services struct {
+	Subscription SubscriptionService
+	Analytics    AnalyticsService
+	Snapshot     SnapshotService
+	Export       ExportService
+	Renewal      RenewalService
+	PromoCode    PromoCodeService
+	Budget       BudgetService
+	Webhook      WebhookService
+	Outbox       OutboxService
+	EventStream  EventStreamService
+	Notification NotificationService
+	Job          JobService
+	Import       ImportService
+	UserData     UserDataService
+}
+
+type ServicesDependencies struct {
+	Repos     *repo.Repositories
+	Webhook   WebhookSettings
+	Outbox    OutboxSettings
+	Publisher Publisher
+	// Mailer sends reminder emails, reminders are disabled when it is nil.
+	Mailer MailSender
+	// JobSchedules overrides default cron expressions of jobs by name.
+	JobSchedules map[string]string
+	// OverlapPolicy applies to subscriptions that overlap another one of the
+	// same user and service.
+	OverlapPolicy entity.OverlapPolicy
+}
+
+func NewServices(deps ServicesDependencies) (*Services, error) {
+	repos := deps.Repos
+
+	subscription := NewSubscriptionService(repos, deps.OverlapPolicy)
+	snapshot := NewSnapshotService(repos)
+	budget := NewBudgetService(repos, subscription)
+	renewal := NewRenewalService(repos)
+	webhook := NewWebhookService(repos, renewal, deps.Webhook)
+	outbox := NewOutboxService(repos, deps.Publisher, deps.Outbox, budget, webhook)
+	notification := NewNotificationService(repos, renewal, deps.Mailer)
+	imports := NewImportService(repos, subscription)
+
+	jobs, err := NewJobService(repos, deps.JobSchedules,
+		JobDefinition{
+			Name:        "subscription_expiry",
+			Description: "Activates ended trials, expires ended subscriptions and renews those with auto_renew",
+			Schedule:    "5 0 * * *",
+			Run:         subscription.ExpireEnded,
+		},
+		JobDefinition{
+			Name:        "snapshot_refresh",
+			Description: "Rebuilds missing or invalidated monthly cost snapshots",
+			Schedule:    "0 * * * *",
+			Run:         snapshot.RefreshStaleMonths,
+		},
+		JobDefinition{
+			Name:        "budget_evaluation",
+			Description: "Checks budgets of all users for the current month",
+			Schedule:    "0 6 * * *",
+			Run:         budget.EvaluateAll,
+		},
+		JobDefinition{
+			Name:        "renewal_notifications",
+			Description: "Queues renewal_due webhooks for upcoming charges",
+			Schedule:    "15 * * * *",
+			Run:         webhook.EnqueueRenewalsDue,
+		},
+		JobDefinition{
+			Name:        "email_reminders",
+			Description: "Emails reminders about upcoming charges and trial ends",
+			Schedule:    "0 9 * * *",
+			Run:         notification.SendDueReminders,
+		},
+		JobDefinition{
+			Name:        "outbox_purge",
+			Description: "Deletes published outbox events past the retention",
+			Schedule:    "30 3 * * *",
+			Run:         outbox.PurgePublished,
+		},
+		JobDefinition{
+			Name:        "import_recovery",
+			Description: "Fails imports left running by a stopped instance",
+			Schedule:    "*/5 * * * *",
+			Run:         imports.FailStaleImports,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Services{
+		Subscription: subscription,
+		Analytics:    NewAnalyticsService(repos),
+		Snapshot:     snapshot,
+		Export:       NewExportService(repos),
+		Renewal:      renewal,
+		PromoCode:    NewPromoCodeService(repos),
+		Budget:       budget,
+		Webhook:      webhook,
+		Outbox:       outbox,
+		EventStream:  NewEventStreamService(repos),
+		Notification: notification,
+		Job:          jobs,
+		Import:       imports,
+		UserData:     NewUserDataService(repos),
+	}, nil
 }
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+)
+
+// snapshotBatchSize bounds how many months a single refresh run rebuilds, so
+// the first run on a large history does not hold the refresher for long.
+const snapshotBatchSize = 24
+
+type snapshotService struct {
+	repos *repo.Repositories
+}
+
+func NewSnapshotService(repos *repo.Repositories) SnapshotService {
+	return &snapshotService{repos: repos}
+}
+
+func (s *snapshotService) RefreshStaleMonths(ctx context.Context) (int, error) {
+	lastClosed := monthStart(time.Now().UTC()).AddDate(0, -1, 0)
+
+	months, err := s.repos.Snapshot.ListStaleMonths(ctx, lastClosed, snapshotBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("SnapshotService.RefreshStaleMonths - repo error: %v", err)
+	}
+
+	for i, month := range months {
+		if err := s.repos.Snapshot.RefreshMonth(ctx, month); err != nil {
+			return i, fmt.Errorf("SnapshotService.RefreshStaleMonths - refresh %s: %v", monthKey(month), err)
+		}
+	}
+
+	return len(months), nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// streamBufferSize is how many live events a subscriber may lag behind
+	// before it is dropped.
+	streamBufferSize = 64
+	// streamReplayLimit caps the events replayed on resume. A client that
+	// missed more gets them over several reconnects.
+	streamReplayLimit = 500
+)
+
+type streamSubscriber struct {
+	events chan entity.OutboxEvent
+}
+
+// eventStreamService fans out outbox notifications received over
+// LISTEN/NOTIFY to the streams of this instance, so a change made through any
+// replica reaches every connected client.
+type eventStreamService struct {
+	repos *repo.Repositories
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[*streamSubscriber]struct{}
+}
+
+func NewEventStreamService(repos *repo.Repositories) EventStreamService {
+	return &eventStreamService{
+		repos:       repos,
+		subscribers: make(map[uuid.UUID]map[*streamSubscriber]struct{}),
+	}
+}
+
+func (s *eventStreamService) Subscribe(ctx context.Context, userID uuid.UUID, lastEventID *uuid.UUID) (<-chan entity.OutboxEvent, error) {
+	// Register before reading the backlog, so an event committed in between
+	// is received live; events seen in both are sent once.
+	sub := s.add(userID)
+
+	var replay []entity.OutboxEvent
+	if lastEventID != nil {
+		var err error
+		replay, err = s.repos.Outbox.ListUserEventsAfter(ctx, userID, *lastEventID, streamReplayLimit)
+		if err != nil {
+			s.remove(userID, sub)
+			return nil, fmt.Errorf("EventStreamService.Subscribe - repo error: %v", err)
+		}
+	}
+
+	out := make(chan entity.OutboxEvent)
+	go func() {
+		defer close(out)
+		defer s.remove(userID, sub)
+
+		seen := make(map[uuid.UUID]struct{}, len(replay))
+		for _, e := range replay {
+			seen[e.ID] = struct{}{}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		// Live events would leave a gap after a truncated replay, the client
+		// resumes from the last replayed event instead.
+		if len(replay) == streamReplayLimit {
+			return
+		}
+
+		for {
+			select {
+			case e, ok := <-sub.events:
+				if !ok {
+					return
+				}
+				if _, ok := seen[e.ID]; ok {
+					continue
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Listen dispatches notifications until ctx is done or the connection fails.
+// Notifications sent while nobody listens are lost, so all streams are closed
+// when it returns and clients resume from their last event.
+func (s *eventStreamService) Listen(ctx context.Context) error {
+	err := s.repos.Outbox.ListenEvents(ctx, func(n entity.OutboxNotification) {
+		s.dispatch(ctx, n)
+	})
+	s.removeAll()
+	if err != nil {
+		return fmt.Errorf("EventStreamService.Listen - %v", err)
+	}
+	return nil
+}
+
+func (s *eventStreamService) dispatch(ctx context.Context, n entity.OutboxNotification) {
+	s.mu.Lock()
+	listeners := len(s.subscribers[n.UserID])
+	s.mu.Unlock()
+	if listeners == 0 {
+		return
+	}
+
+	event, err := s.repos.Outbox.GetEvent(ctx, n.EventID)
+	if err != nil {
+		log.Errorf("EventStreamService - load event %s: %v", n.EventID, err)
+		s.removeUser(n.UserID)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers[n.UserID] {
+		select {
+		case sub.events <- event:
+		default:
+			// A stalled client must not hold up the others.
+			s.removeLocked(n.UserID, sub)
+		}
+	}
+}
+
+func (s *eventStreamService) add(userID uuid.UUID) *streamSubscriber {
+	sub := &streamSubscriber{events: make(chan entity.OutboxEvent, streamBufferSize)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[*streamSubscriber]struct{})
+	}
+	s.subscribers[userID][sub] = struct{}{}
+	return sub
+}
+
+func (s *eventStreamService) remove(userID uuid.UUID, sub *streamSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(userID, sub)
+}
+
+func (s *eventStreamService) removeUser(userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers[userID] {
+		s.removeLocked(userID, sub)
+	}
+}
+
+func (s *eventStreamService) removeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for userID, subs := range s.subscribers {
+		for sub := range subs {
+			s.removeLocked(userID, sub)
+		}
+	}
+}
+
+// removeLocked closes the events of sub once, s.mu must be held.
+func (s *eventStreamService) removeLocked(userID uuid.UUID, sub *streamSubscriber) {
+	subs := s.subscribers[userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.events)
+	if len(subs) == 0 {
+		delete(s.subscribers, userID)
+	}
+}
@@ -4,48 +4,155 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
 	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 )
 
 type subscriptionService struct {
-	repos *repo.Repositories
+	repos         *repo.Repositories
+	overlapPolicy entity.OverlapPolicy
 }
 
-func NewSubscriptionService(repos *repo.Repositories) SubscriptionService {
-	return &subscriptionService{repos: repos}
+// NewSubscriptionService creates the subscription service. Events about
+// changes are written to the outbox by the repository and published by the
+// outbox relay. overlapPolicy applies to subscriptions that overlap another
+// one of the same user and service; an empty policy rejects them.
+func NewSubscriptionService(repos *repo.Repositories, overlapPolicy entity.OverlapPolicy) SubscriptionService {
+	if overlapPolicy == "" {
+		overlapPolicy = entity.OverlapReject
+	}
+	return &subscriptionService{repos: repos, overlapPolicy: overlapPolicy}
+}
+
+// ParseOverlapPolicy validates an overlap policy from configuration, an
+// empty value selects OverlapReject.
+func ParseOverlapPolicy(raw string) (entity.OverlapPolicy, error) {
+	switch policy := entity.OverlapPolicy(raw); policy {
+	case "":
+		return entity.OverlapReject, nil
+	case entity.OverlapReject, entity.OverlapWarn, entity.OverlapAllow:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overlap policy %q", raw)
+	}
+}
+
+// warnOverlaps logs the subscriptions sub was saved overlapping.
+func warnOverlaps(op string, sub entity.Subscription) {
+	if len(sub.Overlaps) == 0 {
+		return
+	}
+	log.Warnf("SubscriptionService.%s - subscription %s overlaps %v", op, sub.ID, sub.Overlaps)
 }
 
 func (s *subscriptionService) CreateSubscription(
 	ctx context.Context,
 	sub entity.Subscription,
 ) (*entity.Subscription, error) {
+	sub, err := s.prepareSubscription(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionService.CreateSubscription - %w", err)
+	}
+
+	sub.OverlapPolicy = s.overlapPolicy
+	createdSub, err := s.repos.Subscription.CreateSubscription(ctx, sub)
+	if err != nil {
+		if errors.Is(err, repoerrs.ErrAlreadyExists) || errors.Is(err, repoerrs.ErrOverlap) {
+			return nil, fmt.Errorf("SubscriptionService.CreateSubscription - %w", err)
+		}
+		return nil, fmt.Errorf("SubscriptionService.CreateSubscription - repo error: %v", err)
+	}
+
+	warnOverlaps("CreateSubscription", *createdSub)
+	return createdSub, nil
+}
+
+// ValidateSubscription returns the error of the rule the subscription
+// breaks, as CreateSubscriptions reports it for a batch item.
+func (s *subscriptionService) ValidateSubscription(ctx context.Context, sub entity.Subscription) error {
+	_, err := s.prepareSubscription(ctx, sub)
+	return err
+}
+
+// prepareSubscription validates a new subscription and fills in its start
+// date, status and discount.
+func (s *subscriptionService) prepareSubscription(ctx context.Context, sub entity.Subscription) (entity.Subscription, error) {
 	if sub.Service.Name == "" {
-		return nil, fmt.Errorf("SubscriptionService.CreateSubscription - empty service name")
+		return sub, errors.New("empty service name")
 	}
 	if sub.Service.Price <= 0 {
-		return nil, fmt.Errorf("SubscriptionService.CreateSubscription - price must be positive")
+		return sub, errors.New("price must be positive")
 	}
 	if sub.StartDate.IsZero() {
 		sub.StartDate = time.Now().UTC()
 	}
+	if sub.TrialEnd != nil && !sub.TrialEnd.After(sub.StartDate) {
+		return sub, fmt.Errorf("%w: trial must end after start date", ErrInvalidTrial)
+	}
+	if sub.Discount != nil {
+		discount, err := s.resolveDiscount(ctx, *sub.Discount)
+		if err != nil {
+			return sub, err
+		}
+		sub.Discount = discount
+	}
+	switch sub.Status {
+	case "":
+		sub.Status = entity.StatusActive
+		if sub.TrialEnd != nil && sub.TrialEnd.After(time.Now().UTC()) {
+			sub.Status = entity.StatusTrial
+		}
+	case entity.StatusTrial, entity.StatusActive:
+	default:
+		return sub, fmt.Errorf("%w: %s", ErrInvalidStatus, sub.Status)
+	}
 	if sub.EndDate != nil && sub.EndDate.Before(sub.StartDate) {
-		return nil, fmt.Errorf("SubscriptionService.CreateSubscription - end date before start date")
+		return sub, fmt.Errorf("%w: end date before start date", ErrInvalidPeriod)
 	}
+	return sub, nil
+}
 
-	createdSub, err := s.repos.Subscription.CreateSubscription(ctx, sub)
-	if err != nil {
-		if errors.Is(err, repoerrs.ErrAlreadyExists) {
-			return nil, fmt.Errorf("SubscriptionService.CreateSubscription - %w", err)
-		}
-		return nil, fmt.Errorf("SubscriptionService.CreateSubscription - repo error: %v", err)
+// applyUpdate copies the fields an update may change onto current.
+func applyUpdate(current, sub entity.Subscription) (entity.Subscription, error) {
+	if sub.Service.Name == "" {
+		return current, errors.New("empty service name")
+	}
+	if sub.Service.Price <= 0 {
+		return current, errors.New("price must be positive")
+	}
+	if sub.EndDate != nil && sub.EndDate.Before(current.StartDate) {
+		return current, fmt.Errorf("%w: end date before start date", ErrInvalidPeriod)
 	}
 
-	return createdSub, nil
+	current.Service.Name = sub.Service.Name
+	current.Service.Price = sub.Service.Price
+	current.Service.Category = sub.Service.Category
+	current.EndDate = sub.EndDate
+	current.AutoRenew = sub.AutoRenew
+	current.Notes = sub.Notes
+	current.Metadata = sub.Metadata
+	return current, nil
+}
+
+// resolveDiscount validates an explicit discount rule or replaces a promo
+// code with the rule it grants.
+func (s *subscriptionService) resolveDiscount(ctx context.Context, d entity.Discount) (*entity.Discount, error) {
+	if d.PromoCode == nil {
+		if err := validateDiscount(d); err != nil {
+			return nil, err
+		}
+		return &d, nil
+	}
+	if d.Type != "" {
+		return nil, fmt.Errorf("%w: either a discount or a promo code can be given", ErrInvalidDiscount)
+	}
+	return redeemPromoCode(ctx, s.repos, *d.PromoCode, time.Now().UTC())
 }
 
 func (s *subscriptionService) GetSubscriptionByID(
@@ -67,13 +174,6 @@ func (s *subscriptionService) UpdateSubscription(
 	id uuid.UUID,
 	sub entity.Subscription,
 ) error {
-	if sub.Service.Name == "" {
-		return fmt.Errorf("SubscriptionService.UpdateSubscription - empty service name")
-	}
-	if sub.Service.Price <= 0 {
-		return fmt.Errorf("SubscriptionService.UpdateSubscription - price must be positive")
-	}
-
 	current, err := s.repos.Subscription.GetSubscriptionByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repoerrs.ErrNotFound) {
@@ -82,20 +182,19 @@ func (s *subscriptionService) UpdateSubscription(
 		return fmt.Errorf("SubscriptionService.UpdateSubscription - get sub error: %v", err)
 	}
 
-	if sub.EndDate != nil && sub.EndDate.Before(current.StartDate) {
-		return fmt.Errorf("SubscriptionService.UpdateSubscription - end date before start date")
+	current, err = applyUpdate(current, sub)
+	if err != nil {
+		return fmt.Errorf("SubscriptionService.UpdateSubscription - %w", err)
 	}
 
-	current.Service.Name = sub.Service.Name
-	current.Service.Price = sub.Service.Price
-	current.EndDate = sub.EndDate
-
-	if err := s.repos.Subscription.UpdateSubscription(ctx, current); err != nil {
-		if errors.Is(err, repoerrs.ErrNotFound) {
+	current.OverlapPolicy = s.overlapPolicy
+	if err := s.repos.Subscription.UpdateSubscription(ctx, &current); err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) || errors.Is(err, repoerrs.ErrOverlap) {
 			return fmt.Errorf("SubscriptionService.UpdateSubscription - %w", err)
 		}
 		return fmt.Errorf("SubscriptionService.UpdateSubscription - repo error: %v", err)
 	}
+	warnOverlaps("UpdateSubscription", current)
 
 	return nil
 }
@@ -110,70 +209,179 @@ func (s *subscriptionService) DeleteSubscription(
 		}
 		return fmt.Errorf("SubscriptionService.DeleteSubscription - repo error: %v", err)
 	}
+
 	return nil
 }
 
 func (s *subscriptionService) ListSubscriptionsByUser(
 	ctx context.Context,
-	userID uuid.UUID,
+	filter entity.SubscriptionFilter,
+	sort entity.SubscriptionSort,
 	page int,
 	limit int,
-) ([]entity.Subscription, int, error) {
+	withTotal bool,
+) (entity.SubscriptionList, error) {
+	offset := (page - 1) * limit
+	subs, total, err := s.repos.Subscription.ListSubscriptions(ctx, filter, sort, offset, limit+1, withTotal)
+	if err != nil {
+		return entity.SubscriptionList{}, fmt.Errorf("SubscriptionService.ListSubscriptionsByUser - repo error: %v", err)
+	}
+	return subscriptionList(subs, total, limit, withTotal), nil
+}
 
+func (s *subscriptionService) ListAllSubscriptions(
+	ctx context.Context,
+	filter entity.SubscriptionFilter,
+	sort entity.SubscriptionSort,
+	page int,
+	limit int,
+	withTotal bool,
+) (entity.SubscriptionList, error) {
 	offset := (page - 1) * limit
-	subs, err := s.repos.Subscription.ListSubscriptions(ctx, userID, offset, limit)
+	subs, total, err := s.repos.Subscription.ListAllSubscriptions(ctx, filter, sort, offset, limit+1, withTotal)
 	if err != nil {
-		return nil, 0, fmt.Errorf("SubscriptionService.ListSubscriptionsByUser - repo error: %v", err)
+		return entity.SubscriptionList{}, fmt.Errorf("SubscriptionService.ListAllSubscriptions - repo error: %v", err)
 	}
-	total, err := s.repos.Subscription.GetTotalByUser(ctx, userID)
+	return subscriptionList(subs, total, limit, withTotal), nil
+}
+
+// subscriptionList builds a page of limit subscriptions from subs, which was
+// read with one extra row to tell whether another page follows.
+func subscriptionList(subs []entity.Subscription, total, limit int, withTotal bool) entity.SubscriptionList {
+	list := entity.SubscriptionList{Items: subs}
+	if len(subs) > limit {
+		list.Items, list.HasMore = subs[:limit], true
+	}
+	if withTotal {
+		list.Total = &total
+	}
+	return list
+}
+
+// ListSubscriptionsByCursor returns the page of limit subscriptions after
+// the cursor, or before it when cursor.Backward is set. One extra row is read
+// to tell whether another page follows in the direction of travel.
+func (s *subscriptionService) ListSubscriptionsByCursor(
+	ctx context.Context,
+	filter entity.SubscriptionFilter,
+	cursor *entity.SubscriptionCursor,
+	limit int,
+) (entity.SubscriptionPage, error) {
+	subs, err := s.repos.Subscription.ListSubscriptionsByCursor(ctx, filter, cursor, limit+1)
 	if err != nil {
-		return nil, 0, fmt.Errorf("SubscriptionService.ListSubscriptionsByUser - failed to get total: %v", err)
+		return entity.SubscriptionPage{}, fmt.Errorf("SubscriptionService.ListSubscriptionsByCursor - repo error: %v", err)
+	}
+
+	backward := cursor != nil && cursor.Backward
+	more := len(subs) > limit
+	if more {
+		if backward {
+			subs = subs[1:]
+		} else {
+			subs = subs[:limit]
+		}
 	}
-	return subs, total, nil
+
+	page := entity.SubscriptionPage{Items: subs}
+	if len(subs) == 0 {
+		return page, nil
+	}
+	// Coming from a cursor means there is a page on the side it came from.
+	if more || backward {
+		next := subs[len(subs)-1].CursorOf()
+		page.Next = &next
+	}
+	if (more && backward) || (cursor != nil && !backward) {
+		prev := subs[0].CursorOf()
+		prev.Backward = true
+		page.Prev = &prev
+	}
+	return page, nil
 }
 
+func (s *subscriptionService) SearchSubscriptions(
+	ctx context.Context,
+	search entity.SubscriptionSearch,
+	offset int,
+	limit int,
+) ([]entity.SubscriptionMatch, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, fmt.Errorf("SubscriptionService.SearchSubscriptions - empty query")
+	}
+
+	matches, err := s.repos.Subscription.SearchSubscriptions(ctx, search, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("SubscriptionService.SearchSubscriptions - repo error: %v", err)
+	}
+	return matches, nil
+}
+
+// CalculateTotalCost sums snapshotted costs for closed months that have a
+// fresh snapshot and computes every other month of the period from raw rows.
+// Gross is the cost at list prices, Net the cost after trials and discounts.
 func (s *subscriptionService) CalculateTotalCost(
 	ctx context.Context,
 	userID *uuid.UUID,
 	serviceName *string,
 	startDate, endDate time.Time,
-) (int, error) {
+) (entity.CostSummary, error) {
+	startDate, endDate = monthStart(startDate), monthStart(endDate)
 
-	subscriptions, err := s.repos.Report.GetTotalCost(ctx, userID, serviceName, startDate, endDate)
-	if err != nil {
-		return 0, fmt.Errorf("service error: %w", err)
+	var total entity.CostSummary
+	covered := make(map[string]bool)
+
+	lastClosed := monthStart(time.Now().UTC()).AddDate(0, -1, 0)
+	if !startDate.After(lastClosed) {
+		snapshotEnd := endDate
+		if snapshotEnd.After(lastClosed) {
+			snapshotEnd = lastClosed
+		}
+		snapshots, err := s.repos.Snapshot.GetSnapshotCosts(ctx, userID, serviceName, startDate, snapshotEnd)
+		if err != nil {
+			return entity.CostSummary{}, fmt.Errorf("service error: %w", err)
+		}
+		for _, snapshot := range snapshots {
+			covered[monthKey(snapshot.Month)] = true
+			total.Gross += snapshot.Cost
+			total.Net += snapshot.NetCost
+		}
+	}
+
+	liveStart := startDate
+	for !liveStart.After(endDate) && covered[monthKey(liveStart)] {
+		liveStart = liveStart.AddDate(0, 1, 0)
+	}
+	if liveStart.After(endDate) {
+		return total, nil
 	}
 
-	monthMap := make(map[string]bool)
-	totalCost := 0
+	subscriptions, err := s.repos.Report.GetTotalCost(ctx, userID, serviceName, liveStart, endDate)
+	if err != nil {
+		return entity.CostSummary{}, fmt.Errorf("service error: %w", err)
+	}
 
+	// Every month is charged once, by the earliest subscription active and
+	// not paused in it, matching how monthly_costs snapshots are read.
 	for _, data := range subscriptions {
-
-		currentStart := data.StartDate
-		if currentStart.Before(startDate) {
-			currentStart = startDate
-		}
-		currentEnd := data.EndDate
-		if currentEnd != nil && currentEnd.After(endDate) {
-			currentEnd = &endDate
-		}
-		if currentEnd == nil || currentEnd.After(endDate) {
-			currentEnd = &endDate
+		currentStart := monthStart(data.StartDate)
+		if currentStart.Before(liveStart) {
+			currentStart = liveStart
 		}
-		if currentEnd != nil && currentEnd.Before(currentStart) {
-			continue
+		currentEnd := endDate
+		if data.EndDate != nil && data.EndDate.Before(endDate) {
+			currentEnd = monthStart(*data.EndDate)
 		}
 
-		current := currentStart
-		for !current.After(*currentEnd) {
-			monthKey := current.Format("2006-01")
-			if !monthMap[monthKey] {
-				monthMap[monthKey] = true
-				totalCost += data.Price
+		for current := currentStart; !current.After(currentEnd); current = current.AddDate(0, 1, 0) {
+			if covered[monthKey(current)] || data.PausedIn(current) {
+				continue
 			}
-			current = current.AddDate(0, 1, 0)
+			covered[monthKey(current)] = true
+			total.Gross += data.Price
+			total.Net += data.NetPriceIn(current)
 		}
 	}
 
-	return totalCost, nil
+	return total, nil
 }
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/google/uuid"
+)
+
+// fakeReport serves GetTotalCost from costs, which are expected in the order
+// the repository returns them: by start date.
+type fakeReport struct {
+	repo.Report
+	costs []entity.SubscriptionCost
+}
+
+func (r *fakeReport) GetTotalCost(context.Context, *uuid.UUID, *string, time.Time, time.Time) ([]entity.SubscriptionCost, error) {
+	return r.costs, nil
+}
+
+// fakeSnapshot has no fresh snapshots, so every month is computed live.
+type fakeSnapshot struct {
+	repo.Snapshot
+}
+
+func (fakeSnapshot) GetSnapshotCosts(context.Context, *uuid.UUID, *string, time.Time, time.Time) ([]entity.MonthlyCost, error) {
+	return nil, nil
+}
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestCalculateTotalCostChargesEveryMonthOnce(t *testing.T) {
+	userID := uuid.New()
+	julyEnd := time.Date(2025, time.July, 31, 0, 0, 0, 0, time.UTC)
+	costs := []entity.SubscriptionCost{
+		{UserID: userID, ServiceName: "Netflix", Price: 400, StartDate: month(2025, time.June), EndDate: &julyEnd},
+		{UserID: userID, ServiceName: "Netflix", Price: 1000, StartDate: month(2025, time.July),
+			Pauses: []entity.PausePeriod{{From: month(2025, time.August), Until: ptr(month(2025, time.September))}}},
+		{UserID: userID, ServiceName: "Spotify", Price: 900, StartDate: time.Date(2025, time.August, 10, 0, 0, 0, 0, time.UTC)},
+	}
+	svc := NewSubscriptionService(&repo.Repositories{
+		Report:   &fakeReport{costs: costs},
+		Snapshot: fakeSnapshot{},
+	}, entity.OverlapReject)
+
+	got, err := svc.CalculateTotalCost(context.Background(), &userID, nil, month(2025, time.June), month(2025, time.September))
+	if err != nil {
+		t.Fatalf("CalculateTotalCost: %v", err)
+	}
+
+	// June and July go to the earliest subscription, August to Spotify while
+	// the second Netflix one is paused, September to that one again.
+	want := entity.CostSummary{Gross: 400 + 400 + 900 + 1000, Net: 400 + 400 + 900 + 1000}
+	if got != want {
+		t.Errorf("CalculateTotalCost = %+v, want %+v", got, want)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/google/uuid"
+)
+
+type userDataService struct {
+	repos *repo.Repositories
+}
+
+func NewUserDataService(repos *repo.Repositories) UserDataService {
+	return &userDataService{repos: repos}
+}
+
+func (s *userDataService) ExportUserData(ctx context.Context, userID uuid.UUID) (*entity.UserData, error) {
+	data, err := s.repos.UserData.ExportUserData(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("UserDataService.ExportUserData - repo error: %v", err)
+	}
+	data.ExportedAt = time.Now().UTC()
+	return &data, nil
+}
+
+func (s *userDataService) EraseUserData(ctx context.Context, userID uuid.UUID, reference string) (*entity.UserErasure, error) {
+	erasure := entity.UserErasure{
+		UserIDHash: entity.UserIDHash(userID),
+		Reference:  reference,
+	}
+	if err := s.repos.UserData.EraseUserData(ctx, userID, &erasure); err != nil {
+		return nil, fmt.Errorf("UserDataService.EraseUserData - repo error: %v", err)
+	}
+	return &erasure, nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand/v2"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/webhook"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	webhookSecretBytes = 32
+	// webhookBatchSize bounds how many deliveries one dispatch run claims.
+	webhookBatchSize = 50
+	// webhookLease is how long a claimed delivery is hidden from other
+	// dispatchers; it must exceed the request timeout.
+	webhookLease = 5 * time.Minute
+
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+var webhookEventTypes = []entity.EventType{
+	entity.EventSubscriptionCreated,
+	entity.EventSubscriptionUpdated,
+	entity.EventSubscriptionDeleted,
+	entity.EventSubscriptionExpired,
+	entity.EventSubscriptionRenewed,
+	entity.EventRenewalDue,
+}
+
+// renewalEventNamespace derives stable event IDs for renewal_due events, so
+// the same charge is announced to an endpoint only once.
+var renewalEventNamespace = uuid.MustParse("8f0f3f4e-4c1b-4d5e-9b7a-2f6c1d0e9a31")
+
+type WebhookSettings struct {
+	MaxAttempts       int
+	RequestTimeout    time.Duration
+	RenewalNoticeDays int
+	// AllowPrivateNetworks permits endpoints on loopback and private
+	// addresses, which are refused by default to keep webhooks from
+	// reaching internal services.
+	AllowPrivateNetworks bool
+}
+
+type webhookService struct {
+	repos    *repo.Repositories
+	renewals RenewalService
+	client   *webhook.Client
+	settings WebhookSettings
+}
+
+func NewWebhookService(repos *repo.Repositories, renewals RenewalService, settings WebhookSettings) WebhookService {
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = 8
+	}
+	if settings.RequestTimeout <= 0 {
+		settings.RequestTimeout = 10 * time.Second
+	}
+	if settings.RenewalNoticeDays <= 0 {
+		settings.RenewalNoticeDays = 3
+	}
+	return &webhookService{
+		repos:    repos,
+		renewals: renewals,
+		client:   webhook.NewClient(settings.RequestTimeout, settings.AllowPrivateNetworks),
+		settings: settings,
+	}
+}
+
+// webhookPayload is the JSON body of every webhook request.
+type webhookPayload struct {
+	ID        uuid.UUID        `json:"id"`
+	Type      entity.EventType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      any              `json:"data"`
+}
+
+func (s *webhookService) CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (*entity.WebhookEndpoint, error) {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("WebhookService.CreateEndpoint - %w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	if !s.settings.AllowPrivateNetworks {
+		if err := webhook.CheckHost(ctx, u.Hostname()); err != nil {
+			if errors.Is(err, webhook.ErrForbiddenAddress) {
+				return nil, fmt.Errorf("WebhookService.CreateEndpoint - %w: url must point to a public address", ErrInvalidWebhook)
+			}
+			return nil, fmt.Errorf("WebhookService.CreateEndpoint - %w: url host cannot be resolved", ErrInvalidWebhook)
+		}
+	}
+	for _, t := range endpoint.EventTypes {
+		if !slices.Contains(webhookEventTypes, t) {
+			return nil, fmt.Errorf("WebhookService.CreateEndpoint - %w: unknown event type %q", ErrInvalidWebhook, t)
+		}
+	}
+
+	buf := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("WebhookService.CreateEndpoint - generate secret: %v", err)
+	}
+	endpoint.Secret = "whsec_" + hex.EncodeToString(buf)
+
+	created, err := s.repos.Webhook.CreateEndpoint(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("WebhookService.CreateEndpoint - repo error: %v", err)
+	}
+	return created, nil
+}
+
+// ListEndpoints returns the endpoints of the user. Secrets are only shown
+// when an endpoint is created.
+func (s *webhookService) ListEndpoints(ctx context.Context, userID uuid.UUID) ([]entity.WebhookEndpoint, error) {
+	endpoints, err := s.repos.Webhook.ListEndpoints(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("WebhookService.ListEndpoints - repo error: %v", err)
+	}
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	return endpoints, nil
+}
+
+func (s *webhookService) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	if err := s.repos.Webhook.DeleteEndpoint(ctx, id); err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return fmt.Errorf("WebhookService.DeleteEndpoint - %w", err)
+		}
+		return fmt.Errorf("WebhookService.DeleteEndpoint - repo error: %v", err)
+	}
+	return nil
+}
+
+func (s *webhookService) ListDeliveries(
+	ctx context.Context,
+	endpointID uuid.UUID,
+	status *entity.DeliveryStatus,
+	offset, limit int,
+) ([]entity.WebhookDelivery, int, error) {
+	if _, err := s.repos.Webhook.GetEndpoint(ctx, endpointID); err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return nil, 0, fmt.Errorf("WebhookService.ListDeliveries - %w", err)
+		}
+		return nil, 0, fmt.Errorf("WebhookService.ListDeliveries - get endpoint: %v", err)
+	}
+
+	deliveries, total, err := s.repos.Webhook.ListDeliveries(ctx, endpointID, status, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("WebhookService.ListDeliveries - repo error: %v", err)
+	}
+	return deliveries, total, nil
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, endpointID, deliveryID uuid.UUID) error {
+	if err := s.repos.Webhook.RetryDelivery(ctx, endpointID, deliveryID); err != nil {
+		if errors.Is(err, repoerrs.ErrNotFound) {
+			return fmt.Errorf("WebhookService.RetryDelivery - %w", err)
+		}
+		return fmt.Errorf("WebhookService.RetryDelivery - repo error: %v", err)
+	}
+	return nil
+}
+
+// OnSubscriptionEvent queues the event for the endpoints of the subscription
+// owner. Queueing the same event again is a no-op, so the relay may retry it.
+func (s *webhookService) OnSubscriptionEvent(ctx context.Context, event entity.SubscriptionEvent) error {
+	payload := webhookPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.OccurredAt,
+		Data:      event.Subscription,
+	}
+	if _, err := s.enqueue(ctx, event.Subscription.UserID, payload); err != nil {
+		return fmt.Errorf("WebhookService.OnSubscriptionEvent - enqueue: %v", err)
+	}
+	return nil
+}
+
+func (s *webhookService) enqueue(ctx context.Context, userID uuid.UUID, payload webhookPayload) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("marshal payload: %v", err)
+	}
+	return s.repos.Webhook.EnqueueEvent(ctx, userID, payload.Type, payload.ID, body)
+}
+
+// EnqueueRenewalsDue queues a renewal_due event for every charge within the
+// notice period of users with a subscribed endpoint. Each charge is queued
+// once per endpoint however often this runs. It returns the number of new deliveries.
+func (s *webhookService) EnqueueRenewalsDue(ctx context.Context) (int, error) {
+	userIDs, err := s.repos.Webhook.ListUserIDsForEvent(ctx, entity.EventRenewalDue)
+	if err != nil {
+		return 0, fmt.Errorf("WebhookService.EnqueueRenewalsDue - repo error: %v", err)
+	}
+
+	queued := 0
+	for _, userID := range userIDs {
+		renewals, err := s.renewals.ListUpcoming(ctx, userID, s.settings.RenewalNoticeDays)
+		if err != nil {
+			return queued, fmt.Errorf("WebhookService.EnqueueRenewalsDue - %v", err)
+		}
+
+		for _, r := range renewals {
+			key := fmt.Sprintf("%s:%s", r.SubscriptionID, r.ChargeDate.Format(time.DateOnly))
+			n, err := s.enqueue(ctx, userID, webhookPayload{
+				ID:        uuid.NewSHA1(renewalEventNamespace, []byte(key)),
+				Type:      entity.EventRenewalDue,
+				CreatedAt: time.Now().UTC(),
+				Data:      r,
+			})
+			if err != nil {
+				return queued, fmt.Errorf("WebhookService.EnqueueRenewalsDue - enqueue: %v", err)
+			}
+			queued += n
+		}
+	}
+	return queued, nil
+}
+
+// DeliverDue sends a batch of due deliveries and records each attempt. It
+// returns the number of attempts made.
+func (s *webhookService) DeliverDue(ctx context.Context) (int, error) {
+	targets, err := s.repos.Webhook.ClaimDueDeliveries(ctx, webhookBatchSize, webhookLease)
+	if err != nil {
+		return 0, fmt.Errorf("WebhookService.DeliverDue - claim: %v", err)
+	}
+
+	for i, t := range targets {
+		result := s.attempt(ctx, t)
+		if err := s.repos.Webhook.RecordAttempt(ctx, t.Delivery.ID, result); err != nil {
+			return i, fmt.Errorf("WebhookService.DeliverDue - record attempt: %v", err)
+		}
+	}
+	return len(targets), nil
+}
+
+func (s *webhookService) attempt(ctx context.Context, t entity.DeliveryTarget) entity.DeliveryResult {
+	code, err := s.client.Send(ctx, webhook.Request{
+		URL:        t.URL,
+		Secret:     t.Secret,
+		Event:      string(t.Delivery.EventType),
+		DeliveryID: t.Delivery.ID.String(),
+		Body:       t.Delivery.Payload,
+	})
+
+	var result entity.DeliveryResult
+	if code != 0 {
+		result.StatusCode = &code
+	}
+	if err == nil {
+		result.Delivered = true
+		return result
+	}
+
+	msg := err.Error()
+	result.Error = &msg
+	attempt := t.Delivery.Attempts + 1
+	if attempt < s.settings.MaxAttempts {
+		next := time.Now().UTC().Add(webhookBackoff(attempt))
+		result.NextAttemptAt = &next
+	} else {
+		log.Warnf("WebhookService - delivery %s to endpoint %s is dead after %d attempts: %v",
+			t.Delivery.ID, t.Delivery.EndpointID, attempt, err)
+	}
+	return result
+}
+
+// webhookBackoff doubles the delay with every failed attempt up to
+// webhookMaxBackoff and adds up to 20% jitter so retries of many deliveries
+// to the same receiver spread out.
+func webhookBackoff(attempt int) time.Duration {
+	delay := float64(webhookBaseBackoff) * math.Pow(2, float64(attempt-1))
+	if delay > float64(webhookMaxBackoff) {
+		delay = float64(webhookMaxBackoff)
+	}
+	return time.Duration(delay * (1 + 0.2*mathrand.Float64()))
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/entity"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/pgdb/pgtest"
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/repo/repoerrs"
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/webhook"
+	"github.com/google/uuid"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, webhookBaseBackoff},
+		{2, 2 * webhookBaseBackoff},
+		{3, 4 * webhookBaseBackoff},
+		{11, webhookMaxBackoff},
+		{200, webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			got := webhookBackoff(tt.attempt)
+			if got < tt.base || got > tt.base+tt.base/5 {
+				t.Fatalf("webhookBackoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.base, tt.base+tt.base/5)
+			}
+		}
+	}
+}
+
+// memoryWebhooks keeps deliveries of a single endpoint in memory and
+// follows the state changes of the PostgreSQL repository.
+type memoryWebhooks struct {
+	repo.Webhook
+
+	mu         sync.Mutex
+	endpoint   entity.WebhookEndpoint
+	deliveries []*entity.WebhookDelivery
+}
+
+func (m *memoryWebhooks) EnqueueEvent(_ context.Context, _ uuid.UUID, eventType entity.EventType, eventID uuid.UUID, payload []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		if d.EventID == eventID {
+			return 0, nil
+		}
+	}
+	m.deliveries = append(m.deliveries, &entity.WebhookDelivery{
+		ID: uuid.New(), EndpointID: m.endpoint.ID, EventID: eventID, EventType: eventType,
+		Payload: payload, Status: entity.DeliveryPending, NextAttemptAt: time.Now(),
+	})
+	return 1, nil
+}
+
+func (m *memoryWebhooks) ClaimDueDeliveries(_ context.Context, limit int, lease time.Duration) ([]entity.DeliveryTarget, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var targets []entity.DeliveryTarget
+	for _, d := range m.deliveries {
+		if len(targets) == limit || d.Status != entity.DeliveryPending || d.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+		d.NextAttemptAt = time.Now().Add(lease)
+		targets = append(targets, entity.DeliveryTarget{Delivery: *d, URL: m.endpoint.URL, Secret: m.endpoint.Secret})
+	}
+	return targets, nil
+}
+
+func (m *memoryWebhooks) RecordAttempt(_ context.Context, id uuid.UUID, result entity.DeliveryResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.find(id)
+	d.Attempts++
+	d.LastStatusCode, d.LastError = result.StatusCode, result.Error
+	switch {
+	case result.Delivered:
+		d.Status = entity.DeliveryDelivered
+	case result.NextAttemptAt == nil:
+		d.Status = entity.DeliveryDead
+	default:
+		d.NextAttemptAt = *result.NextAttemptAt
+	}
+	return nil
+}
+
+func (m *memoryWebhooks) RetryDelivery(_ context.Context, endpointID, deliveryID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.find(deliveryID)
+	if d == nil || d.EndpointID != endpointID || d.Status != entity.DeliveryDead {
+		return repoerrs.ErrNotFound
+	}
+	d.Status, d.Attempts, d.NextAttemptAt = entity.DeliveryPending, 0, time.Now()
+	return nil
+}
+
+func (m *memoryWebhooks) find(id uuid.UUID) *entity.WebhookDelivery {
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// makeDue lets the dispatcher pick up deliveries waiting for their backoff.
+func (m *memoryWebhooks) makeDue() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		d.NextAttemptAt = time.Now()
+	}
+}
+
+// receiver is a webhook endpoint that verifies signatures and answers with
+// 500 while failing is set.
+type receiver struct {
+	*httptest.Server
+	failing  atomic.Bool
+	received atomic.Int32
+	invalid  atomic.Int32
+}
+
+func newReceiver(t *testing.T, secret *string) *receiver {
+	r := &receiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if err := webhook.Verify(*secret, req.Header, body, time.Minute); err != nil {
+			r.invalid.Add(1)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r.received.Add(1)
+		if r.failing.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func testEvent(userID uuid.UUID) entity.SubscriptionEvent {
+	return entity.SubscriptionEvent{
+		ID:           uuid.New(),
+		Type:         entity.EventSubscriptionCreated,
+		OccurredAt:   time.Now().UTC(),
+		Subscription: entity.Subscription{ID: uuid.New(), UserID: userID},
+	}
+}
+
+func TestWebhookRetryDeadLetterAndManualRetry(t *testing.T) {
+	ctx := context.Background()
+	secret := "whsec_test"
+	recv := newReceiver(t, &secret)
+	recv.failing.Store(true)
+
+	userID := uuid.New()
+	webhooks := &memoryWebhooks{}
+	svc := NewWebhookService(&repo.Repositories{Webhook: webhooks}, nil, WebhookSettings{
+		MaxAttempts:          3,
+		RequestTimeout:       time.Second,
+		AllowPrivateNetworks: true,
+	})
+
+	webhooks.endpoint = entity.WebhookEndpoint{ID: uuid.New(), UserID: userID, URL: recv.URL, Secret: secret}
+	if err := svc.OnSubscriptionEvent(ctx, testEvent(userID)); err != nil {
+		t.Fatalf("OnSubscriptionEvent: %v", err)
+	}
+	delivery := webhooks.deliveries[0]
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if n, err := svc.DeliverDue(ctx); err != nil || n != 1 {
+			t.Fatalf("attempt %d: DeliverDue = %d, %v; want 1, nil", attempt, n, err)
+		}
+		if attempt < 3 {
+			if delivery.Status != entity.DeliveryPending || !delivery.NextAttemptAt.After(time.Now()) {
+				t.Fatalf("after attempt %d delivery is %s due %v, want pending with a backoff", attempt, delivery.Status, delivery.NextAttemptAt)
+			}
+			if n, _ := svc.DeliverDue(ctx); n != 0 {
+				t.Fatalf("delivery retried before its backoff passed")
+			}
+			webhooks.makeDue()
+		}
+	}
+	if delivery.Status != entity.DeliveryDead || delivery.Attempts != 3 {
+		t.Fatalf("delivery is %s after %d attempts, want dead after 3", delivery.Status, delivery.Attempts)
+	}
+	if delivery.LastStatusCode == nil || *delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("last status code = %v, want 500", delivery.LastStatusCode)
+	}
+	if n, _ := svc.DeliverDue(ctx); n != 0 {
+		t.Fatal("dead delivery was attempted again")
+	}
+
+	if err := svc.RetryDelivery(ctx, uuid.New(), delivery.ID); !errors.Is(err, repoerrs.ErrNotFound) {
+		t.Errorf("RetryDelivery of another endpoint = %v, want ErrNotFound", err)
+	}
+	recv.failing.Store(false)
+	if err := svc.RetryDelivery(ctx, webhooks.endpoint.ID, delivery.ID); err != nil {
+		t.Fatalf("RetryDelivery: %v", err)
+	}
+	if n, err := svc.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("DeliverDue after retry = %d, %v; want 1, nil", n, err)
+	}
+	if delivery.Status != entity.DeliveryDelivered {
+		t.Errorf("delivery is %s after manual retry, want delivered", delivery.Status)
+	}
+
+	if got := recv.received.Load(); got != 4 {
+		t.Errorf("receiver got %d requests, want 4", got)
+	}
+	if got := recv.invalid.Load(); got != 0 {
+		t.Errorf("receiver rejected %d signatures", got)
+	}
+}
+
+func TestCreateEndpointRefusesPrivateAddresses(t *testing.T) {
+	svc := NewWebhookService(&repo.Repositories{}, nil, WebhookSettings{})
+	for _, url := range []string{
+		"http://127.0.0.1:9000/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://169.254.169.254/latest/meta-data",
+	} {
+		_, err := svc.CreateEndpoint(context.Background(), entity.WebhookEndpoint{UserID: uuid.New(), URL: url})
+		if !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("CreateEndpoint(%s) = %v, want ErrInvalidWebhook", url, err)
+		}
+	}
+}
+
+// TestWebhookEnqueueIsIdempotent runs against PostgreSQL: an event queued
+// twice, as the outbox relay does when it retries, reaches the receiver once.
+func TestWebhookEnqueueIsIdempotent(t *testing.T) {
+	pool := pgtest.NewPool(t)
+	ctx := context.Background()
+
+	var secret string
+	recv := newReceiver(t, &secret)
+
+	repos := repo.NewRepositories(pool)
+	svc := NewWebhookService(repos, nil, WebhookSettings{RequestTimeout: time.Second, AllowPrivateNetworks: true})
+
+	userID := uuid.New()
+	endpoint, err := svc.CreateEndpoint(ctx, entity.WebhookEndpoint{UserID: userID, URL: recv.URL})
+	if err != nil {
+		t.Fatalf("CreateEndpoint: %v", err)
+	}
+	secret = endpoint.Secret
+
+	event := testEvent(userID)
+	for range 2 {
+		if err := svc.OnSubscriptionEvent(ctx, event); err != nil {
+			t.Fatalf("OnSubscriptionEvent: %v", err)
+		}
+	}
+	if n, err := repos.Webhook.EnqueueEvent(ctx, userID, event.Type, event.ID, []byte(`{}`)); err != nil || n != 0 {
+		t.Errorf("EnqueueEvent of a queued event = %d, %v; want 0, nil", n, err)
+	}
+
+	if n, err := svc.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("DeliverDue = %d, %v; want 1, nil", n, err)
+	}
+	if n, err := svc.DeliverDue(ctx); err != nil || n != 0 {
+		t.Fatalf("second DeliverDue = %d, %v; want 0, nil", n, err)
+	}
+	if got := recv.received.Load(); got != 1 {
+		t.Errorf("receiver got %d requests, want 1", got)
+	}
+
+	deliveries, total, err := svc.ListDeliveries(ctx, endpoint.ID, nil, 0, 10)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if total != 1 || deliveries[0].Status != entity.DeliveryDelivered {
+		t.Errorf("deliveries = %+v (total %d), want one delivered", deliveries, total)
+	}
+}
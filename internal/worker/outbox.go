@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultRelayInterval = time.Second
+
+// OutboxRelay publishes outbox events. Several instances may run side by
+// side, each locks its own events.
+type OutboxRelay struct {
+	periodic
+	service service.OutboxService
+}
+
+func NewOutboxRelay(s service.OutboxService, interval time.Duration) *OutboxRelay {
+	if interval <= 0 {
+		interval = defaultRelayInterval
+	}
+	return &OutboxRelay{periodic: periodic{interval: interval}, service: s}
+}
+
+func (r *OutboxRelay) Start() {
+	r.start(r.relay)
+}
+
+// relay keeps publishing batches until one publishes nothing, because no
+// event is due or all of them failed.
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.service.RelayPending(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("worker - OutboxRelay - relay: %v", err)
+			}
+			return
+		}
+		if published == 0 {
+			return
+		}
+		log.Debugf("worker - OutboxRelay - published %d event(s)", published)
+	}
+}
+
+// Stop cancels a running relay and waits for the worker to exit.
+func (r *OutboxRelay) Stop() {
+	r.stop()
+}
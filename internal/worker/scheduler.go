@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scheduler runs every job of the job service on its cron schedule. All
+// instances fire the same slots, the job service makes sure each slot runs
+// on one of them.
+type Scheduler struct {
+	service service.JobService
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewScheduler(s service.JobService) *Scheduler {
+	return &Scheduler{service: s}
+}
+
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, name := range s.service.JobNames() {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, name)
+		}()
+	}
+}
+
+// loop waits for each slot of the job and runs it. Slots missed while a run
+// takes longer than the schedule, or while no instance is up, are skipped.
+func (s *Scheduler) loop(ctx context.Context, name string) {
+	for {
+		next, err := s.service.NextRun(name, time.Now())
+		if err != nil {
+			log.Errorf("worker - Scheduler - %s: %v", name, err)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ran, err := s.service.RunScheduled(ctx, name, next)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("worker - Scheduler - %v", err)
+			}
+			continue
+		}
+		if !ran {
+			log.Debugf("worker - Scheduler - %s slot %s ran elsewhere", name, next.Format(time.RFC3339))
+		}
+	}
+}
+
+// Stop cancels running jobs, including manually triggered ones, and waits
+// for them to finish.
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+	s.service.Shutdown()
+}
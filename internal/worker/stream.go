@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultListenRetryInterval = 5 * time.Second
+
+// EventListener keeps the LISTEN connection that feeds event streams of this
+// instance, reconnecting after interval when it fails.
+type EventListener struct {
+	periodic
+	service service.EventStreamService
+}
+
+func NewEventListener(s service.EventStreamService, interval time.Duration) *EventListener {
+	if interval <= 0 {
+		interval = defaultListenRetryInterval
+	}
+	return &EventListener{periodic: periodic{interval: interval}, service: s}
+}
+
+func (l *EventListener) Start() {
+	l.start(l.listen)
+}
+
+func (l *EventListener) listen(ctx context.Context) {
+	if err := l.service.Listen(ctx); err != nil && ctx.Err() == nil {
+		log.Errorf("worker - EventListener - listen: %v", err)
+	}
+}
+
+// Stop closes the connection and waits for the worker to exit.
+func (l *EventListener) Stop() {
+	l.stop()
+}
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/internal/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultDispatchInterval = 5 * time.Second
+
+// WebhookDispatcher sends due webhook deliveries from the queue. Several
+// instances may run side by side, each claims its own deliveries.
+type WebhookDispatcher struct {
+	periodic
+	service service.WebhookService
+}
+
+func NewWebhookDispatcher(s service.WebhookService, interval time.Duration) *WebhookDispatcher {
+	if interval <= 0 {
+		interval = defaultDispatchInterval
+	}
+	return &WebhookDispatcher{periodic: periodic{interval: interval}, service: s}
+}
+
+func (d *WebhookDispatcher) Start() {
+	d.start(d.dispatch)
+}
+
+// dispatch keeps claiming batches until nothing is due, so a backlog drains
+// without waiting for the next tick. Failed deliveries are rescheduled into
+// the future and do not keep the loop going.
+func (d *WebhookDispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		sent, err := d.service.DeliverDue(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("worker - WebhookDispatcher - deliver: %v", err)
+			}
+			return
+		}
+		if sent == 0 {
+			return
+		}
+		log.Debugf("worker - WebhookDispatcher - attempted %d delivery(ies)", sent)
+	}
+}
+
+// Stop cancels running deliveries and waits for the worker to exit.
+func (d *WebhookDispatcher) Stop() {
+	d.stop()
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS monthly_cost_refreshes;
+
+DROP TABLE IF EXISTS monthly_costs;
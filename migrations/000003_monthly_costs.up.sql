@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS monthly_costs (
+    user_id UUID NOT NULL,
+    service_name TEXT NOT NULL,
+    month DATE NOT NULL,
+    cost INTEGER NOT NULL CHECK (cost >= 0),
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, service_name, month)
+);
+
+CREATE INDEX IF NOT EXISTS idx_monthly_costs_month ON monthly_costs(month);
+
+-- A closed month is served from monthly_costs only when it has a row here
+-- that is not stale. Edits of subscriptions touching the month mark it stale.
+CREATE TABLE IF NOT EXISTS monthly_cost_refreshes (
+    month DATE PRIMARY KEY,
+    stale BOOLEAN NOT NULL DEFAULT FALSE,
+    refreshed_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,21 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('trial', 'active', 'paused', 'cancelled', 'expired'));
+
+UPDATE subscriptions
+SET status = 'expired'
+WHERE end_date IS NOT NULL AND end_date < date_trunc('month', CURRENT_DATE);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_status ON subscriptions(status);
+
+-- Months from paused_from up to, but not including, resumed_from are not charged.
+CREATE TABLE IF NOT EXISTS subscription_pauses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    paused_from DATE NOT NULL,
+    resumed_from DATE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_pauses_open
+ON subscription_pauses(subscription_id) WHERE resumed_from IS NULL;
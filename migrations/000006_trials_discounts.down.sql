@@ -0,0 +1,11 @@
+ALTER TABLE monthly_costs
+DROP COLUMN IF EXISTS net_cost;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS promo_code,
+DROP COLUMN IF EXISTS discount_months,
+DROP COLUMN IF EXISTS discount_value,
+DROP COLUMN IF EXISTS discount_type,
+DROP COLUMN IF EXISTS trial_end;
+
+DROP TABLE IF EXISTS promo_codes;
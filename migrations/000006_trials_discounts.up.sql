@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS promo_codes (
+    code TEXT PRIMARY KEY,
+    discount_type TEXT NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    discount_value INTEGER NOT NULL CHECK (discount_value > 0),
+    discount_months INTEGER CHECK (discount_months > 0),
+    valid_until DATE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (discount_type <> 'percent' OR discount_value <= 100)
+);
+
+-- The discount rule is copied onto the subscription, so later edits of a promo
+-- code do not change the cost of subscriptions that already redeemed it.
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS trial_end DATE,
+ADD COLUMN IF NOT EXISTS discount_type TEXT CHECK (discount_type IN ('percent', 'fixed')),
+ADD COLUMN IF NOT EXISTS discount_value INTEGER CHECK (discount_value > 0),
+ADD COLUMN IF NOT EXISTS discount_months INTEGER CHECK (discount_months > 0),
+ADD COLUMN IF NOT EXISTS promo_code TEXT REFERENCES promo_codes(code) ON DELETE SET NULL;
+
+ALTER TABLE monthly_costs
+ADD COLUMN IF NOT EXISTS net_cost INTEGER NOT NULL DEFAULT 0 CHECK (net_cost >= 0);
+
+-- Existing snapshots have no net cost yet.
+UPDATE monthly_cost_refreshes SET stale = TRUE;
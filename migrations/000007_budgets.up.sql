@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS budgets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    service_name TEXT,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- One overall budget and one budget per service for each user.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_user_service
+ON budgets(user_id, COALESCE(service_name, ''));
+
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    service_name TEXT,
+    kind TEXT NOT NULL CHECK (kind IN ('actual', 'projected')),
+    month DATE NOT NULL,
+    spend INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (budget_id, month, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_budget_alerts_user ON budget_alerts(user_id, created_at DESC);
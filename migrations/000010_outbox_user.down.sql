@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_outbox_events_user;
+
+ALTER TABLE IF EXISTS outbox_events DROP COLUMN IF EXISTS user_id;
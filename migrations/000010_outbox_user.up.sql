@@ -0,0 +1,12 @@
+-- Owner of the changed subscription, used to stream a user's events and to
+-- resume a stream after the last received event.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS user_id UUID;
+
+UPDATE outbox_events
+SET user_id = (payload->'subscription'->>'user_id')::uuid
+WHERE user_id IS NULL;
+
+ALTER TABLE outbox_events ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_user
+ON outbox_events(user_id, created_at, id);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id UUID PRIMARY KEY,
+    email TEXT NOT NULL,
+    locale TEXT NOT NULL DEFAULT 'ru' CHECK (locale IN ('ru', 'en')),
+    renewal_reminders BOOLEAN NOT NULL DEFAULT TRUE,
+    trial_reminders BOOLEAN NOT NULL DEFAULT TRUE,
+    days_before INTEGER NOT NULL DEFAULT 3 CHECK (days_before BETWEEN 1 AND 30),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Sent reminder emails. The unique key makes sure a charge is reminded of
+-- once even if the job runs repeatedly or on several replicas.
+CREATE TABLE IF NOT EXISTS email_reminders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('renewal', 'trial_end')),
+    charge_date DATE NOT NULL,
+    email TEXT NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, kind, charge_date)
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    job_name TEXT NOT NULL,
+    trigger TEXT NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    status TEXT NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    instance TEXT NOT NULL,
+    scheduled_at TIMESTAMP WITH TIME ZONE,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE,
+    processed INTEGER,
+    error TEXT
+);
+
+-- A cron slot runs once even when several instances fire it.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_job_runs_slot
+ON job_runs(job_name, scheduled_at) WHERE scheduled_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job_name, started_at DESC);
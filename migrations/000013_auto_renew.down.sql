@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_subscriptions_ending;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS auto_renew;
@@ -0,0 +1,6 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS auto_renew BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Subscriptions the expiry job still has to look at.
+CREATE INDEX IF NOT EXISTS idx_subscriptions_ending
+ON subscriptions(end_date) WHERE status IN ('trial', 'active', 'paused') AND end_date IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Serves listings of a user ordered by (start_date, id) in both directions.
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_start
+ON subscriptions(user_id, start_date DESC, id DESC);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_services_name_prefix;
+DROP INDEX IF EXISTS idx_services_category;
+
+ALTER TABLE services
+DROP COLUMN IF EXISTS category;
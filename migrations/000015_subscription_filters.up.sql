@@ -0,0 +1,7 @@
+ALTER TABLE services
+ADD COLUMN IF NOT EXISTS category TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_services_category ON services(category);
+
+-- Serves case-insensitive prefix search on service names.
+CREATE INDEX IF NOT EXISTS idx_services_name_prefix ON services(lower(name) text_pattern_ops);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_subscriptions_notes_fts;
+DROP INDEX IF EXISTS idx_services_name_fts;
+DROP INDEX IF EXISTS idx_services_name_trgm;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS notes;
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS notes TEXT;
+
+-- Typo-tolerant matching of service names, e.g. "netflx" finds "Netflix".
+CREATE INDEX IF NOT EXISTS idx_services_name_trgm ON services USING GIN (name gin_trgm_ops);
+
+-- Full-text search. The expressions must match the ones in search queries.
+CREATE INDEX IF NOT EXISTS idx_services_name_fts ON services USING GIN (to_tsvector('simple', name));
+CREATE INDEX IF NOT EXISTS idx_subscriptions_notes_fts ON subscriptions USING GIN (to_tsvector('simple', COALESCE(notes, '')));
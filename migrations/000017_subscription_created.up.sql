@@ -0,0 +1,2 @@
+-- Serves the admin listing of recent subscriptions across all users.
+CREATE INDEX IF NOT EXISTS idx_subscriptions_created ON subscriptions(created_at DESC, id DESC);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS subscription_imports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status TEXT NOT NULL CHECK (status IN ('running', 'completed', 'failed')),
+    total_rows INTEGER NOT NULL,
+    valid_rows INTEGER NOT NULL,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    imported_rows INTEGER NOT NULL DEFAULT 0,
+    failed_rows INTEGER NOT NULL DEFAULT 0,
+    -- Rows that were skipped, as [{"line": 2, "error": "..."}].
+    errors JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
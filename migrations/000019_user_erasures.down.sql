@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_email_reminders_user;
+DROP TABLE IF EXISTS user_erasures;
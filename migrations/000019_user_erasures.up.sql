@@ -0,0 +1,14 @@
+-- Tombstones of erased user data. Only a hash of the user ID is kept, which
+-- proves the erasure for a known ID without storing the ID itself.
+CREATE TABLE IF NOT EXISTS user_erasures (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id_hash TEXT NOT NULL,
+    reference TEXT,
+    deleted JSONB NOT NULL,
+    erased_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_erasures_user ON user_erasures(user_id_hash);
+
+-- Lets erasure and export find reminders by user instead of scanning.
+CREATE INDEX IF NOT EXISTS idx_email_reminders_user ON email_reminders(user_id);
@@ -0,0 +1,7 @@
+ALTER TABLE subscriptions
+DROP CONSTRAINT IF EXISTS subscriptions_no_overlap;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS overlap_allowed;
+
+DROP EXTENSION IF EXISTS btree_gist;
@@ -0,0 +1,26 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- Subscriptions saved with an overlap under the warn or allow policy are
+-- exempt from the exclusion constraint.
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS overlap_allowed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing overlaps are kept: a subscription that overlaps an earlier created
+-- one of the same user and service becomes exempt.
+UPDATE subscriptions s
+SET overlap_allowed = TRUE
+WHERE EXISTS (
+    SELECT 1
+    FROM subscriptions o
+    WHERE o.user_id = s.user_id
+      AND o.service_id = s.service_id
+      AND (COALESCE(o.created_at, '-infinity'), o.id) < (COALESCE(s.created_at, '-infinity'), s.id)
+      AND daterange(o.start_date, o.end_date, '[]') && daterange(s.start_date, s.end_date, '[]')
+);
+
+-- A subscription without an end date runs indefinitely. The expression must
+-- match the one in overlap queries.
+ALTER TABLE subscriptions
+ADD CONSTRAINT subscriptions_no_overlap
+EXCLUDE USING gist (user_id WITH =, service_id WITH =, daterange(start_date, end_date, '[]') WITH &&)
+WHERE (NOT overlap_allowed);
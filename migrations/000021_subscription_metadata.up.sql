@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}' CHECK (jsonb_typeof(metadata) = 'object');
+
+-- Serves metadata filters of listings: key presence (?) and key values (@>).
+CREATE INDEX IF NOT EXISTS idx_subscriptions_metadata ON subscriptions USING GIN (metadata);
@@ -0,0 +1,3 @@
+ALTER TABLE monthly_costs
+DROP COLUMN IF EXISTS start_date,
+DROP COLUMN IF EXISTS subscription_id;
@@ -0,0 +1,8 @@
+-- A month is charged once, at the price of the earliest subscription active in
+-- it, so a snapshot row keeps which subscription it was taken from.
+ALTER TABLE monthly_costs
+ADD COLUMN IF NOT EXISTS subscription_id UUID,
+ADD COLUMN IF NOT EXISTS start_date DATE;
+
+-- Existing snapshots charged the highest price of every user and service.
+UPDATE monthly_cost_refreshes SET stale = TRUE;
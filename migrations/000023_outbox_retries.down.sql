@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_outbox_events_pending_aggregate;
+DROP INDEX IF EXISTS idx_outbox_events_due;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished
+ON outbox_events(created_at) WHERE published_at IS NULL;
+
+ALTER TABLE outbox_events
+DROP COLUMN IF EXISTS dead_at,
+DROP COLUMN IF EXISTS next_attempt_at;
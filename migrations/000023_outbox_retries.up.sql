@@ -0,0 +1,16 @@
+-- The relay leases events by pushing next_attempt_at forward and publishes
+-- them after committing the claim. Failed events are retried with a backoff
+-- until they run out of attempts and get dead_at, the dead-letter state.
+ALTER TABLE outbox_events
+ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+ADD COLUMN IF NOT EXISTS dead_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_outbox_events_unpublished;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due
+ON outbox_events(next_attempt_at) WHERE published_at IS NULL AND dead_at IS NULL;
+
+-- Finds an earlier pending event of the same subscription, which holds back
+-- the later ones.
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending_aggregate
+ON outbox_events(aggregate_id, created_at, id) WHERE published_at IS NULL AND dead_at IS NULL;
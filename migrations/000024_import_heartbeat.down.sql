@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subscription_imports_running;
+
+ALTER TABLE subscription_imports DROP COLUMN IF EXISTS heartbeat_at;
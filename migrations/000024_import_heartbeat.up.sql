@@ -0,0 +1,8 @@
+-- A running import touches heartbeat_at while it works. An import whose
+-- heartbeat stopped, because its instance crashed, is failed by the
+-- import_recovery job.
+ALTER TABLE subscription_imports
+ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_subscription_imports_running
+ON subscription_imports(heartbeat_at) WHERE status = 'running';
@@ -0,0 +1,10 @@
+ALTER TABLE subscriptions
+DROP CONSTRAINT IF EXISTS subscriptions_no_overlap;
+
+ALTER TABLE subscriptions
+ADD CONSTRAINT subscriptions_no_overlap
+EXCLUDE USING gist (user_id WITH =, service_id WITH =, daterange(start_date, end_date, '[]') WITH &&)
+WHERE (NOT overlap_allowed);
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS service_name;
@@ -0,0 +1,34 @@
+-- Overlaps are checked per service name, while a service is a name and a
+-- price. The name is copied to subscriptions so the exclusion constraint
+-- matches the same subscriptions as the checks in the application.
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS service_name TEXT;
+
+UPDATE subscriptions s
+SET service_name = svc.name
+FROM services svc
+WHERE svc.id = s.service_id
+  AND s.service_name IS DISTINCT FROM svc.name;
+
+ALTER TABLE subscriptions ALTER COLUMN service_name SET NOT NULL;
+
+-- Existing overlaps between prices of one service are kept, as in 000020.
+UPDATE subscriptions s
+SET overlap_allowed = TRUE
+WHERE NOT s.overlap_allowed
+  AND EXISTS (
+    SELECT 1
+    FROM subscriptions o
+    WHERE o.user_id = s.user_id
+      AND o.service_name = s.service_name
+      AND (COALESCE(o.created_at, '-infinity'), o.id) < (COALESCE(s.created_at, '-infinity'), s.id)
+      AND daterange(o.start_date, o.end_date, '[]') && daterange(s.start_date, s.end_date, '[]')
+);
+
+ALTER TABLE subscriptions
+DROP CONSTRAINT IF EXISTS subscriptions_no_overlap;
+
+ALTER TABLE subscriptions
+ADD CONSTRAINT subscriptions_no_overlap
+EXCLUDE USING gist (user_id WITH =, service_name WITH =, daterange(start_date, end_date, '[]') WITH &&)
+WHERE (NOT overlap_allowed);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_outbox_events_dead;
+DROP INDEX IF EXISTS idx_outbox_events_unpublished_aggregate;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending_aggregate
+ON outbox_events(aggregate_id, created_at, id) WHERE published_at IS NULL AND dead_at IS NULL;
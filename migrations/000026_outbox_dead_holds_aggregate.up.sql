@@ -0,0 +1,9 @@
+-- A dead event holds back the later events of its subscription until it is
+-- requeued, so consumers never see them out of order.
+DROP INDEX IF EXISTS idx_outbox_events_pending_aggregate;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished_aggregate
+ON outbox_events(aggregate_id, created_at, id) WHERE published_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_dead
+ON outbox_events(dead_at) WHERE dead_at IS NOT NULL AND published_at IS NULL;
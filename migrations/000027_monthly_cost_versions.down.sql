@@ -0,0 +1,2 @@
+ALTER TABLE monthly_cost_refreshes
+DROP COLUMN IF EXISTS version;
@@ -0,0 +1,5 @@
+-- version counts the invalidations of a month. Replicas cache analytics of
+-- closed months together with the version they were computed at and drop
+-- them once it changes.
+ALTER TABLE monthly_cost_refreshes
+ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
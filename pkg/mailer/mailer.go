@@ -0,0 +1,192 @@
+// Package mailer sends multipart text and HTML emails over SMTP.
+//
+// STARTTLS is used when the server offers it, authentication when a username
+// is configured. A local sink such as Mailpit on port 1025 needs neither.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an optional HTML body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Settings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+type SMTPSender struct {
+	settings Settings
+}
+
+func NewSMTPSender(settings Settings) *SMTPSender {
+	if settings.Port == 0 {
+		settings.Port = 587
+	}
+	if settings.Timeout <= 0 {
+		settings.Timeout = 10 * time.Second
+	}
+	return &SMTPSender{settings: settings}
+}
+
+// Send delivers msg over a new connection. The deadline of ctx, or the
+// configured timeout, bounds the whole SMTP session.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.settings.From)
+	if err != nil {
+		return fmt.Errorf("mailer - parse from address: %v", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("mailer - parse to address: %v", err)
+	}
+
+	body, err := buildMessage(from, to, msg)
+	if err != nil {
+		return fmt.Errorf("mailer - build message: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.settings.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.settings.Host, strconv.Itoa(s.settings.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("mailer - dial %s: %v", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.settings.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer - handshake: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.settings.Host}); err != nil {
+			return fmt.Errorf("mailer - starttls: %v", err)
+		}
+	}
+	if s.settings.Username != "" {
+		auth := smtp.PlainAuth("", s.settings.Username, s.settings.Password, s.settings.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("mailer - auth: %v", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("mailer - mail from: %v", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("mailer - rcpt to: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer - data: %v", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("mailer - write body: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer - close body: %v", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage renders msg as a MIME message, multipart/alternative when it
+// has an HTML body.
+func buildMessage(from, to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(fromAddress string) string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	domain := "localhost"
+	if at := strings.LastIndexByte(fromAddress, '@'); at >= 0 {
+		domain = fromAddress[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(buf), domain)
+}
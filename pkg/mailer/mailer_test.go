@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DmitriyKolesnikM8O/subscription-service/pkg/mailer/mailtest"
+)
+
+func newTestSender(sink *mailtest.Sink) *SMTPSender {
+	return NewSMTPSender(Settings{
+		Host:    sink.Host,
+		Port:    sink.Port,
+		From:    "Subscription Service <noreply@example.com>",
+		Timeout: time.Second,
+	})
+}
+
+func TestSendMultipartMessage(t *testing.T) {
+	sink := mailtest.NewSink(t)
+
+	err := newTestSender(sink).Send(context.Background(), Message{
+		To:      "Иван <ivan@example.com>",
+		Subject: "Скоро списание за Yandex Plus",
+		Text:    "12.09.2025 будет списание: 400 ₽.",
+		HTML:    "<p>12.09.2025 будет списание: <b>400&nbsp;₽</b>.</p>",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	mails := sink.Mails()
+	if len(mails) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(mails))
+	}
+	m := mails[0]
+	if m.From != "noreply@example.com" {
+		t.Errorf("MAIL FROM %q, want noreply@example.com", m.From)
+	}
+	if len(m.To) != 1 || m.To[0] != "ivan@example.com" {
+		t.Errorf("RCPT TO %v, want [ivan@example.com]", m.To)
+	}
+	if m.Subject != "Скоро списание за Yandex Plus" {
+		t.Errorf("subject %q", m.Subject)
+	}
+	if m.Text != "12.09.2025 будет списание: 400 ₽." {
+		t.Errorf("text body %q", m.Text)
+	}
+	if m.HTML != "<p>12.09.2025 будет списание: <b>400&nbsp;₽</b>.</p>" {
+		t.Errorf("html body %q", m.HTML)
+	}
+	if to := m.Header.Get("To"); !strings.Contains(to, "<ivan@example.com>") {
+		t.Errorf("To header %q", to)
+	}
+	if id := m.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID %q, want it in the sender's domain", id)
+	}
+}
+
+func TestSendPlainTextMessage(t *testing.T) {
+	sink := mailtest.NewSink(t)
+
+	err := newTestSender(sink).Send(context.Background(), Message{
+		To:      "anna@example.com",
+		Subject: "Upcoming Netflix charge",
+		Text:    "Your Netflix subscription will be charged 799 RUB on September 12, 2025.",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	mails := sink.Mails()
+	if len(mails) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(mails))
+	}
+	if got := mails[0].Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type %q", got)
+	}
+	if mails[0].HTML != "" || !strings.Contains(mails[0].Text, "799 RUB") {
+		t.Errorf("bodies text %q html %q", mails[0].Text, mails[0].HTML)
+	}
+}
+
+func TestSendReportsRejectedRecipient(t *testing.T) {
+	sink := mailtest.NewSink(t)
+	sink.Reject.Store(true)
+
+	err := newTestSender(sink).Send(context.Background(), Message{To: "anna@example.com", Subject: "s", Text: "t"})
+	if err == nil || !strings.Contains(err.Error(), "rcpt to") {
+		t.Errorf("Send = %v, want a rcpt to error", err)
+	}
+	if n := len(sink.Mails()); n != 0 {
+		t.Errorf("sink received %d messages", n)
+	}
+}
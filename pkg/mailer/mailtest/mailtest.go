@@ -0,0 +1,206 @@
+// Package mailtest runs a local SMTP sink for tests of code that sends email.
+package mailtest
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Mail is a message received by the sink with its bodies decoded.
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Header  mail.Header
+	Text    string
+	HTML    string
+}
+
+// Sink is a plain SMTP server on a loopback port that accepts every message
+// without authentication or TLS.
+type Sink struct {
+	Host string
+	Port int
+
+	// Reject makes the sink refuse recipients with a permanent error.
+	Reject atomic.Bool
+
+	mu    sync.Mutex
+	mails []Mail
+	errs  []error
+}
+
+// NewSink starts a sink that stops when the test ends. Messages the sink
+// could not parse fail the test.
+func NewSink(t testing.TB) *Sink {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mailtest - listen: %v", err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	s := &Sink{Host: addr.IP.String(), Port: addr.Port}
+
+	// The accept loop holds the group open so connections join it before
+	// cleanup waits.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		wg.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, err := range s.errs {
+			t.Errorf("mailtest - %v", err)
+		}
+	})
+	return s
+}
+
+// Mails returns the messages received so far.
+func (s *Sink) Mails() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.mails...)
+}
+
+func (s *Sink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) { _ = tp.PrintfLine("%d %s", code, msg) }
+
+	reply(220, "mailtest ready")
+	var from string
+	var to []string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply(250, "mailtest")
+		case "MAIL":
+			from, to = addressArg(arg), nil
+			reply(250, "OK")
+		case "RCPT":
+			if s.Reject.Load() {
+				reply(550, "mailbox unavailable")
+				continue
+			}
+			to = append(to, addressArg(arg))
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.receive(from, to, data)
+			reply(250, "OK")
+		case "RSET", "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+func (s *Sink) receive(from string, to []string, data []byte) {
+	m, err := parse(string(data))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errs = append(s.errs, err)
+		return
+	}
+	m.From, m.To = from, to
+	s.mails = append(s.mails, m)
+}
+
+// addressArg extracts the address from "FROM:<a@b>" or "TO:<a@b>".
+func addressArg(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	return strings.Trim(strings.TrimSpace(addr), "<>")
+}
+
+func parse(data string) (Mail, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		return Mail{}, fmt.Errorf("read message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return Mail{}, fmt.Errorf("decode subject: %v", err)
+	}
+	m := Mail{Subject: subject, Header: msg.Header}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return Mail{}, fmt.Errorf("content type: %v", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		m.Text, err = decodeBody(msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+		return m, err
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return Mail{}, fmt.Errorf("read part: %v", err)
+		}
+		body, err := decodeBody(part.Header.Get("Content-Transfer-Encoding"), part)
+		if err != nil {
+			return Mail{}, err
+		}
+		switch partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); partType {
+		case "text/plain":
+			m.Text = body
+		case "text/html":
+			m.HTML = body
+		}
+	}
+}
+
+func decodeBody(encoding string, r io.Reader) (string, error) {
+	if strings.EqualFold(encoding, "quoted-printable") {
+		r = quotedprintable.NewReader(r)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("read body: %v", err)
+	}
+	return string(body), nil
+}
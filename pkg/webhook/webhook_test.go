@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test"
+
+func signedHeader(secret string, timestamp int64, body []byte) http.Header {
+	h := http.Header{}
+	h.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	h.Set(HeaderSignature, Sign(secret, timestamp, body))
+	return h
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	body := []byte(`{"type":"subscription.created"}`)
+	now := time.Now().Unix()
+
+	if err := Verify(testSecret, signedHeader(testSecret, now, body), body, time.Minute); err != nil {
+		t.Fatalf("Verify of a freshly signed request: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+	}{
+		{"tampered body", signedHeader(testSecret, now, body), []byte(`{"type":"subscription.deleted"}`)},
+		{"wrong secret", signedHeader("whsec_other", now, body), body},
+		{"missing signature", http.Header{HeaderTimestamp: {strconv.FormatInt(now, 10)}}, body},
+		{"bad timestamp", http.Header{HeaderTimestamp: {"yesterday"}}, body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(testSecret, tt.header, tt.body, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	body := []byte(`{}`)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		sentAt    time.Time
+		tolerance time.Duration
+		valid     bool
+	}{
+		{"within window", now.Add(-4 * time.Minute), 5 * time.Minute, true},
+		{"too old", now.Add(-6 * time.Minute), 5 * time.Minute, false},
+		{"too far in the future", now.Add(6 * time.Minute), 5 * time.Minute, false},
+		{"zero tolerance disables the check", now.Add(-24 * time.Hour), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := tt.sentAt.Unix()
+			err := Verify(testSecret, signedHeader(testSecret, ts, body), body, tt.tolerance)
+			if tt.valid && err != nil {
+				t.Errorf("Verify = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestClientSendSignsRequest(t *testing.T) {
+	var (
+		gotHeader http.Header
+		gotBody   []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	body := []byte(`{"id":"1"}`)
+	code, err := NewClient(time.Second, true).Send(context.Background(), Request{
+		URL:        srv.URL,
+		Secret:     testSecret,
+		Event:      "subscription.created",
+		DeliveryID: "delivery-1",
+		Body:       body,
+	})
+	if err != nil || code != http.StatusAccepted {
+		t.Fatalf("Send = %d, %v; want 202, nil", code, err)
+	}
+
+	if string(gotBody) != string(body) {
+		t.Errorf("receiver got body %q, want %q", gotBody, body)
+	}
+	if got := gotHeader.Get(HeaderEvent); got != "subscription.created" {
+		t.Errorf("%s = %q", HeaderEvent, got)
+	}
+	if got := gotHeader.Get(HeaderDelivery); got != "delivery-1" {
+		t.Errorf("%s = %q", HeaderDelivery, got)
+	}
+	if err := Verify(testSecret, gotHeader, gotBody, time.Minute); err != nil {
+		t.Errorf("receiver could not verify the request: %v", err)
+	}
+}
+
+func TestClientSendReportsFailureStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	code, err := NewClient(time.Second, true).Send(context.Background(), Request{URL: srv.URL, Secret: testSecret})
+	if err == nil || code != http.StatusInternalServerError {
+		t.Errorf("Send = %d, %v; want 500 and an error", code, err)
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(time.Second, false).Send(context.Background(), Request{URL: srv.URL, Secret: testSecret})
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Send to %s = %v, want ErrForbiddenAddress", srv.URL, err)
+	}
+	if called {
+		t.Error("request reached the loopback receiver")
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"fc00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+		"224.0.0.1":       false,
+	}
+	for addr, want := range tests {
+		if got := IsPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckHostLiteral(t *testing.T) {
+	if err := CheckHost(context.Background(), "169.254.169.254"); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("CheckHost(metadata address) = %v, want ErrForbiddenAddress", err)
+	}
+	if err := CheckHost(context.Background(), "localhost"); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("CheckHost(localhost) = %v, want ErrForbiddenAddress", err)
+	}
+	if err := CheckHost(context.Background(), "93.184.216.34"); err != nil {
+		t.Errorf("CheckHost(public address) = %v, want nil", err)
+	}
+}